@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/jgbaldwinbrown/fastats/pkg"
+)
+
+func main() {
+	fastats.FullFqTrim()
+}
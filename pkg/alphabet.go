@@ -0,0 +1,202 @@
+package fastats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A set of allowed sequence letters, matched without regard to case.
+type Alphabet struct {
+	Name    string
+	Letters string
+	valid   [256]bool
+}
+
+func NewAlphabet(name, letters string) *Alphabet {
+	a := &Alphabet{Name: name, Letters: letters}
+	for i := 0; i < len(letters); i++ {
+		a.valid[strings.ToUpper(letters[i : i+1])[0]] = true
+		a.valid[strings.ToLower(letters[i : i+1])[0]] = true
+	}
+	return a
+}
+
+var (
+	DNAAlphabet          = NewAlphabet("DNA", "ACGT")
+	DNAIUPACAlphabet     = NewAlphabet("DNA with IUPAC codes", "ACGTRYSWKMBDHVN")
+	RNAAlphabet          = NewAlphabet("RNA", "ACGU")
+	RNAIUPACAlphabet     = NewAlphabet("RNA with IUPAC codes", "ACGURYSWKMBDHVN")
+	ProteinAlphabet      = NewAlphabet("protein", "ACDEFGHIKLMNPQRSTVWY")
+	ProteinIUPACAlphabet = NewAlphabet("protein with IUPAC codes", "ACDEFGHIKLMNPQRSTVWYBZJUOX*")
+)
+
+func (a *Alphabet) Contains(c byte) bool {
+	return a.valid[c]
+}
+
+// An error naming the first letter of seq not in the alphabet.
+func (a *Alphabet) Validate(seq string) error {
+	for i := 0; i < len(seq); i++ {
+		if !a.valid[seq[i]] {
+			return fmt.Errorf("Alphabet.Validate: %q at position %v is not %v", seq[i], i, a.Name)
+		}
+	}
+	return nil
+}
+
+func ValidateFa[F FaEnter](a *Alphabet, f F) error {
+	if e := a.Validate(f.FaSeq()); e != nil {
+		return fmt.Errorf("%v: %w", f.FaHeader(), e)
+	}
+	return nil
+}
+
+// The narrowest of DNA, RNA and protein, with or without IUPAC codes, that
+// seq fits, or nil if it fits none.
+func GuessAlphabet(seq string) *Alphabet {
+	for _, a := range []*Alphabet{DNAAlphabet, RNAAlphabet, DNAIUPACAlphabet, RNAIUPACAlphabet, ProteinAlphabet, ProteinIUPACAlphabet} {
+		if a.Validate(seq) == nil {
+			return a
+		}
+	}
+	return nil
+}
+
+var iupacBases = map[byte]string{
+	'A': "A", 'C': "C", 'G': "G", 'T': "T", 'U': "T",
+	'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+	'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG", 'N': "ACGT",
+}
+
+// The DNA bases an IUPAC nucleotide code stands for, in upper case, or "" if
+// c is not a code. U stands for T.
+func IUPACBases(c byte) string {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	return iupacBases[c]
+}
+
+// The IUPAC code for a set of bases, or 'N' if bases is empty or not DNA.
+func IUPACCode(bases string) byte {
+	var want [4]bool
+	for i := 0; i < len(bases); i++ {
+		switch IUPACBases(bases[i]) {
+		case "A":
+			want[0] = true
+		case "C":
+			want[1] = true
+		case "G":
+			want[2] = true
+		case "T":
+			want[3] = true
+		default:
+			return 'N'
+		}
+	}
+	for code, exp := range iupacBases {
+		if code == 'U' {
+			continue
+		}
+		var have [4]bool
+		for _, b := range exp {
+			have[strings.IndexRune("ACGT", b)] = true
+		}
+		if have == want {
+			return code
+		}
+	}
+	return 'N'
+}
+
+func IsAmbiguous(c byte) bool {
+	return len(IUPACBases(c)) > 1
+}
+
+var complementTable = func() [256]byte {
+	var t [256]byte
+	for i := range t {
+		t[i] = byte(i)
+	}
+	pairs := []string{"AT", "CG", "RY", "KM", "BV", "DH", "SS", "WW", "NN", "UA"}
+	for _, p := range pairs {
+		for _, c := range []string{p, strings.ToLower(p)} {
+			t[c[0]] = c[1]
+			if c[0] != 'U' && c[0] != 'u' {
+				t[c[1]] = c[0]
+			}
+		}
+	}
+	return t
+}()
+
+// The reverse complement of a DNA sequence, keeping case and complementing
+// IUPAC ambiguity codes. U is complemented to A.
+func ReverseComplement(seq string) string {
+	out := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		out[len(seq)-1-i] = complementTable[seq[i]]
+	}
+	return string(out)
+}
+
+// Like ReverseComplement, but writing U instead of T.
+func ReverseComplementRNA(seq string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case 'T':
+			return 'U'
+		case 't':
+			return 'u'
+		}
+		return r
+	}, ReverseComplement(seq))
+}
+
+// The reverse complement of a fasta entry, with the header unchanged.
+func ReverseComplementFa[F FaEnter](f F) FaEntry {
+	return FaEntry{f.FaHeader(), ReverseComplement(f.FaSeq())}
+}
+
+// GC content weighted by ambiguity: each IUPAC code counts as the fraction
+// of its bases that are G or C, so S counts fully and R counts half. N and
+// letters that are not IUPAC codes are not counted.
+func GCCount(seq string) (gc, bp float64) {
+	for i := 0; i < len(seq); i++ {
+		exp := IUPACBases(seq[i])
+		if exp == "" || len(exp) == 4 {
+			continue
+		}
+		gc += float64(strings.Count(exp, "G")+strings.Count(exp, "C")) / float64(len(exp))
+		bp++
+	}
+	return gc, bp
+}
+
+// The translation of seq in one of the six frames, 1 to 3 on the forward
+// strand and -1 to -3 on the reverse complement, each starting 0 to 2 bases
+// in.
+func TranslateFrame(seq string, frame int, code GeneticCode) (string, error) {
+	if frame == 0 || frame > 3 || frame < -3 {
+		return "", fmt.Errorf("TranslateFrame: frame %v not in 1 to 3 or -1 to -3", frame)
+	}
+	if frame < 0 {
+		seq = ReverseComplement(seq)
+		frame = -frame
+	}
+	if frame-1 > len(seq) {
+		return "", nil
+	}
+	return code.TranslateSeq(seq[frame-1:], false), nil
+}
+
+// Translations of a fasta entry in all six frames, in the order 1, 2, 3, -1,
+// -2, -3, with the frame added to each header.
+func SixFrameTranslate[F FaEnter](f F, code GeneticCode) []FaEntry {
+	out := make([]FaEntry, 0, 6)
+	for _, frame := range []int{1, 2, 3, -1, -2, -3} {
+		seq, _ := TranslateFrame(f.FaSeq(), frame, code)
+		out = append(out, FaEntry{fmt.Sprintf("%v frame=%+d", f.FaHeader(), frame), seq})
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package fastats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAlphabets(t *testing.T) {
+	if e := DNAAlphabet.Validate("ACGTacgt"); e != nil {
+		t.Error(e)
+	}
+	if e := DNAAlphabet.Validate("ACGN"); e == nil {
+		t.Errorf("N accepted as plain DNA")
+	}
+	for seq, exp := range map[string]*Alphabet{"ACGT": DNAAlphabet, "ACGU": RNAAlphabet, "ACRN": DNAIUPACAlphabet, "MKLW": ProteinAlphabet, "AC!": nil} {
+		if got := GuessAlphabet(seq); got != exp {
+			t.Errorf("%v: got %v != exp %v", seq, got, exp)
+		}
+	}
+	if IUPACCode("GA") != 'R' || IUPACCode("ACGT") != 'N' || IUPACCode("c") != 'C' || IUPACBases('y') != "CT" {
+		t.Errorf("IUPAC codes")
+	}
+	if got := ReverseComplementRNA("AUGc"); got != "gCAU" {
+		t.Errorf("RNA revcomp %v", got)
+	}
+}
+
+func TestAmbiguousGCAndTranslation(t *testing.T) {
+	if gc, bp := GCCount("GCATSWRN"); gc != 3.5 || bp != 7 {
+		t.Errorf("GCCount %v %v", gc, bp)
+	}
+	code, _ := GetGeneticCode(1)
+	// GGN is always glycine, RTG is methionine or valine.
+	if got := code.TranslateSeq("GGNCGNAGR", false); got != "GRR" {
+		t.Errorf("ambiguous translation %v", got)
+	}
+	if got := code.Translate("AGY"); got != 'S' {
+		t.Errorf("AGY %c", got)
+	}
+	if got := code.Translate("RTG"); got != 'X' {
+		t.Errorf("RTG %c", got)
+	}
+
+	frames := SixFrameTranslate(FaEntry{"s", "ATGGCCTAA"}, code)
+	var seqs []string
+	for _, f := range frames {
+		seqs = append(seqs, f.Seq)
+	}
+	if exp := []string{"MA*", "WP", "GL", "LGH", "*A", "RP"}; !reflect.DeepEqual(seqs, exp) {
+		t.Errorf("six frames %v != %v", seqs, exp)
+	}
+	if frames[3].Header != "s frame=-1" {
+		t.Errorf("header %v", frames[3].Header)
+	}
+}
+
+func TestExtractFastaStranded(t *testing.T) {
+	fa := ParseFasta(strings.NewReader(">1\nAACCGGTTA\n"))
+	gff := []GffFlatEntry{{GffHead: GffHead{ChrSpan: ChrSpan{"1", Span{0, 4}}, Strand: '-'}}}
+	got, e := CollectErr(ExtractFasta(fa, SliceIter2(gff)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 1 || got[0] != (FaEntry{"1:0-4(-)", "GGTT"}) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,671 @@
+package fastats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"strings"
+)
+
+var ErrBamFormat = errors.New("bam format error")
+
+const bamCigarOps = "MIDNSHP=X"
+const bamSeqCodes = "=ACMGRSVTWYHKDBN"
+
+var bamSeqIndex = func() [256]byte {
+	var out [256]byte
+	for i := range out {
+		out[i] = 15
+	}
+	for i := 0; i < len(bamSeqCodes); i++ {
+		out[bamSeqCodes[i]] = byte(i)
+		out[strings.ToLower(bamSeqCodes[i : i+1])[0]] = byte(i)
+	}
+	return out
+}()
+
+type BamRef struct {
+	Name string
+	Len  int64
+}
+
+type BamHeader struct {
+	Text string
+	Refs []BamRef
+}
+
+// Build a BamHeader from SAM header text, taking the references from its @SQ
+// lines.
+func BamHeaderFromText(text string) (BamHeader, error) {
+	h, e := ParseSamHeaderText(text)
+	if e != nil {
+		return BamHeader{}, e
+	}
+	b := h.BamHeader()
+	b.Text = text
+	return b, nil
+}
+
+// The header as SamEntry header lines, adding @SQ lines for the binary
+// reference list if the text has none.
+func (h BamHeader) Entries() []SamEntry {
+	var out []SamEntry
+	hasSQ := false
+	for _, line := range strings.Split(strings.TrimRight(h.Text, "\n"), "\n") {
+		if len(line) < 1 || line[0] != '@' {
+			continue
+		}
+		if strings.HasPrefix(line, "@SQ\t") {
+			hasSQ = true
+		}
+		out = append(out, ParseSamHeading(line))
+	}
+	if !hasSQ {
+		for _, ref := range h.Refs {
+			out = append(out, ParseSamHeading(fmt.Sprintf("@SQ\tSN:%v\tLN:%v", ref.Name, ref.Len)))
+		}
+	}
+	return out
+}
+
+type BamReader struct {
+	r      *BgzfReader
+	Header BamHeader
+	buf    []byte
+}
+
+func readBamInt32(r io.Reader) (int32, error) {
+	var buf [4]byte
+	if _, e := io.ReadFull(r, buf[:]); e != nil {
+		return 0, e
+	}
+	return int32(binary.LittleEndian.Uint32(buf[:])), nil
+}
+
+func readBamHeader(r io.Reader) (BamHeader, error) {
+	var h BamHeader
+	var magic [4]byte
+	if _, e := io.ReadFull(r, magic[:]); e != nil {
+		return h, fmt.Errorf("readBamHeader: %w", e)
+	}
+	if string(magic[:]) != "BAM\x01" {
+		return h, fmt.Errorf("readBamHeader: %w: bad magic %q", ErrBamFormat, magic)
+	}
+	ltext, e := readBamInt32(r)
+	if e != nil {
+		return h, e
+	}
+	text := make([]byte, ltext)
+	if _, e := io.ReadFull(r, text); e != nil {
+		return h, e
+	}
+	h.Text = strings.TrimRight(string(text), "\x00")
+
+	nref, e := readBamInt32(r)
+	if e != nil {
+		return h, e
+	}
+	for i := int32(0); i < nref; i++ {
+		lname, e := readBamInt32(r)
+		if e != nil {
+			return h, e
+		}
+		name := make([]byte, lname)
+		if _, e := io.ReadFull(r, name); e != nil {
+			return h, e
+		}
+		lref, e := readBamInt32(r)
+		if e != nil {
+			return h, e
+		}
+		h.Refs = append(h.Refs, BamRef{Name: strings.TrimRight(string(name), "\x00"), Len: int64(lref)})
+	}
+	return h, nil
+}
+
+func NewBamReader(r io.Reader) (*BamReader, error) {
+	b := &BamReader{r: NewBgzfReader(r)}
+	var e error
+	b.Header, e = readBamHeader(b.r)
+	if e != nil {
+		return nil, e
+	}
+	return b, nil
+}
+
+// The virtual offset of the next record.
+func (b *BamReader) Tell() uint64 {
+	return b.r.Tell()
+}
+
+func (b *BamReader) Seek(voff uint64) error {
+	return b.r.Seek(voff)
+}
+
+func (b *BamReader) refName(id int32) (string, error) {
+	if id < 0 {
+		return "*", nil
+	}
+	if int(id) >= len(b.Header.Refs) {
+		return "", fmt.Errorf("BamReader: %w: reference id %v out of range", ErrBamFormat, id)
+	}
+	return b.Header.Refs[id].Name, nil
+}
+
+// Read the next alignment. Returns io.EOF at the end of the file.
+func (b *BamReader) Read() (SamEntry, error) {
+	var s SamEntry
+	size, e := readBamInt32(b.r)
+	if e == io.ErrUnexpectedEOF {
+		return s, fmt.Errorf("BamReader.Read: %w: truncated record", ErrBamFormat)
+	}
+	if e != nil {
+		return s, e
+	}
+	if size < 32 {
+		return s, fmt.Errorf("BamReader.Read: %w: block_size %v too small", ErrBamFormat, size)
+	}
+	b.buf = GrowLen(b.buf[:0], int(size))
+	if _, e := io.ReadFull(b.r, b.buf); e != nil {
+		return s, fmt.Errorf("BamReader.Read: %w", e)
+	}
+	e = b.decode(&s, b.buf)
+	return s, e
+}
+
+func (b *BamReader) decode(s *SamEntry, buf []byte) error {
+	le := binary.LittleEndian
+	refID := int32(le.Uint32(buf[0:]))
+	pos := int32(le.Uint32(buf[4:]))
+	lname := int(buf[8])
+	s.Mapq = int64(buf[9])
+	ncigar := int(le.Uint16(buf[12:]))
+	s.Flag = le.Uint16(buf[14:])
+	lseq := int(int32(le.Uint32(buf[16:])))
+	nextRefID := int32(le.Uint32(buf[20:]))
+	nextPos := int32(le.Uint32(buf[24:]))
+	s.Tlen = int64(int32(le.Uint32(buf[28:])))
+
+	var e error
+	if s.Rname, e = b.refName(refID); e != nil {
+		return e
+	}
+	if nextRefID >= 0 && nextRefID == refID {
+		s.Rnext = "="
+	} else if s.Rnext, e = b.refName(nextRefID); e != nil {
+		return e
+	}
+	s.Pos = int64(pos) + 1
+	s.Pnext = int64(nextPos) + 1
+
+	i := 32
+	need := i + lname + ncigar*4 + (lseq+1)/2 + lseq
+	if lseq < 0 || need > len(buf) {
+		return fmt.Errorf("BamReader: %w: record fields longer than block", ErrBamFormat)
+	}
+	s.Qname = strings.TrimRight(string(buf[i:i+lname]), "\x00")
+	i += lname
+
+	if ncigar == 0 {
+		s.CIGAR = "*"
+	} else {
+		var c strings.Builder
+		for j := 0; j < ncigar; j++ {
+			op := le.Uint32(buf[i:])
+			if op&0xf >= uint32(len(bamCigarOps)) {
+				return fmt.Errorf("BamReader: %w: bad cigar op %v", ErrBamFormat, op&0xf)
+			}
+			fmt.Fprintf(&c, "%d%c", op>>4, bamCigarOps[op&0xf])
+			i += 4
+		}
+		s.CIGAR = c.String()
+	}
+
+	if lseq == 0 {
+		s.Seq = "*"
+		s.Qual = "*"
+	} else {
+		seq := make([]byte, lseq)
+		for j := range seq {
+			code := buf[i+j/2] >> 4
+			if j%2 == 1 {
+				code = buf[i+j/2] & 0xf
+			}
+			seq[j] = bamSeqCodes[code]
+		}
+		s.Seq = string(seq)
+		i += (lseq + 1) / 2
+
+		qual := make([]byte, lseq)
+		missing := true
+		for j := range qual {
+			if buf[i+j] != 0xff {
+				missing = false
+			}
+			qual[j] = buf[i+j] + 33
+		}
+		s.Qual = string(qual)
+		if missing {
+			s.Qual = "*"
+		}
+		i += lseq
+	}
+
+	s.Optional = s.Optional[:0]
+	for i < len(buf) {
+		o, n, e := decodeBamAux(buf[i:])
+		if e != nil {
+			return e
+		}
+		s.Optional = append(s.Optional, o)
+		i += n
+	}
+	return nil
+}
+
+func bamIntSize(t byte) int {
+	switch t {
+	case 'c', 'C', 'A':
+		return 1
+	case 's', 'S':
+		return 2
+	case 'i', 'I', 'f':
+		return 4
+	}
+	return 0
+}
+
+func decodeBamInt(t byte, buf []byte) int64 {
+	le := binary.LittleEndian
+	switch t {
+	case 'c':
+		return int64(int8(buf[0]))
+	case 'C':
+		return int64(buf[0])
+	case 's':
+		return int64(int16(le.Uint16(buf)))
+	case 'S':
+		return int64(le.Uint16(buf))
+	case 'i':
+		return int64(int32(le.Uint32(buf)))
+	case 'I':
+		return int64(le.Uint32(buf))
+	}
+	return 0
+}
+
+func decodeBamAux(buf []byte) (o SamOptional, n int, err error) {
+	short := fmt.Errorf("decodeBamAux: %w: truncated aux field", ErrBamFormat)
+	if len(buf) < 4 {
+		return o, 0, short
+	}
+	copy(o.Tag[:], buf[:2])
+	t := buf[2]
+	n = 3
+	switch t {
+	case 'A':
+		o.Type = 'A'
+		o.Char = buf[n]
+		n++
+	case 'c', 'C', 's', 'S', 'i', 'I':
+		o.Type = 'i'
+		size := bamIntSize(t)
+		if len(buf) < n+size {
+			return o, 0, short
+		}
+		o.Int = decodeBamInt(t, buf[n:])
+		n += size
+	case 'f':
+		o.Type = 'f'
+		if len(buf) < n+4 {
+			return o, 0, short
+		}
+		o.Float = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[n:])))
+		n += 4
+	case 'Z', 'H':
+		o.Type = t
+		end := bytes.IndexByte(buf[n:], 0)
+		if end < 0 {
+			return o, 0, short
+		}
+		val := string(buf[n : n+end])
+		n += end + 1
+		if t == 'Z' {
+			o.String = val
+		} else if o.ByteArray, err = ParseByteArray(val); err != nil {
+			return o, 0, err
+		}
+	case 'B':
+		o.Type = 'B'
+		if len(buf) < n+5 {
+			return o, 0, short
+		}
+		o.NumArrayType = buf[n]
+		count := int(binary.LittleEndian.Uint32(buf[n+1:]))
+		n += 5
+		size := bamIntSize(o.NumArrayType)
+		if size == 0 || o.NumArrayType == 'A' {
+			return o, 0, fmt.Errorf("decodeBamAux: %w: bad array type %c", ErrBamFormat, o.NumArrayType)
+		}
+		if count < 0 || len(buf) < n+count*size {
+			return o, 0, short
+		}
+		for j := 0; j < count; j++ {
+			if o.NumArrayType == 'f' {
+				o.FloatArray = append(o.FloatArray, float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[n:]))))
+			} else {
+				o.IntArray = append(o.IntArray, decodeBamInt(o.NumArrayType, buf[n:]))
+			}
+			n += size
+		}
+	default:
+		return o, 0, fmt.Errorf("decodeBamAux: %w: unknown aux type %c", ErrBamFormat, t)
+	}
+	return o, n, nil
+}
+
+// Iterate over the alignments in a BAM file. The header is yielded first, one
+// SamEntry per line, as with text SAM.
+func ParseBam(r io.Reader) iter.Seq2[SamEntry, error] {
+	return func(yield func(SamEntry, error) bool) {
+		b, e := NewBamReader(r)
+		if e != nil {
+			yield(SamEntry{}, e)
+			return
+		}
+		for _, h := range b.Header.Entries() {
+			if !yield(h, nil) {
+				return
+			}
+		}
+		for {
+			s, e := b.Read()
+			if e == io.EOF {
+				return
+			}
+			if !yield(s, e) || e != nil {
+				return
+			}
+		}
+	}
+}
+
+type BamWriter struct {
+	bw     *BgzfWriter
+	Header BamHeader
+	refs   map[string]int32
+	buf    []byte
+}
+
+func writeBamHeader(w io.Writer, h BamHeader) error {
+	le := binary.LittleEndian
+	buf := []byte("BAM\x01")
+	buf = le.AppendUint32(buf, uint32(len(h.Text)))
+	buf = append(buf, h.Text...)
+	buf = le.AppendUint32(buf, uint32(len(h.Refs)))
+	for _, ref := range h.Refs {
+		buf = le.AppendUint32(buf, uint32(len(ref.Name)+1))
+		buf = append(buf, ref.Name...)
+		buf = append(buf, 0)
+		buf = le.AppendUint32(buf, uint32(ref.Len))
+	}
+	_, e := w.Write(buf)
+	return e
+}
+
+func NewBamWriter(w io.Writer, h BamHeader) (*BamWriter, error) {
+	b := &BamWriter{bw: NewBgzfWriter(w), Header: h, refs: make(map[string]int32, len(h.Refs))}
+	for i, ref := range h.Refs {
+		b.refs[ref.Name] = int32(i)
+	}
+	if e := writeBamHeader(b.bw, h); e != nil {
+		return nil, e
+	}
+	// Start alignments in a fresh block, as samtools does.
+	if e := b.bw.Flush(); e != nil {
+		return nil, e
+	}
+	return b, nil
+}
+
+// The virtual offset at which the next record will be written.
+func (b *BamWriter) Tell() uint64 {
+	return b.bw.Tell()
+}
+
+func (b *BamWriter) refID(name string) (int32, error) {
+	if name == "*" || name == "" {
+		return -1, nil
+	}
+	id, ok := b.refs[name]
+	if !ok {
+		return 0, fmt.Errorf("BamWriter: reference %v not in header", name)
+	}
+	return id, nil
+}
+
+func (b *BamWriter) Write(s SamEntry) error {
+	if s.IsHeader {
+		return fmt.Errorf("BamWriter.Write: header lines must be passed to NewBamWriter")
+	}
+	buf, e := b.encode(b.buf[:0], s)
+	if e != nil {
+		return e
+	}
+	b.buf = buf
+	_, e = b.bw.Write(buf)
+	return e
+}
+
+func (b *BamWriter) encode(buf []byte, s SamEntry) ([]byte, error) {
+	le := binary.LittleEndian
+	refID, e := b.refID(s.Rname)
+	if e != nil {
+		return nil, e
+	}
+	nextRefID := refID
+	if s.Rnext != "=" {
+		if nextRefID, e = b.refID(s.Rnext); e != nil {
+			return nil, e
+		}
+	}
+
+	var cigar []CIGAREntry
+	if s.CIGAR != "*" && s.CIGAR != "" {
+		if cigar, e = ParseCIGAR(s.CIGAR); e != nil {
+			return nil, e
+		}
+	}
+	if len(cigar) > 0xffff {
+		return nil, fmt.Errorf("BamWriter: %v cigar operations is more than BAM can store", len(cigar))
+	}
+
+	seq := s.Seq
+	if seq == "*" {
+		seq = ""
+	}
+	if s.Qual != "*" && len(s.Qual) != len(seq) {
+		return nil, fmt.Errorf("BamWriter: len(qual) %v != len(seq) %v for read %v", len(s.Qual), len(seq), s.Qname)
+	}
+
+	pos := s.Pos - 1
+	end := pos + CIGARRefLen(cigar)
+	if end <= pos {
+		end = pos + 1
+	}
+	bin := Reg2Bin(pos, end, 14, 5)
+	if pos < 0 {
+		bin = 4680
+	}
+
+	buf = le.AppendUint32(buf, 0)
+	buf = le.AppendUint32(buf, uint32(refID))
+	buf = le.AppendUint32(buf, uint32(int32(pos)))
+	buf = append(buf, byte(len(s.Qname)+1), byte(s.Mapq))
+	buf = le.AppendUint16(buf, uint16(bin))
+	buf = le.AppendUint16(buf, uint16(len(cigar)))
+	buf = le.AppendUint16(buf, s.Flag)
+	buf = le.AppendUint32(buf, uint32(len(seq)))
+	buf = le.AppendUint32(buf, uint32(nextRefID))
+	buf = le.AppendUint32(buf, uint32(int32(s.Pnext-1)))
+	buf = le.AppendUint32(buf, uint32(int32(s.Tlen)))
+	buf = append(buf, s.Qname...)
+	buf = append(buf, 0)
+
+	for _, op := range cigar {
+		code := strings.IndexByte(bamCigarOps, op.Letter)
+		if code < 0 {
+			return nil, fmt.Errorf("BamWriter: bad cigar op %c", op.Letter)
+		}
+		buf = le.AppendUint32(buf, uint32(op.Count)<<4|uint32(code))
+	}
+
+	for i := 0; i < len(seq); i += 2 {
+		c := bamSeqIndex[seq[i]] << 4
+		if i+1 < len(seq) {
+			c |= bamSeqIndex[seq[i+1]]
+		}
+		buf = append(buf, c)
+	}
+	for i := 0; i < len(seq); i++ {
+		if s.Qual == "*" {
+			buf = append(buf, 0xff)
+		} else {
+			buf = append(buf, s.Qual[i]-33)
+		}
+	}
+
+	for _, o := range s.Optional {
+		if buf, e = appendBamAux(buf, o); e != nil {
+			return nil, e
+		}
+	}
+
+	le.PutUint32(buf, uint32(len(buf)-4))
+	return buf, nil
+}
+
+// The smallest BAM integer type that can hold all of vals.
+func bamIntType(vals ...int64) byte {
+	lo, hi := int64(0), int64(0)
+	for _, v := range vals {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	switch {
+	case lo >= 0 && hi <= math.MaxUint8:
+		return 'C'
+	case lo >= math.MinInt8 && hi <= math.MaxInt8:
+		return 'c'
+	case lo >= 0 && hi <= math.MaxUint16:
+		return 'S'
+	case lo >= math.MinInt16 && hi <= math.MaxInt16:
+		return 's'
+	case lo >= 0 && hi <= math.MaxUint32:
+		return 'I'
+	default:
+		return 'i'
+	}
+}
+
+func appendBamInt(buf []byte, t byte, v int64) []byte {
+	switch bamIntSize(t) {
+	case 1:
+		return append(buf, byte(v))
+	case 2:
+		return binary.LittleEndian.AppendUint16(buf, uint16(v))
+	default:
+		return binary.LittleEndian.AppendUint32(buf, uint32(v))
+	}
+}
+
+func appendBamAux(buf []byte, o SamOptional) ([]byte, error) {
+	le := binary.LittleEndian
+	buf = append(buf, o.Tag[0], o.Tag[1])
+	switch o.Type {
+	case 'A':
+		buf = append(buf, 'A', o.Char)
+	case 'i':
+		if o.Int < math.MinInt32 || o.Int > math.MaxUint32 {
+			return nil, fmt.Errorf("appendBamAux: tag %s value %v out of range", o.Tag[:], o.Int)
+		}
+		t := bamIntType(o.Int)
+		buf = appendBamInt(append(buf, t), t, o.Int)
+	case 'f':
+		buf = le.AppendUint32(append(buf, 'f'), math.Float32bits(float32(o.Float)))
+	case 'Z':
+		buf = append(append(buf, 'Z'), o.String...)
+		buf = append(buf, 0)
+	case 'H':
+		buf = append(buf, 'H')
+		buf = append(buf, strings.ToUpper(fmt.Sprintf("%x", o.ByteArray))...)
+		buf = append(buf, 0)
+	case 'B':
+		buf = append(buf, 'B', o.NumArrayType)
+		if o.NumArrayType == 'f' {
+			buf = le.AppendUint32(buf, uint32(len(o.FloatArray)))
+			for _, f := range o.FloatArray {
+				buf = le.AppendUint32(buf, math.Float32bits(float32(f)))
+			}
+		} else {
+			if bamIntSize(o.NumArrayType) == 0 {
+				return nil, fmt.Errorf("appendBamAux: tag %s: bad array type %c", o.Tag[:], o.NumArrayType)
+			}
+			buf = le.AppendUint32(buf, uint32(len(o.IntArray)))
+			for _, v := range o.IntArray {
+				buf = appendBamInt(buf, o.NumArrayType, v)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("appendBamAux: tag %s: invalid type %c", o.Tag[:], o.Type)
+	}
+	return buf, nil
+}
+
+// Finish the BGZF stream. The underlying writer is not closed.
+func (b *BamWriter) Close() error {
+	return b.bw.Close()
+}
+
+// Write a BAM file. Leading header entries in it make up the header text and
+// must include an @SQ line for every reference used.
+func WriteBam(w io.Writer, it iter.Seq2[SamEntry, error]) (err error) {
+	var text strings.Builder
+	var bw *BamWriter
+	start := func() error {
+		h, e := BamHeaderFromText(text.String())
+		if e != nil {
+			return e
+		}
+		bw, e = NewBamWriter(w, h)
+		return e
+	}
+
+	for s, e := range it {
+		if e != nil {
+			return e
+		}
+		if s.IsHeader && bw == nil {
+			fmt.Fprintf(&text, "@%v\n", s.Header)
+			continue
+		}
+		if bw == nil {
+			if e := start(); e != nil {
+				return e
+			}
+		}
+		if e := bw.Write(s); e != nil {
+			return e
+		}
+	}
+	if bw == nil {
+		if e := start(); e != nil {
+			return e
+		}
+	}
+	return bw.Close()
+}
@@ -0,0 +1,49 @@
+package fastats
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBamRoundTrip(t *testing.T) {
+	in := []SamEntry{
+		ParseSamHeading("@HD\tVN:1.6\tSO:coordinate"),
+		ParseSamHeading("@SQ\tSN:chr1\tLN:1000"),
+		ParseSamHeading("@SQ\tSN:chr2\tLN:500"),
+		SamEntry{
+			SamAlignment: SamAlignment{
+				Qname: "read1", Flag: 99, Rname: "chr1", Pos: 10, Mapq: 60, CIGAR: "3S5M1I2M2D4M",
+				Rnext: "=", Pnext: 200, Tlen: 300, Seq: "ACGTNACGTACGTAC", Qual: "IIIIIIIIIIIIII#",
+			},
+			Optional: []SamOptional{
+				SamOptional{Tag: [2]byte{'N', 'M'}, Type: 'i', Int: 3},
+				SamOptional{Tag: [2]byte{'X', 'N'}, Type: 'i', Int: -70000},
+				SamOptional{Tag: [2]byte{'X', 'A'}, Type: 'A', Char: 'q'},
+				SamOptional{Tag: [2]byte{'X', 'F'}, Type: 'f', Float: 0.5},
+				SamOptional{Tag: [2]byte{'R', 'G'}, Type: 'Z', String: "group1"},
+				SamOptional{Tag: [2]byte{'X', 'H'}, Type: 'H', ByteArray: []byte{0x1a, 0xe3}},
+				SamOptional{Tag: [2]byte{'X', 'B'}, Type: 'B', NumArrayType: 's', IntArray: []int64{-1, 2, 300}},
+				SamOptional{Tag: [2]byte{'X', 'G'}, Type: 'B', NumArrayType: 'f', FloatArray: []float64{1.5, -2}},
+			},
+		},
+		SamEntry{
+			SamAlignment: SamAlignment{
+				Qname: "read2", Flag: 4, Rname: "*", Pos: 0, Mapq: 0, CIGAR: "*",
+				Rnext: "*", Pnext: 0, Tlen: 0, Seq: "ACG", Qual: "*",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if e := WriteBam(&buf, SliceIter2(in)); e != nil {
+		t.Fatal(e)
+	}
+	got, e := CollectErr(ParseBam(&buf))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("got:\n%#v\n!= exp:\n%#v", got, in)
+	}
+}
@@ -0,0 +1,368 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+// Combine one column of merged BED fields, like bedtools merge -c -o.
+// Columns are 1-based BED columns, so 4 is the first field after end.
+// Ops are sum, mean, min, max, count, collapse, distinct and first.
+func MergeColumnOp(col int, op string) (func([][]string) (string, error), error) {
+	idx := col - 4
+	if idx < 0 {
+		return nil, fmt.Errorf("MergeColumnOp: column %v is not a field column", col)
+	}
+	numeric := func(rows [][]string) ([]float64, error) {
+		var out []float64
+		for _, r := range rows {
+			if idx >= len(r) {
+				continue
+			}
+			f, e := strconv.ParseFloat(r[idx], 64)
+			if e != nil {
+				return nil, fmt.Errorf("merge column %v: %w", col, e)
+			}
+			out = append(out, f)
+		}
+		return out, nil
+	}
+	strs := func(rows [][]string) []string {
+		var out []string
+		for _, r := range rows {
+			if idx < len(r) {
+				out = append(out, r[idx])
+			}
+		}
+		return out
+	}
+	fmtf := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+
+	switch op {
+	case "sum", "mean", "min", "max":
+		return func(rows [][]string) (string, error) {
+			fs, e := numeric(rows)
+			if e != nil || len(fs) == 0 {
+				return ".", e
+			}
+			switch op {
+			case "min":
+				return fmtf(slices.Min(fs)), nil
+			case "max":
+				return fmtf(slices.Max(fs)), nil
+			}
+			sum := 0.0
+			for _, f := range fs {
+				sum += f
+			}
+			if op == "mean" {
+				sum /= float64(len(fs))
+			}
+			return fmtf(sum), nil
+		}, nil
+	case "count":
+		return func(rows [][]string) (string, error) { return fmt.Sprint(len(strs(rows))), nil }, nil
+	case "collapse":
+		return func(rows [][]string) (string, error) { return strings.Join(strs(rows), ","), nil }, nil
+	case "distinct":
+		return func(rows [][]string) (string, error) {
+			var out []string
+			for _, s := range strs(rows) {
+				if !slices.Contains(out, s) {
+					out = append(out, s)
+				}
+			}
+			return strings.Join(out, ","), nil
+		}, nil
+	case "first":
+		return func(rows [][]string) (string, error) {
+			if s := strs(rows); len(s) > 0 {
+				return s[0], nil
+			}
+			return ".", nil
+		}, nil
+	}
+	return nil, fmt.Errorf("MergeColumnOp: unknown op %v", op)
+}
+
+func MergeColumnOps(cols []int, ops []string) (func([][]string) ([]string, error), error) {
+	if len(ops) == 1 && len(cols) > 1 {
+		for len(ops) < len(cols) {
+			ops = append(ops, ops[0])
+		}
+	}
+	if len(cols) != len(ops) {
+		return nil, fmt.Errorf("MergeColumnOps: len(cols) %v != len(ops) %v", len(cols), len(ops))
+	}
+	fs := make([]func([][]string) (string, error), 0, len(cols))
+	for i, c := range cols {
+		f, e := MergeColumnOp(c, ops[i])
+		if e != nil {
+			return nil, e
+		}
+		fs = append(fs, f)
+	}
+	return func(rows [][]string) ([]string, error) {
+		out := make([]string, 0, len(fs))
+		for _, f := range fs {
+			s, e := f(rows)
+			if e != nil {
+				return nil, e
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}, nil
+}
+
+func parseIntList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		i, e := strconv.Atoi(f)
+		if e != nil {
+			return nil, e
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+func openBedFlat(path string) (iter.Seq2[BedEntry[[]string], error], io.Closer, error) {
+	if path == "" || path == "-" {
+		return ParseBedFlat(os.Stdin), io.NopCloser(nil), nil
+	}
+	r, e := zfile.Open(path)
+	if e != nil {
+		return nil, nil, e
+	}
+	return ParseBedFlat(r), r, nil
+}
+
+func readBedTree(path string) (*IntervalTree[BedEntry[[]string]], error) {
+	it, c, e := openBedFlat(path)
+	if e != nil {
+		return nil, e
+	}
+	defer c.Close()
+	return CollectIntervalTree(it)
+}
+
+func writeFlatFields(w io.Writer, fields ...[]string) error {
+	for _, fs := range fields {
+		if e := writeTabbedSlice(w, fs); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+type IntervalsFlags struct {
+	A        string
+	B        string
+	Genome   string
+	WriteA   bool
+	WriteB   bool
+	Unique   bool
+	Invert   bool
+	Dist     int64
+	Cols     string
+	Ops      string
+	Distance bool
+}
+
+const intervalsUsage = `usage: intervals <command> [flags]
+
+commands:
+	intersect   overlaps between -a and -b
+	subtract    parts of -a not covered by -b
+	merge       merge overlapping, sorted intervals from -a (default stdin)
+	complement  parts of the -g genome not covered by -a
+	closest     nearest -b interval to each -a interval
+`
+
+func FullIntervals() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, intervalsUsage)
+		os.Exit(1)
+	}
+	cmd := os.Args[1]
+
+	var f IntervalsFlags
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&f.A, "a", "", "First BED file (default stdin)")
+	fs.StringVar(&f.B, "b", "", "Second BED file")
+	fs.StringVar(&f.Genome, "g", "", "Genome file of chromosome names and lengths (complement)")
+	fs.BoolVar(&f.WriteA, "wa", false, "Write the original -a entry instead of the overlapping part (intersect)")
+	fs.BoolVar(&f.WriteB, "wb", false, "Also write the overlapping -b entry (intersect)")
+	fs.BoolVar(&f.Unique, "u", false, "Write each -a entry with any overlap once (intersect)")
+	fs.BoolVar(&f.Invert, "v", false, "Write -a entries with no overlap (intersect)")
+	fs.Int64Var(&f.Dist, "d", 0, "Merge intervals this close together (merge)")
+	fs.StringVar(&f.Cols, "c", "", "Comma-separated 1-based columns to aggregate (merge)")
+	fs.StringVar(&f.Ops, "o", "", "Comma-separated aggregation per column: sum, mean, min, max, count, collapse, distinct, first (merge)")
+	fs.BoolVar(&f.Distance, "D", false, "Write the distance to the closest -b entry (closest)")
+	fs.Parse(os.Args[2:])
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	if e := runIntervals(w, cmd, f); e != nil {
+		log.Fatal(e)
+	}
+}
+
+func runIntervals(w io.Writer, cmd string, f IntervalsFlags) error {
+	a, ac, e := openBedFlat(f.A)
+	if e != nil {
+		return e
+	}
+	defer ac.Close()
+
+	var t *IntervalTree[BedEntry[[]string]]
+	switch cmd {
+	case "intersect", "subtract", "closest":
+		if f.B == "" {
+			return fmt.Errorf("%v: missing -b", cmd)
+		}
+		if t, e = readBedTree(f.B); e != nil {
+			return e
+		}
+	}
+
+	switch cmd {
+	case "intersect":
+		if f.Unique || f.Invert {
+			for x, e := range IntersectAny(a, t, f.Invert) {
+				if e != nil {
+					return e
+				}
+				if e := WriteBedEnterFlat(w, x); e != nil {
+					return e
+				}
+			}
+			return nil
+		}
+		for p, e := range Intersect(a, t) {
+			if e != nil {
+				return e
+			}
+			span, _ := ChrSpanOverlap(p.V1, p.V2)
+			if f.WriteA {
+				span = p.V1.ChrSpan
+			}
+			if e := WriteBedHeader(w, span); e != nil {
+				return e
+			}
+			if e := writeFlatFields(w, p.V1.Fields); e != nil {
+				return e
+			}
+			if f.WriteB {
+				if _, e := fmt.Fprintf(w, "\t%v\t%v\t%v", p.V2.Chr, p.V2.Start, p.V2.End); e != nil {
+					return e
+				}
+				if e := writeFlatFields(w, p.V2.Fields); e != nil {
+					return e
+				}
+			}
+			if _, e := fmt.Fprintln(w); e != nil {
+				return e
+			}
+		}
+	case "subtract":
+		for x, e := range Subtract(a, t) {
+			if e != nil {
+				return e
+			}
+			if e := WriteBedEnterFlat(w, x); e != nil {
+				return e
+			}
+		}
+	case "merge":
+		cols, e := parseIntList(f.Cols)
+		if e != nil {
+			return e
+		}
+		ops := []string{}
+		if f.Ops != "" {
+			ops = strings.Split(f.Ops, ",")
+		}
+		agg, e := MergeColumnOps(cols, ops)
+		if e != nil {
+			return e
+		}
+		for x, e := range MergeSorted(a, f.Dist, agg) {
+			if e != nil {
+				return e
+			}
+			if e := WriteBedEnterFlat(w, x); e != nil {
+				return e
+			}
+		}
+	case "complement":
+		if f.Genome == "" {
+			return fmt.Errorf("complement: missing -g")
+		}
+		genome, e := ReadGenomeFilePath(f.Genome)
+		if e != nil {
+			return e
+		}
+		for x, e := range Complement(a, genome) {
+			if e != nil {
+				return e
+			}
+			if _, e := fmt.Fprintf(w, "%v\t%v\t%v\n", x.Chr, x.Start, x.End); e != nil {
+				return e
+			}
+		}
+	case "closest":
+		for hit, e := range Closest(a, t) {
+			if e != nil {
+				return e
+			}
+			bs := hit.B
+			if len(bs) == 0 {
+				bs = []BedEntry[[]string]{{ChrSpan: ChrSpan{".", Span{-1, -1}}}}
+			}
+			for _, b := range bs {
+				if e := WriteBedHeader(w, hit.A); e != nil {
+					return e
+				}
+				if e := writeFlatFields(w, hit.A.Fields); e != nil {
+					return e
+				}
+				if _, e := fmt.Fprintf(w, "\t%v\t%v\t%v", b.Chr, b.Start, b.End); e != nil {
+					return e
+				}
+				if e := writeFlatFields(w, b.Fields); e != nil {
+					return e
+				}
+				if f.Distance {
+					if _, e := fmt.Fprintf(w, "\t%v", hit.Distance); e != nil {
+						return e
+					}
+				}
+				if _, e := fmt.Fprintln(w); e != nil {
+					return e
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unknown command %v\n%v", cmd, intervalsUsage)
+	}
+	return nil
+}
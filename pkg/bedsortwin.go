@@ -77,9 +77,7 @@ func WindowSortedBed[B ChrSpanner](it iter.Seq2[B, error], winsize, winstep int)
 			for ShouldUpdateWin(win, cs) {
 				// log.Printf("need to update win %v; v: %v\n", win, v)
 				if ShouldFinishWin(win, cs) {
-					log.Printf("should finish win; win %v; v %v\n", win, v)
 					CheckAndPopMulti(win, &d)
-					log.Printf("finished popping; d.Len() %v\n", d.Len())
 					out.ChrSpan = win
 					out.Fields = d.AppendToSlice(out.Fields[:0])
 					// out.Fields = AppendDequeBedFields(out.Fields[:0], &d)
@@ -143,8 +141,17 @@ func MeanBedPerBp[B BedEnter[float64]](bed []B) float64 {
 }
 
 func MeanWindowCounts[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+	return meanWindowCounts(WindowSortedBed(it, winsize, winstep))
+}
+
+// Like MeanWindowCounts, but over every window of the genome; empty windows
+// are NaN.
+func MeanWindowCountsGenome[B BedEnter[float64]](it iter.Seq2[B, error], genome []FaLen, winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+	return meanWindowCounts(WindowSortedBedGenome(it, genome, winsize, winstep))
+}
+
+func meanWindowCounts[B BedEnter[float64]](wins iter.Seq2[BedEntry[[]B], error]) iter.Seq2[BedEntry[float64], error] {
 	return func(yield func(BedEntry[float64], error) bool) {
-		wins := WindowSortedBed(it, winsize, winstep)
 		wins(func(win BedEntry[[]B], err error) bool {
 			ok := yield(BedEntry[float64]{win.ChrSpan, MeanBedPerBp(win.Fields)}, err)
 			return ok && err == nil
@@ -215,6 +222,7 @@ type BedSortWinFlags struct {
 	Sorted  bool
 	Winsize int
 	Winstep int
+	Genome  string
 }
 
 func WriteFloatBedEntry[B BedEnter[float64]](w io.Writer, b B) (n int, err error) {
@@ -289,6 +297,13 @@ func BedSortWin(r io.Reader, w io.Writer, f BedSortWinFlags) error {
 
 	// log.Print("starting meanwindowcounts")
 	wins := MeanWindowCounts(it, f.Winsize, f.Winstep)
+	if f.Genome != "" {
+		genome, e := ReadGenomeFilePath(f.Genome)
+		if e != nil {
+			return e
+		}
+		wins = MeanWindowCountsGenome(it, genome, f.Winsize, f.Winstep)
+	}
 	if _, e := WriteFloatBed(w, wins); e != nil {
 		return e
 	}
@@ -300,6 +315,7 @@ func RunBedSortWin() {
 	flag.BoolVar(&f.Sorted, "sorted", false, "bed input already sorted")
 	flag.IntVar(&f.Winsize, "size", 1, "Window size")
 	flag.IntVar(&f.Winstep, "step", 1, "Window step")
+	flag.StringVar(&f.Genome, "g", "", "Genome file of chromosome lengths; output every window, clamped to chromosome ends")
 	flag.Parse()
 
 	stdin := bufio.NewReader(os.Stdin)
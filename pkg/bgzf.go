@@ -0,0 +1,295 @@
+package fastats
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Largest amount of uncompressed data placed in one BGZF block, as in htslib.
+const BgzfBlockSize = 0xff00
+
+var ErrBgzfFormat = errors.New("bgzf format error")
+
+var bgzfEOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00,
+	0x42, 0x43, 0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+}
+
+// A virtual file offset: the compressed offset of a block in the upper 48
+// bits and the offset into its uncompressed data in the lower 16.
+func VirtualOffset(blockAddr int64, within int) uint64 {
+	return uint64(blockAddr)<<16 | uint64(within)
+}
+
+func SplitVirtualOffset(voff uint64) (blockAddr int64, within int) {
+	return int64(voff >> 16), int(voff & 0xffff)
+}
+
+type BgzfReader struct {
+	r         io.Reader
+	br        *bufio.Reader
+	blockAddr int64
+	nextAddr  int64
+	block     []byte
+	pos       int
+	cdata     []byte
+	fr        io.ReadCloser
+}
+
+func NewBgzfReader(r io.Reader) *BgzfReader {
+	return &BgzfReader{r: r, br: bufio.NewReader(r)}
+}
+
+func (b *BgzfReader) readBlock() error {
+	var head [12]byte
+	if _, e := io.ReadFull(b.br, head[:]); e != nil {
+		if e == io.ErrUnexpectedEOF {
+			return fmt.Errorf("BgzfReader: %w: truncated block header", ErrBgzfFormat)
+		}
+		return e
+	}
+	if head[0] != 31 || head[1] != 139 || head[2] != 8 || head[3]&4 == 0 {
+		return fmt.Errorf("BgzfReader: %w: bad block header at offset %v", ErrBgzfFormat, b.nextAddr)
+	}
+
+	xlen := int(binary.LittleEndian.Uint16(head[10:]))
+	extra := make([]byte, xlen)
+	if _, e := io.ReadFull(b.br, extra); e != nil {
+		return fmt.Errorf("BgzfReader: %w", e)
+	}
+	bsize := -1
+	for i := 0; i+4 <= len(extra); {
+		slen := int(binary.LittleEndian.Uint16(extra[i+2:]))
+		if extra[i] == 'B' && extra[i+1] == 'C' && slen == 2 && i+6 <= len(extra) {
+			bsize = int(binary.LittleEndian.Uint16(extra[i+4:])) + 1
+		}
+		i += 4 + slen
+	}
+	if bsize < 0 {
+		return fmt.Errorf("BgzfReader: %w: no BC field in block at offset %v", ErrBgzfFormat, b.nextAddr)
+	}
+
+	clen := bsize - 12 - xlen - 8
+	if clen < 0 {
+		return fmt.Errorf("BgzfReader: %w: block size %v too small", ErrBgzfFormat, bsize)
+	}
+	b.cdata = GrowLen(b.cdata[:0], clen+8)
+	if _, e := io.ReadFull(b.br, b.cdata); e != nil {
+		return fmt.Errorf("BgzfReader: %w", e)
+	}
+	crc := binary.LittleEndian.Uint32(b.cdata[clen:])
+	isize := int(binary.LittleEndian.Uint32(b.cdata[clen+4:]))
+
+	if b.fr == nil {
+		b.fr = flate.NewReader(bytes.NewReader(b.cdata[:clen]))
+	} else if e := b.fr.(flate.Resetter).Reset(bytes.NewReader(b.cdata[:clen]), nil); e != nil {
+		return e
+	}
+	b.block = GrowLen(b.block[:0], isize)
+	if _, e := io.ReadFull(b.fr, b.block); e != nil {
+		return fmt.Errorf("BgzfReader: %w", e)
+	}
+	if crc32.ChecksumIEEE(b.block) != crc {
+		return fmt.Errorf("BgzfReader: %w: crc mismatch in block at offset %v", ErrBgzfFormat, b.nextAddr)
+	}
+
+	b.blockAddr = b.nextAddr
+	b.nextAddr += int64(bsize)
+	b.pos = 0
+	return nil
+}
+
+// Make sure that unread data is available, skipping empty blocks.
+func (b *BgzfReader) fill() error {
+	for b.pos >= len(b.block) {
+		if e := b.readBlock(); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (b *BgzfReader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if e := b.fill(); e != nil {
+		return 0, e
+	}
+	n = copy(p, b.block[b.pos:])
+	b.pos += n
+	return n, nil
+}
+
+func (b *BgzfReader) ReadByte() (byte, error) {
+	if e := b.fill(); e != nil {
+		return 0, e
+	}
+	c := b.block[b.pos]
+	b.pos++
+	return c, nil
+}
+
+// Read the next line into buf, without its trailing newline.
+func (b *BgzfReader) ReadLine(buf []byte) ([]byte, error) {
+	buf = buf[:0]
+	for {
+		if e := b.fill(); e != nil {
+			if e == io.EOF && len(buf) > 0 {
+				return buf, nil
+			}
+			return buf, e
+		}
+		rest := b.block[b.pos:]
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			buf = append(buf, rest[:i]...)
+			b.pos += i + 1
+			return bytes.TrimSuffix(buf, []byte{'\r'}), nil
+		}
+		buf = append(buf, rest...)
+		b.pos = len(b.block)
+	}
+}
+
+func (b *BgzfReader) Tell() uint64 {
+	if b.pos >= len(b.block) {
+		return VirtualOffset(b.nextAddr, 0)
+	}
+	return VirtualOffset(b.blockAddr, b.pos)
+}
+
+// Seek to a virtual offset. The underlying reader must be an io.Seeker.
+func (b *BgzfReader) Seek(voff uint64) error {
+	addr, within := SplitVirtualOffset(voff)
+	if addr != b.blockAddr || len(b.block) == 0 {
+		s, ok := b.r.(io.Seeker)
+		if !ok {
+			return fmt.Errorf("BgzfReader.Seek: underlying reader is not seekable")
+		}
+		if _, e := s.Seek(addr, io.SeekStart); e != nil {
+			return e
+		}
+		b.br.Reset(b.r)
+		b.nextAddr = addr
+		b.block = b.block[:0]
+		b.pos = 0
+		if e := b.readBlock(); e != nil && e != io.EOF {
+			return e
+		}
+	}
+	if within > len(b.block) {
+		return fmt.Errorf("BgzfReader.Seek: offset %v past end of block of length %v", within, len(b.block))
+	}
+	b.pos = within
+	return nil
+}
+
+type BgzfWriter struct {
+	w     io.Writer
+	buf   []byte
+	addr  int64
+	level int
+	fw    *flate.Writer
+	cbuf  bytes.Buffer
+}
+
+func NewBgzfWriter(w io.Writer) *BgzfWriter {
+	return NewBgzfWriterLevel(w, flate.DefaultCompression)
+}
+
+func NewBgzfWriterLevel(w io.Writer, level int) *BgzfWriter {
+	return &BgzfWriter{w: w, buf: make([]byte, 0, BgzfBlockSize), level: level}
+}
+
+func (b *BgzfWriter) compress(level int) error {
+	b.cbuf.Reset()
+	fw := b.fw
+	if level != b.level || fw == nil {
+		var e error
+		if fw, e = flate.NewWriter(&b.cbuf, level); e != nil {
+			return e
+		}
+		if level == b.level {
+			b.fw = fw
+		}
+	} else {
+		fw.Reset(&b.cbuf)
+	}
+	if _, e := fw.Write(b.buf); e != nil {
+		return e
+	}
+	return fw.Close()
+}
+
+// Write any buffered data as a complete block.
+func (b *BgzfWriter) Flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	if e := b.compress(b.level); e != nil {
+		return e
+	}
+	if b.cbuf.Len()+26 > 1<<16 {
+		if e := b.compress(flate.NoCompression); e != nil {
+			return e
+		}
+	}
+
+	bsize := b.cbuf.Len() + 26
+	var head [18]byte
+	copy(head[:], []byte{31, 139, 8, 4, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0})
+	binary.LittleEndian.PutUint16(head[16:], uint16(bsize-1))
+	var tail [8]byte
+	binary.LittleEndian.PutUint32(tail[:], crc32.ChecksumIEEE(b.buf))
+	binary.LittleEndian.PutUint32(tail[4:], uint32(len(b.buf)))
+
+	for _, part := range [][]byte{head[:], b.cbuf.Bytes(), tail[:]} {
+		if _, e := b.w.Write(part); e != nil {
+			return e
+		}
+	}
+	b.addr += int64(bsize)
+	b.buf = b.buf[:0]
+	return nil
+}
+
+func (b *BgzfWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		m := copy(b.buf[len(b.buf):cap(b.buf)], p)
+		b.buf = b.buf[:len(b.buf)+m]
+		p = p[m:]
+		n += m
+		if len(b.buf) == cap(b.buf) {
+			if e := b.Flush(); e != nil {
+				return n, e
+			}
+		}
+	}
+	return n, nil
+}
+
+func (b *BgzfWriter) WriteString(s string) (n int, err error) {
+	return b.Write([]byte(s))
+}
+
+func (b *BgzfWriter) Tell() uint64 {
+	return VirtualOffset(b.addr, len(b.buf))
+}
+
+// Flush the remaining data and write the BGZF end-of-file marker. The
+// underlying writer is not closed.
+func (b *BgzfWriter) Close() error {
+	if e := b.Flush(); e != nil {
+		return e
+	}
+	_, e := b.w.Write(bgzfEOF)
+	b.addr += int64(len(bgzfEOF))
+	return e
+}
@@ -0,0 +1,209 @@
+package fastats
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+)
+
+func (c CIGAREntry) ConsumesRef() bool {
+	switch c.Letter {
+	case 'M', 'D', 'N', '=', 'X':
+		return true
+	}
+	return false
+}
+
+func (c CIGAREntry) ConsumesQuery() bool {
+	switch c.Letter {
+	case 'M', 'I', 'S', '=', 'X':
+		return true
+	}
+	return false
+}
+
+// Number of reference bases covered by the alignment.
+func CIGARRefLen(ops []CIGAREntry) int64 {
+	var n int64
+	for _, op := range ops {
+		if op.ConsumesRef() {
+			n += op.Count
+		}
+	}
+	return n
+}
+
+// Length of SEQ implied by the CIGAR, including soft clips.
+func CIGARQueryLen(ops []CIGAREntry) int64 {
+	var n int64
+	for _, op := range ops {
+		if op.ConsumesQuery() {
+			n += op.Count
+		}
+	}
+	return n
+}
+
+func cigarClips(ops []CIGAREntry, letter byte) (left, right int64) {
+	for _, op := range ops {
+		if op.Letter == letter {
+			left += op.Count
+		} else if op.Letter != 'H' && op.Letter != 'S' {
+			break
+		}
+	}
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].Letter == letter {
+			right += ops[i].Count
+		} else if ops[i].Letter != 'H' && ops[i].Letter != 'S' {
+			break
+		}
+	}
+	return left, right
+}
+
+func CIGARSoftClips(ops []CIGAREntry) (left, right int64) {
+	return cigarClips(ops, 'S')
+}
+
+func CIGARHardClips(ops []CIGAREntry) (left, right int64) {
+	return cigarClips(ops, 'H')
+}
+
+type CIGARStep struct {
+	RefPos   int64
+	QueryPos int64
+	Op       byte
+}
+
+// Walk an alignment one base at a time, starting at 0-based reference
+// position refStart. Insertions and soft clips report the reference position
+// of the next aligned base, and deletions and skips report the query position
+// of the next query base. Hard clips and padding yield nothing.
+func CIGARWalk(ops []CIGAREntry, refStart int64) iter.Seq[CIGARStep] {
+	return func(yield func(CIGARStep) bool) {
+		r, q := refStart, int64(0)
+		for _, op := range ops {
+			for i := int64(0); i < op.Count; i++ {
+				if op.Letter == 'H' || op.Letter == 'P' {
+					break
+				}
+				if !yield(CIGARStep{RefPos: r, QueryPos: q, Op: op.Letter}) {
+					return
+				}
+				if op.ConsumesRef() {
+					r++
+				}
+				if op.ConsumesQuery() {
+					q++
+				}
+			}
+		}
+	}
+}
+
+func (a SamAlignment) CIGAROps() ([]CIGAREntry, error) {
+	if a.CIGAR == "*" {
+		return nil, nil
+	}
+	return ParseCIGAR(a.CIGAR)
+}
+
+// The 0-based, half-open reference span of the alignment.
+func (a SamAlignment) RefSpan() (ChrSpan, error) {
+	ops, e := a.CIGAROps()
+	if e != nil {
+		return ChrSpan{}, e
+	}
+	return ChrSpan{Chr: a.Rname, Span: Span{Start: a.Pos - 1, End: a.Pos - 1 + CIGARRefLen(ops)}}, nil
+}
+
+func (a SamAlignment) SpanChr() string  { return a.Rname }
+func (a SamAlignment) SpanStart() int64 { return a.Pos - 1 }
+
+// The end of the alignment computed from its CIGAR. Alignments with an
+// unparseable CIGAR are treated as covering no reference bases.
+func (a SamAlignment) SpanEnd() int64 {
+	s, e := a.RefSpan()
+	if e != nil {
+		return a.SpanStart()
+	}
+	return s.End
+}
+
+type AlignmentDiff struct {
+	Matches         int64
+	Mismatches      int64
+	InsertedBases   int64
+	DeletedBases    int64
+	Insertions      int64
+	Deletions       int64
+	SoftClipped     int64
+	SkippedRefBases int64
+}
+
+func upperBase(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// Count matches, mismatches and indels between an alignment and the reference
+// sequence it was aligned to. Bases are compared case-insensitively.
+func CompareAlignment[F FaEnter](a SamAlignment, ref F) (AlignmentDiff, error) {
+	var d AlignmentDiff
+	ops, e := a.CIGAROps()
+	if e != nil {
+		return d, e
+	}
+	if a.Seq == "*" {
+		return d, fmt.Errorf("CompareAlignment: read %v has no sequence", a.Qname)
+	}
+	if ql := CIGARQueryLen(ops); ql != int64(len(a.Seq)) {
+		return d, fmt.Errorf("CompareAlignment: read %v: CIGAR query length %v != len(seq) %v", a.Qname, ql, len(a.Seq))
+	}
+	refSeq := ref.FaSeq()
+	if end := a.Pos - 1 + CIGARRefLen(ops); a.Pos < 1 || end > int64(len(refSeq)) {
+		return d, fmt.Errorf("CompareAlignment: read %v: alignment %v-%v outside reference of length %v", a.Qname, a.Pos-1, end, len(refSeq))
+	}
+
+	for _, op := range ops {
+		switch op.Letter {
+		case 'I':
+			d.Insertions++
+		case 'D':
+			d.Deletions++
+		}
+	}
+	for step := range CIGARWalk(ops, a.Pos-1) {
+		switch step.Op {
+		case 'M', '=', 'X':
+			if upperBase(a.Seq[step.QueryPos]) == upperBase(refSeq[step.RefPos]) {
+				d.Matches++
+			} else {
+				d.Mismatches++
+			}
+		case 'I':
+			d.InsertedBases++
+		case 'D':
+			d.DeletedBases++
+		case 'S':
+			d.SoftClipped++
+		case 'N':
+			d.SkippedRefBases++
+		}
+	}
+	return d, nil
+}
+
+func CIGARString(ops []CIGAREntry) string {
+	if len(ops) == 0 {
+		return "*"
+	}
+	var b strings.Builder
+	for _, op := range ops {
+		fmt.Fprintf(&b, "%d%c", op.Count, op.Letter)
+	}
+	return b.String()
+}
@@ -22,3 +22,46 @@ func TestParseCIGAR(t *testing.T) {
 		t.Errorf("got %v != exp %v", got, exp)
 	}
 }
+
+func TestCIGARLens(t *testing.T) {
+	ops, e := ParseCIGAR("2H3S5M1I2M2D4M10N1M2S")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if l := CIGARRefLen(ops); l != 24 {
+		t.Errorf("CIGARRefLen %v != 24", l)
+	}
+	if l := CIGARQueryLen(ops); l != 18 {
+		t.Errorf("CIGARQueryLen %v != 18", l)
+	}
+	if l, r := CIGARSoftClips(ops); l != 3 || r != 2 {
+		t.Errorf("CIGARSoftClips %v, %v != 3, 2", l, r)
+	}
+	if l, r := CIGARHardClips(ops); l != 2 || r != 0 {
+		t.Errorf("CIGARHardClips %v, %v != 2, 0", l, r)
+	}
+	if s := CIGARString(ops); s != "2H3S5M1I2M2D4M10N1M2S" {
+		t.Errorf("CIGARString %v", s)
+	}
+}
+
+func TestCompareAlignment(t *testing.T) {
+	ref := FaEntry{Header: "chr1", Seq: "AAACCCGGGTTTACGT"}
+	a := SamAlignment{Qname: "r", Rname: "chr1", Pos: 3, CIGAR: "1S3M2I2M1D3M", Seq: "TACCTTCGGTA"}
+	span, e := a.RefSpan()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if span != (ChrSpan{"chr1", Span{2, 11}}) || a.SpanEnd() != 11 {
+		t.Errorf("RefSpan %v", span)
+	}
+
+	d, e := CompareAlignment(a, ref)
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := AlignmentDiff{Matches: 7, Mismatches: 1, InsertedBases: 2, DeletedBases: 1, Insertions: 1, Deletions: 1, SoftClipped: 1}
+	if d != exp {
+		t.Errorf("got %+v != exp %+v", d, exp)
+	}
+}
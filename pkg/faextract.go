@@ -3,6 +3,9 @@ package fastats
 import (
 	"fmt"
 	"iter"
+	"slices"
+
+	"github.com/jgbaldwinbrown/zfile"
 )
 
 func CollectChrSpannerMap[C ChrSpanner](cit iter.Seq2[C, error]) (map[string][]C, error) {
@@ -27,6 +30,32 @@ func CollectChrSpanMap[C ChrSpanner](cit iter.Seq2[C, error]) (map[string][]Span
 	return m, nil
 }
 
+// A span on one strand, such as a GFF feature.
+type Strander interface {
+	SpanStrand() byte
+}
+
+// The strand of c, or '.' if it has none.
+func SpanStrand(c ChrSpanner) byte {
+	if s, ok := c.(Strander); ok {
+		return s.SpanStrand()
+	}
+	return '.'
+}
+
+// Reverse complement f if strand is '-', marking its header with the strand.
+func StrandFa(f FaEntry, strand byte) FaEntry {
+	if strand != '-' {
+		return f
+	}
+	return FaEntry{f.Header + "(-)", ReverseComplement(f.Seq)}
+}
+
+type strandedSpan struct {
+	Span
+	strand byte
+}
+
 func ExtractOne(f FaEntry, s Span) (FaEntry, error) {
 	if s.Start < 0 || s.Start >= int64(len(f.Seq)) {
 		return FaEntry{}, fmt.Errorf("ExtractOne: s.Start %v out of range of len(f.Seq) %v", s.Start, len(f.Seq))
@@ -40,27 +69,120 @@ func ExtractOne(f FaEntry, s Span) (FaEntry, error) {
 	}, nil
 }
 
-func ExtractFasta[F FaEnter, C ChrSpanner](fit iter.Seq2[F, error], cit iter.Seq2[C, error]) iter.Seq2[FaEntry, error] {
-	return func(yield func(FaEntry, error) bool) {
-		m, e := CollectChrSpanMap(cit)
+// Group spans by chromosome, in input order, yielding any errors from cit.
+// Returns false if yield does.
+func strandedSpanMap[C ChrSpanner](cit iter.Seq2[C, error], yield func(FaEntry, error) bool) (map[string][]strandedSpan, bool) {
+	m := map[string][]strandedSpan{}
+	for c, e := range cit {
 		if e != nil {
 			if !yield(FaEntry{}, e) {
-				return
+				return nil, false
 			}
+			continue
+		}
+		m[c.SpanChr()] = append(m[c.SpanChr()], strandedSpan{ToSpan(c), SpanStrand(c)})
+	}
+	return m, true
+}
+
+// An error naming the chromosomes of m that are not in seen, or nil.
+func missingSpanChrs(fname string, m map[string][]strandedSpan, seen map[string]bool) error {
+	var missing []string
+	for chr := range m {
+		if !seen[chr] {
+			missing = append(missing, chr)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	slices.Sort(missing)
+	return fmt.Errorf("%v: chromosomes %v not in fasta", fname, missing)
+}
+
+// Extract each span from the fasta. Spans on the minus strand, those that
+// implement Strander, are reverse complemented. Chromosomes are matched by
+// fai name, the first word of the header, and spans come in fasta order.
+// Spans on chromosomes missing from the fasta give an error at the end.
+func ExtractFasta[F FaEnter, C ChrSpanner](fit iter.Seq2[F, error], cit iter.Seq2[C, error]) iter.Seq2[FaEntry, error] {
+	return func(yield func(FaEntry, error) bool) {
+		m, ok := strandedSpanMap(cit, yield)
+		if !ok {
+			return
 		}
+		seen := map[string]bool{}
 		for f, err := range fit {
 			if err != nil {
-				if !yield(FaEntry{}, e) {
+				yield(FaEntry{}, err)
+				return
+			}
+			name := FaiName(f.FaHeader())
+			seen[name] = true
+			fa := FaEntry{Header: name, Seq: f.FaSeq()}
+			for _, span := range m[name] {
+				out, e := ExtractOne(fa, span.Span)
+				if !yield(StrandFa(out, span.strand), e) {
 					return
 				}
 			}
-			spans := m[f.FaHeader()]
-			for _, span := range spans {
-				out, e := ExtractOne(toFaEntry(f), span)
-				if !yield(out, e) {
+		}
+		if e := missingSpanChrs("ExtractFasta", m, seen); e != nil {
+			yield(FaEntry{}, e)
+		}
+	}
+}
+
+// Like ExtractFasta, but seeking to each span through the index.
+func ExtractFastaIndexed[C ChrSpanner](fr *FastaIndexedReader, cit iter.Seq2[C, error]) iter.Seq2[FaEntry, error] {
+	return func(yield func(FaEntry, error) bool) {
+		m, ok := strandedSpanMap(cit, yield)
+		if !ok {
+			return
+		}
+		seen := map[string]bool{}
+		for _, f := range fr.Index {
+			seen[f.Name] = true
+			for _, span := range m[f.Name] {
+				if span.Start < 0 || span.Start >= f.Len || span.End < 0 || span.End > f.Len {
+					if !yield(FaEntry{}, fmt.Errorf("ExtractFastaIndexed: span %v out of range of chr %v length %v", span.Span, f.Name, f.Len)) {
+						return
+					}
+					continue
+				}
+				seq, e := fr.Fetch(f.Name, span.Span)
+				out := FaEntry{Header: fmt.Sprintf("%v:%v-%v", f.Name, span.Start, span.End), Seq: seq}
+				if !yield(StrandFa(out, span.strand), e) {
 					return
 				}
 			}
 		}
+		if e := missingSpanChrs("ExtractFastaIndexed", m, seen); e != nil {
+			yield(FaEntry{}, e)
+		}
+	}
+}
+
+// Extract spans from the fasta at path, seeking through its .fai index if one
+// exists and streaming the whole file otherwise. Both give the same output.
+func ExtractFastaPath[C ChrSpanner](path string, cit iter.Seq2[C, error]) iter.Seq2[FaEntry, error] {
+	return func(yield func(FaEntry, error) bool) {
+		if HasFai(path) {
+			fa, e := OpenFastaIndexed(path, false)
+			if e != nil {
+				yield(FaEntry{}, e)
+				return
+			}
+			defer fa.Close()
+			ExtractFastaIndexed(fa.FastaIndexedReader, cit)(yield)
+			return
+		}
+
+		r, e := zfile.Open(path)
+		if e != nil {
+			yield(FaEntry{}, e)
+			return
+		}
+		defer r.Close()
+		ExtractFasta(ParseFasta(r), cit)(yield)
 	}
 }
@@ -0,0 +1,407 @@
+package fastats
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// One line of a samtools-compatible .fai index.
+type FaiEntry struct {
+	Name      string
+	Len       int64
+	Offset    int64
+	LineBases int64
+	LineWidth int64
+}
+
+func (f FaiEntry) SpanChr() string  { return f.Name }
+func (f FaiEntry) SpanStart() int64 { return 0 }
+func (f FaiEntry) SpanEnd() int64   { return f.Len }
+
+var ErrFaiFormat = errors.New("fasta not indexable")
+
+func FaiName(header string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(header), " ")
+	name, _, _ = strings.Cut(name, "\t")
+	return name
+}
+
+func BuildFai(r io.Reader) ([]FaiEntry, error) {
+	br := bufio.NewReader(r)
+	var out []FaiEntry
+	var cur *FaiEntry
+	var offset int64
+	shortLine := false
+
+	for {
+		line, e := br.ReadString('\n')
+		if e != nil && e != io.EOF {
+			return nil, e
+		}
+		if len(line) == 0 && e == io.EOF {
+			break
+		}
+		width := int64(len(line))
+		bases := int64(len(strings.TrimRight(line, "\r\n")))
+
+		if line[0] == '>' {
+			out = append(out, FaiEntry{Name: FaiName(line[1:]), Offset: offset + width})
+			cur = &out[len(out)-1]
+			shortLine = false
+		} else if cur == nil {
+			if bases > 0 {
+				return nil, fmt.Errorf("BuildFai: %w: sequence before first header at offset %v", ErrFaiFormat, offset)
+			}
+		} else if bases == 0 {
+			shortLine = true
+		} else {
+			if cur.LineBases == 0 {
+				cur.LineBases = bases
+				cur.LineWidth = width
+			} else if shortLine || bases > cur.LineBases || (bases == cur.LineBases && width != cur.LineWidth) {
+				return nil, fmt.Errorf("BuildFai: %w: different line length in sequence %v", ErrFaiFormat, cur.Name)
+			}
+			if bases < cur.LineBases {
+				shortLine = true
+			}
+			cur.Len += bases
+		}
+
+		offset += width
+		if e == io.EOF {
+			break
+		}
+	}
+	return out, nil
+}
+
+func BuildFaiPath(path string) (out []FaiEntry, err error) {
+	r, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer func() {
+		e := r.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	return BuildFai(r)
+}
+
+func ParseFaiEntry(line []string) (FaiEntry, error) {
+	var f FaiEntry
+	if len(line) < 5 {
+		return f, fmt.Errorf("ParseFaiEntry: len(line) %v < 5", len(line))
+	}
+	f.Name = line[0]
+	var e error
+	if f.Len, e = strconv.ParseInt(line[1], 0, 64); e != nil {
+		return f, e
+	}
+	if f.Offset, e = strconv.ParseInt(line[2], 0, 64); e != nil {
+		return f, e
+	}
+	if f.LineBases, e = strconv.ParseInt(line[3], 0, 64); e != nil {
+		return f, e
+	}
+	if f.LineWidth, e = strconv.ParseInt(line[4], 0, 64); e != nil {
+		return f, e
+	}
+	return f, nil
+}
+
+func ParseFai(r io.Reader) iter.Seq2[FaiEntry, error] {
+	return func(yield func(FaiEntry, error) bool) {
+		cr := csv.NewReader(r)
+		cr.LazyQuotes = true
+		cr.Comma = rune('\t')
+		cr.ReuseRecord = true
+		cr.FieldsPerRecord = -1
+
+		for l, e := cr.Read(); e != io.EOF; l, e = cr.Read() {
+			if e != nil {
+				yield(FaiEntry{}, e)
+				return
+			}
+			f, e := ParseFaiEntry(l)
+			ok := yield(f, e)
+			if e != nil || !ok {
+				return
+			}
+		}
+	}
+}
+
+func WriteFai(w io.Writer, fs ...FaiEntry) error {
+	for _, f := range fs {
+		if _, e := fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", f.Name, f.Len, f.Offset, f.LineBases, f.LineWidth); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func WriteFaiPath(path string, fs ...FaiEntry) (err error) {
+	w, e := os.Create(path)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := w.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	bw := bufio.NewWriter(w)
+	if e := WriteFai(bw, fs...); e != nil {
+		return e
+	}
+	return bw.Flush()
+}
+
+func FaiPath(fapath string) string {
+	return fapath + ".fai"
+}
+
+func HasFai(fapath string) bool {
+	_, e := os.Stat(FaiPath(fapath))
+	return e == nil
+}
+
+// Parse a samtools-style region ("chr", "chr:start" or "chr:start-end",
+// 1-based and inclusive) into a 0-based half-open ChrSpan. An End of -1 means
+// the end of the sequence.
+func ParseRegion(region string) (ChrSpan, error) {
+	c := ChrSpan{Chr: region, Span: Span{Start: 0, End: -1}}
+	i := strings.LastIndexByte(region, ':')
+	if i < 0 {
+		return c, nil
+	}
+	startStr, endStr, hasEnd := strings.Cut(region[i+1:], "-")
+	start, e := strconv.ParseInt(strings.ReplaceAll(startStr, ",", ""), 10, 64)
+	if e != nil {
+		// The colon is part of the sequence name
+		return c, nil
+	}
+	c.Chr = region[:i]
+	c.Start = start - 1
+	if hasEnd {
+		if c.End, e = strconv.ParseInt(strings.ReplaceAll(endStr, ",", ""), 10, 64); e != nil {
+			return c, fmt.Errorf("ParseRegion: region %v: %w", region, e)
+		}
+	}
+	if c.Start < 0 || (c.End >= 0 && c.End < c.Start) {
+		return c, fmt.Errorf("ParseRegion: invalid region %v", region)
+	}
+	return c, nil
+}
+
+type FastaIndexedReader struct {
+	r     io.ReaderAt
+	Index []FaiEntry
+	names map[string]int
+}
+
+func NewFastaIndexedReader(r io.ReaderAt, index []FaiEntry) *FastaIndexedReader {
+	fr := &FastaIndexedReader{r: r, Index: index, names: make(map[string]int, len(index))}
+	for i, f := range index {
+		fr.names[f.Name] = i
+	}
+	return fr
+}
+
+func (fr *FastaIndexedReader) Entry(chr string) (FaiEntry, bool) {
+	i, ok := fr.names[chr]
+	if !ok {
+		return FaiEntry{}, false
+	}
+	return fr.Index[i], true
+}
+
+func (fr *FastaIndexedReader) Lens() iter.Seq2[FaLen, error] {
+	return func(yield func(FaLen, error) bool) {
+		for _, f := range fr.Index {
+			if !yield(FaLen{Name: f.Name, Len: f.Len}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (f FaiEntry) byteOffset(pos int64) int64 {
+	return f.Offset + (pos/f.LineBases)*f.LineWidth + pos%f.LineBases
+}
+
+func appendSeqBytes(dst []byte, buf []byte) []byte {
+	for _, c := range buf {
+		if c != '\n' && c != '\r' {
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// Fetch the 0-based, half-open subsequence s of chr. An End below zero or past
+// the end of the sequence is clamped to the sequence length.
+func (fr *FastaIndexedReader) Fetch(chr string, s Span) (string, error) {
+	f, ok := fr.Entry(chr)
+	if !ok {
+		return "", fmt.Errorf("FastaIndexedReader.Fetch: chr %v not in index", chr)
+	}
+	if s.End < 0 || s.End > f.Len {
+		s.End = f.Len
+	}
+	if s.Start < 0 || s.Start > s.End {
+		return "", fmt.Errorf("FastaIndexedReader.Fetch: invalid span %v for chr %v of length %v", s, chr, f.Len)
+	}
+	if s.Start == s.End {
+		return "", nil
+	}
+	start := f.byteOffset(s.Start)
+	end := f.byteOffset(s.End-1) + 1
+	buf := make([]byte, end-start)
+	n, e := fr.r.ReadAt(buf, start)
+	if e != nil && e != io.EOF {
+		return "", e
+	}
+	seq := appendSeqBytes(make([]byte, 0, s.End-s.Start), buf[:n])
+	if int64(len(seq)) < s.End-s.Start {
+		return "", fmt.Errorf("FastaIndexedReader.Fetch: chr %v: read %v of %v bases at %v; fasta shorter than its index", chr, len(seq), s.End-s.Start, s)
+	}
+	return string(seq), nil
+}
+
+func (fr *FastaIndexedReader) FetchRegion(region string) (FaEntry, error) {
+	c, e := ParseRegion(region)
+	if e != nil {
+		return FaEntry{}, e
+	}
+	seq, e := fr.Fetch(c.Chr, c.Span)
+	if e != nil {
+		return FaEntry{}, e
+	}
+	return FaEntry{Header: region, Seq: seq}, nil
+}
+
+func (fr *FastaIndexedReader) FetchEntry(chr string) (FaEntry, error) {
+	seq, e := fr.Fetch(chr, Span{0, -1})
+	return FaEntry{Header: chr, Seq: seq}, e
+}
+
+func (fr *FastaIndexedReader) Entries() iter.Seq2[FaEntry, error] {
+	return func(yield func(FaEntry, error) bool) {
+		for _, f := range fr.Index {
+			fa, e := fr.FetchEntry(f.Name)
+			if !yield(fa, e) {
+				return
+			}
+		}
+	}
+}
+
+type FastaIndexedFile struct {
+	*FastaIndexedReader
+	f *os.File
+}
+
+func (f *FastaIndexedFile) Close() error {
+	return f.f.Close()
+}
+
+// Open an uncompressed fasta file along with its .fai index. If build is true
+// and the index does not exist, it is built and written next to the fasta.
+func OpenFastaIndexed(path string, build bool) (*FastaIndexedFile, error) {
+	var index []FaiEntry
+	var e error
+	if HasFai(path) {
+		index, e = ReadFaiPath(FaiPath(path))
+	} else if build {
+		if index, e = BuildFaiPath(path); e == nil {
+			e = WriteFaiPath(FaiPath(path), index...)
+		}
+	} else {
+		e = fmt.Errorf("OpenFastaIndexed: no index found for %v", path)
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	return &FastaIndexedFile{FastaIndexedReader: NewFastaIndexedReader(f, index), f: f}, nil
+}
+
+func ReadFaiPath(path string) (out []FaiEntry, err error) {
+	r, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer func() {
+		e := r.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	return CollectErr(ParseFai(r))
+}
+
+type FaidxFlags struct {
+	Build bool
+}
+
+func FullFaidx() {
+	var f FaidxFlags
+	flag.BoolVar(&f.Build, "b", false, "Only build the index, even if regions are given")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal(fmt.Errorf("usage: faidx [-b] in.fa [region ...]"))
+	}
+	path := flag.Arg(0)
+
+	if !HasFai(path) || f.Build {
+		index, e := BuildFaiPath(path)
+		if e != nil {
+			log.Fatal(e)
+		}
+		if e := WriteFaiPath(FaiPath(path), index...); e != nil {
+			log.Fatal(e)
+		}
+	}
+	if f.Build || flag.NArg() < 2 {
+		return
+	}
+
+	fa, e := OpenFastaIndexed(path, false)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer fa.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	for _, region := range flag.Args()[1:] {
+		entry, e := fa.FetchRegion(region)
+		if e != nil {
+			log.Fatal(e)
+		}
+		if e := WriteFaEntries(w, entry); e != nil {
+			log.Fatal(e)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package fastats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const faidxFa = `>chr1 first
+ACGTA
+CGTAC
+GT
+>chr2
+TTTT
+GG
+`
+
+func TestBuildFai(t *testing.T) {
+	got, e := BuildFai(strings.NewReader(faidxFa))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []FaiEntry{
+		FaiEntry{Name: "chr1", Len: 12, Offset: 12, LineBases: 5, LineWidth: 6},
+		FaiEntry{Name: "chr2", Len: 6, Offset: 33, LineBases: 4, LineWidth: 5},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+
+	var b strings.Builder
+	if e := WriteFai(&b, got...); e != nil {
+		t.Fatal(e)
+	}
+	parsed, e := CollectErr(ParseFai(strings.NewReader(b.String())))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(parsed, exp) {
+		t.Errorf("parsed %v != exp %v", parsed, exp)
+	}
+}
+
+func TestBuildFaiBadLines(t *testing.T) {
+	if _, e := BuildFai(strings.NewReader(">a\nACG\nA\nACG\n")); e == nil {
+		t.Errorf("expected error for short internal line")
+	}
+}
+
+func TestFastaIndexedReader(t *testing.T) {
+	index, e := BuildFai(strings.NewReader(faidxFa))
+	if e != nil {
+		t.Fatal(e)
+	}
+	fr := NewFastaIndexedReader(strings.NewReader(faidxFa), index)
+
+	tests := []struct {
+		region string
+		seq    string
+	}{
+		{"chr1", "ACGTACGTACGT"},
+		{"chr1:4-7", "TACG"},
+		{"chr1:10", "CGT"},
+		{"chr2:5-6", "GG"},
+	}
+	for _, test := range tests {
+		got, e := fr.FetchRegion(test.region)
+		if e != nil {
+			t.Error(e)
+		}
+		if got.Seq != test.seq {
+			t.Errorf("region %v: got %v != exp %v", test.region, got.Seq, test.seq)
+		}
+	}
+
+	spans := SliceIter2([]ChrSpan{ChrSpan{"chr1", Span{4, 6}}, ChrSpan{"chr2", Span{0, 3}}})
+	exp, e := CollectErr(ExtractFasta(ParseFasta(strings.NewReader(">chr1\nACGTACGTACGT\n>chr2\nTTTTGG\n")), spans))
+	if e != nil {
+		t.Fatal(e)
+	}
+	got, e := CollectErr(ExtractFastaIndexed(fr, spans))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+}
+
+func TestFastaIndexedReaderTruncated(t *testing.T) {
+	index, e := BuildFai(strings.NewReader(faidxFa))
+	if e != nil {
+		t.Fatal(e)
+	}
+	// The index promises more of chr2 than the file holds.
+	fr := NewFastaIndexedReader(strings.NewReader(faidxFa[:len(faidxFa)-3]), index)
+	if seq, e := fr.Fetch("chr2", Span{0, -1}); e == nil {
+		t.Errorf("got %q; expected error for truncated fasta", seq)
+	}
+	if seq, e := fr.Fetch("chr2", Span{0, 4}); e != nil || seq != "TTTT" {
+		t.Errorf("got %q, %v; expected TTTT", seq, e)
+	}
+}
+
+func TestExtractFastaPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.fa")
+	if e := os.WriteFile(path, []byte(faidxFa), 0644); e != nil {
+		t.Fatal(e)
+	}
+	// Spans out of fasta order; chr1 has a description in its header.
+	spans := []ChrSpan{{"chr2", Span{0, 3}}, {"chr1", Span{4, 6}}}
+	exp := []FaEntry{{"chr1:4-6", "AC"}, {"chr2:0-3", "TTT"}}
+
+	extract := func() ([]FaEntry, error) {
+		return CollectErr(ExtractFastaPath(path, SliceIter2(spans)))
+	}
+	streamed, e := extract()
+	if e != nil {
+		t.Fatal(e)
+	}
+	index, e := BuildFaiPath(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := WriteFaiPath(FaiPath(path), index...); e != nil {
+		t.Fatal(e)
+	}
+	indexed, e := extract()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(streamed, exp) || !reflect.DeepEqual(indexed, exp) {
+		t.Errorf("streamed %v, indexed %v != exp %v", streamed, indexed, exp)
+	}
+
+	spans = append(spans, ChrSpan{"chr9", Span{0, 1}})
+	if _, e := extract(); e == nil {
+		t.Errorf("expected error for chromosome missing from indexed fasta")
+	}
+	os.Remove(FaiPath(path))
+	if _, e := extract(); e == nil {
+		t.Errorf("expected error for chromosome missing from fasta")
+	}
+}
@@ -1,11 +1,17 @@
 package fastats
 
 import (
+	"bufio"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"golang.org/x/exp/slices"
+	"io"
 	"iter"
 	"math"
 	"os"
+	"strconv"
+	"strings"
 )
 
 type FaStats struct {
@@ -18,6 +24,26 @@ type FaStats struct {
 	N90     int64
 	L90     int64
 	BpInN90 int64
+
+	// Filled by SeqStats
+	Nx   []NxStat `json:",omitempty"`
+	NGx  []NxStat `json:",omitempty"`
+	AuN  float64  `json:",omitempty"`
+	AuNG float64  `json:",omitempty"`
+	// Runs of N at least FaStatsOptions.MinGap long
+	NumGaps int64 `json:",omitempty"`
+	GapBp   int64 `json:",omitempty"`
+	// Stats of the contigs left after breaking sequences at gaps
+	Contigs *FaStats `json:",omitempty"`
+}
+
+// The length N such that sequences at least that long hold X percent of the
+// total, and L, the number of those sequences.
+type NxStat struct {
+	X     float64
+	N     int64
+	L     int64
+	BpInN int64
 }
 
 func RevsortedLensEfficient(it iter.Seq2[FaLen, error]) (lens []int64, counts map[int64]int64, err error) {
@@ -28,15 +54,8 @@ func RevsortedLensEfficient(it iter.Seq2[FaLen, error]) (lens []int64, counts ma
 		}
 		counts[falen.Len]++
 	}
-	lens = make([]int64, 0, len(counts))
-	for length, _ := range counts {
-		lens = append(lens, length)
-	}
-	slices.SortFunc(lens, func(i, j int64) int {
-		return int(j - i)
-	})
-	return lens, counts, nil
-	
+	return sortedLenCounts(counts), counts, nil
+
 }
 
 func RevsortedLens(it iter.Seq2[FaLen, error]) ([]FaLen, error) {
@@ -133,11 +152,86 @@ func Stats(it iter.Seq2[FaLen, error]) (FaStats, error) {
 	return s, nil
 }
 
+type FaStatsFlags struct {
+	Nx         string
+	GenomeSize int64
+	MinGap     int
+	Curve      string
+	Format     string
+	Threads    int
+}
+
+func parseFloatList(s string) ([]float64, error) {
+	var out []float64
+	for _, f := range strings.Split(s, ",") {
+		if f == "" {
+			continue
+		}
+		x, e := strconv.ParseFloat(f, 64)
+		if e != nil {
+			return nil, e
+		}
+		out = append(out, x)
+	}
+	return out, nil
+}
+
 func FullFaStats() {
-	stats, err := Stats(Chrlens(ParseFasta(os.Stdin)))
+	var f FaStatsFlags
+	flag.StringVar(&f.Nx, "x", "50,90", "Comma-separated percentages for Nx and NGx")
+	flag.Int64Var(&f.GenomeSize, "g", 0, "Expected genome size for NGx and auNG")
+	flag.IntVar(&f.MinGap, "gap", 1, "Shortest run of N that counts as a gap between contigs")
+	flag.StringVar(&f.Curve, "curve", "", "Also write the Nx curve (NGx with -g) as TSV to this path")
+	flag.StringVar(&f.Format, "f", "tsv", "Output format when comparing assemblies given as arguments: tsv, json or md")
+	flag.IntVar(&f.Threads, "t", 0, "Assemblies to read at once (0 for all cores)")
+	flag.Parse()
+
+	o := DefaultFaStatsOptions()
+	var err error
+	if o.Nx, err = parseFloatList(f.Nx); err != nil {
+		panic(err)
+	}
+	o.GenomeSize = f.GenomeSize
+	o.MinGap = f.MinGap
+
+	if flag.NArg() > 0 {
+		if f.Curve != "" {
+			panic(fmt.Errorf("-curve needs a single assembly on stdin"))
+		}
+		as, err := CompareAssemblies(flag.Args(), o, f.Threads)
+		if err != nil {
+			panic(err)
+		}
+		w := bufio.NewWriter(os.Stdout)
+		defer func() { Must(w.Flush()) }()
+		if err := WriteAssemblyStats(w, as, f.Format); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	counts, err := CountSeqLens(ParseFasta(os.Stdin), o.MinGap)
 	if err != nil {
 		panic(err)
 	}
+	stats := counts.Stats(o)
+	if f.Curve != "" {
+		curve := counts.NxCurve(f.GenomeSize)
+		cw, err := os.Create(f.Curve)
+		if err != nil {
+			panic(err)
+		}
+		bw := bufio.NewWriter(cw)
+		if err := WriteNxCurve(bw, curve); err != nil {
+			panic(err)
+		}
+		if err := bw.Flush(); err != nil {
+			panic(err)
+		}
+		if err := cw.Close(); err != nil {
+			panic(err)
+		}
+	}
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "\t")
 	err = enc.Encode(stats)
@@ -145,3 +239,200 @@ func FullFaStats() {
 		panic(err)
 	}
 }
+
+// Like NStatsEfficient, but all zero if the sequences never reach nfrac of
+// totalbp, as for an NGx beyond the assembly size.
+func NxEfficient(lens []int64, counts map[int64]int64, totalbp int64, x float64) NxStat {
+	out := NxStat{X: x}
+	totfrac := int64(math.Ceil(float64(totalbp) * x / 100))
+	var bp, l int64
+	for _, length := range lens {
+		count := counts[length]
+		// Whole groups of same-length sequences that stay below totfrac
+		if totfrac-bp > length*count {
+			bp += length * count
+			l += count
+			continue
+		}
+		n := max(1, (totfrac-bp+length-1)/length)
+		out.N, out.L, out.BpInN = length, l+n, bp+n*length
+		return out
+	}
+	return out
+}
+
+// Area under the Nx curve: the sum of squared lengths over totalbp.
+func AuNEfficient(lens []int64, counts map[int64]int64, totalbp int64) float64 {
+	if totalbp <= 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, length := range lens {
+		sum += float64(length) * float64(length) * float64(counts[length])
+	}
+	return sum / float64(totalbp)
+}
+
+// Nx at every whole percent from 1 to 100.
+func NxCurve(lens []int64, counts map[int64]int64, totalbp int64) []NxStat {
+	out := make([]NxStat, 0, 100)
+	for x := 1; x <= 100; x++ {
+		out = append(out, NxEfficient(lens, counts, totalbp, float64(x)))
+	}
+	return out
+}
+
+func WriteNxCurve(w io.Writer, curve []NxStat) error {
+	if _, e := fmt.Fprintf(w, "x\tNx\tLx\tbp\n"); e != nil {
+		return e
+	}
+	for _, n := range curve {
+		if _, e := fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", n.X, n.N, n.L, n.BpInN); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+type FaStatsOptions struct {
+	// Percentages for Nx and NGx
+	Nx []float64
+	// Expected genome size for NGx and auNG; 0 to skip them
+	GenomeSize int64
+	// Shortest run of N counted as a gap, at least 1
+	MinGap int
+	// Also compute stats of the contigs between gaps
+	Contigs bool
+}
+
+func DefaultFaStatsOptions() FaStatsOptions {
+	return FaStatsOptions{Nx: []float64{50, 90}, MinGap: 1, Contigs: true}
+}
+
+func isN(c byte) bool {
+	return c == 'N' || c == 'n'
+}
+
+// Count the gaps of seq and add its contigs' lengths to contigs.
+func scanGaps(seq string, minGap int, contigs map[int64]int64) (ngaps, gapbp int64) {
+	start := 0
+	for i := 0; i < len(seq); {
+		if !isN(seq[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(seq) && isN(seq[j]) {
+			j++
+		}
+		if j-i >= minGap {
+			ngaps++
+			gapbp += int64(j - i)
+			if i > start {
+				contigs[int64(i-start)]++
+			}
+			start = j
+		}
+		i = j
+	}
+	if len(seq) > start {
+		contigs[int64(len(seq)-start)]++
+	}
+	return ngaps, gapbp
+}
+
+func sortedLenCounts(counts map[int64]int64) []int64 {
+	lens := make([]int64, 0, len(counts))
+	for length := range counts {
+		lens = append(lens, length)
+	}
+	slices.SortFunc(lens, func(i, j int64) int {
+		return int(j - i)
+	})
+	return lens
+}
+
+func lenCountStats(lens []int64, counts map[int64]int64, o FaStatsOptions) FaStats {
+	var s FaStats
+	BasicStatsEfficient(lens, counts, &s)
+	N50StatsEfficient(lens, counts, &s)
+	N90StatsEfficient(lens, counts, &s)
+	if s.NumSeqs == 0 {
+		// No contigs, as for an all-N sequence; NaN can't be written as JSON
+		s.MeanLen = 0
+	}
+	for _, x := range o.Nx {
+		s.Nx = append(s.Nx, NxEfficient(lens, counts, s.Bp, x))
+	}
+	s.AuN = AuNEfficient(lens, counts, s.Bp)
+	if o.GenomeSize > 0 {
+		for _, x := range o.Nx {
+			s.NGx = append(s.NGx, NxEfficient(lens, counts, o.GenomeSize, x))
+		}
+		s.AuNG = AuNEfficient(lens, counts, o.GenomeSize)
+	}
+	return s
+}
+
+// Sequence and contig lengths, with gaps, as counted in one pass by
+// CountSeqLens.
+type SeqLenCounts struct {
+	// Number of sequences of each length
+	Seqs map[int64]int64
+	// Number of contigs of each length, after breaking sequences at gaps
+	Contigs map[int64]int64
+	NumGaps int64
+	GapBp   int64
+}
+
+// Count sequence and contig lengths, with gaps of at least minGap N. Only the
+// counts are kept, not the sequences.
+func CountSeqLens[F FaEnter](it iter.Seq2[F, error], minGap int) (SeqLenCounts, error) {
+	c := SeqLenCounts{Seqs: map[int64]int64{}, Contigs: map[int64]int64{}}
+	for f, e := range it {
+		if e != nil {
+			return SeqLenCounts{}, e
+		}
+		seq := f.FaSeq()
+		c.Seqs[int64(len(seq))]++
+		n, bp := scanGaps(seq, max(1, minGap), c.Contigs)
+		c.NumGaps += n
+		c.GapBp += bp
+	}
+	return c, nil
+}
+
+// The stats chosen in o. o.MinGap is ignored, as gaps are already counted.
+func (c SeqLenCounts) Stats(o FaStatsOptions) FaStats {
+	s := lenCountStats(sortedLenCounts(c.Seqs), c.Seqs, o)
+	s.NumGaps, s.GapBp = c.NumGaps, c.GapBp
+	if o.Contigs {
+		co := o
+		co.Contigs = false
+		contigs := lenCountStats(sortedLenCounts(c.Contigs), c.Contigs, co)
+		s.Contigs = &contigs
+	}
+	return s
+}
+
+// The Nx curve of the sequences, or with genomeSize above 0, the NGx curve.
+func (c SeqLenCounts) NxCurve(genomeSize int64) []NxStat {
+	lens := sortedLenCounts(c.Seqs)
+	total := genomeSize
+	if total <= 0 {
+		var s FaStats
+		BasicStatsEfficient(lens, c.Seqs, &s)
+		total = s.Bp
+	}
+	return NxCurve(lens, c.Seqs, total)
+}
+
+// Like Stats, but reading sequences so that gaps and contigs can be counted,
+// and adding the stats chosen in o.
+func SeqStats[F FaEnter](it iter.Seq2[F, error], o FaStatsOptions) (FaStats, error) {
+	c, e := CountSeqLens(it, o.MinGap)
+	if e != nil {
+		return FaStats{}, e
+	}
+	return c.Stats(o), nil
+}
@@ -0,0 +1,133 @@
+package fastats
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNxEfficient(t *testing.T) {
+	counts := map[int64]int64{50: 1, 30: 1, 10: 2}
+	lens := sortedLenCounts(counts)
+
+	tests := []struct {
+		total int64
+		x     float64
+		want  NxStat
+	}{
+		{100, 50, NxStat{50, 50, 1, 50}},
+		{100, 60, NxStat{60, 30, 2, 80}},
+		{100, 90, NxStat{90, 10, 3, 90}},
+		{100, 100, NxStat{100, 10, 4, 100}},
+		{200, 40, NxStat{40, 30, 2, 80}},
+		{200, 60, NxStat{X: 60}},
+	}
+	for _, test := range tests {
+		got := NxEfficient(lens, counts, test.total, test.x)
+		if got != test.want {
+			t.Errorf("total %v x %v: got %v; want %v", test.total, test.x, got, test.want)
+		}
+	}
+
+	if got := AuNEfficient(lens, counts, 100); got != 36 {
+		t.Errorf("auN %v != 36", got)
+	}
+}
+
+func TestSeqStats(t *testing.T) {
+	fa := []FaEntry{
+		{"s1", "AAAANNCCCCCCNNNNG"},
+		{"s2", "NACGTN"},
+		{"s3", "GGGG"},
+	}
+	o := FaStatsOptions{Nx: []float64{50}, GenomeSize: 40, MinGap: 2, Contigs: true}
+	s, e := SeqStats(SliceIter2(fa), o)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if s.Bp != 27 || s.NumSeqs != 3 || s.N50 != 17 || s.L50 != 1 {
+		t.Errorf("basic stats wrong: %+v", s)
+	}
+	if want := []NxStat{{50, 17, 1, 17}}; !reflect.DeepEqual(s.Nx, want) {
+		t.Errorf("Nx %v != %v", s.Nx, want)
+	}
+	if want := []NxStat{{50, 6, 2, 23}}; !reflect.DeepEqual(s.NGx, want) {
+		t.Errorf("NGx %v != %v", s.NGx, want)
+	}
+	if s.NumGaps != 2 || s.GapBp != 6 {
+		t.Errorf("gaps %v %v != 2 6", s.NumGaps, s.GapBp)
+	}
+
+	counts, e := CountSeqLens(SliceIter2(fa), o.MinGap)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := counts.NxCurve(0)[49]; got != s.Nx[0] {
+		t.Errorf("Nx curve at 50 %v != %v", got, s.Nx[0])
+	}
+	if got := counts.NxCurve(o.GenomeSize)[49]; got != s.NGx[0] {
+		t.Errorf("NGx curve at 50 %v != %v", got, s.NGx[0])
+	}
+
+	// Single Ns in s2 are below MinGap, so it stays whole.
+	c := s.Contigs
+	if c == nil {
+		t.Fatal("no contig stats")
+	}
+	if c.Bp != 21 || c.NumSeqs != 5 || c.N50 != 6 || c.L50 != 2 || c.Contigs != nil {
+		t.Errorf("contig stats wrong: %+v", c)
+	}
+}
+
+func TestWriteNxCurve(t *testing.T) {
+	counts := map[int64]int64{3: 1, 1: 1}
+	curve := NxCurve(sortedLenCounts(counts), counts, 4)
+	if len(curve) != 100 {
+		t.Fatalf("len(curve) %v != 100", len(curve))
+	}
+	var b strings.Builder
+	if e := WriteNxCurve(&b, curve[74:76]); e != nil {
+		t.Fatal(e)
+	}
+	want := "x\tNx\tLx\tbp\n75\t3\t1\t3\n76\t1\t2\t4\n"
+	if b.String() != want {
+		t.Errorf("%q != %q", b.String(), want)
+	}
+}
+
+func TestCompareAssemblies(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{dir + "/a.fa", dir + "/b.fa"}
+	if e := os.WriteFile(paths[0], []byte(">a\nACGTNNACGT\n>b\nAC\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(paths[1], []byte(">c\nACGTACGT\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	o := FaStatsOptions{Nx: []float64{50}, MinGap: 1}
+	as, e := CompareAssemblies(paths, o, 2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var b strings.Builder
+	if e := WriteAssemblyStatsTsv(&b, as); e != nil {
+		t.Fatal(e)
+	}
+	want := "stat\t" + paths[0] + "\t" + paths[1] + "\n" +
+		"Bp\t12\t8\n" +
+		"NumSeqs\t2\t1\n" +
+		"MeanLen\t6\t8\n" +
+		"N50\t10\t8\n" +
+		"L50\t1\t1\n" +
+		"AuN\t8.666666666666666\t8\n"
+	if b.String() != want {
+		t.Errorf("%q != %q", b.String(), want)
+	}
+
+	if _, e := CompareAssemblies(append(paths, dir+"/missing.fa"), o, 0); e == nil {
+		t.Errorf("no error for missing file")
+	}
+}
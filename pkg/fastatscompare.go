@@ -0,0 +1,171 @@
+package fastats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+// The stats of one assembly, named by its path.
+type AssemblyStats struct {
+	Name  string
+	Stats FaStats
+}
+
+// SeqStats of a fasta file, which may be gzipped or xz compressed.
+func FileFaStats(path string, o FaStatsOptions) (FaStats, error) {
+	r, e := zfile.Open(path)
+	if e != nil {
+		return FaStats{}, e
+	}
+	defer r.Close()
+	return SeqStats(ParseFasta(r), o)
+}
+
+// FileFaStats of each path, with up to threads files read at once (0 for
+// GOMAXPROCS). The output is in the order of paths.
+func CompareAssemblies(paths []string, o FaStatsOptions, threads int) ([]AssemblyStats, error) {
+	if threads < 1 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	out := make([]AssemblyStats, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, threads)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			s, e := FileFaStats(path, o)
+			if e != nil {
+				errs[i] = fmt.Errorf("%v: %w", path, e)
+			}
+			out[i] = AssemblyStats{path, s}
+		}()
+	}
+	wg.Wait()
+	if e := errors.Join(errs...); e != nil {
+		return nil, e
+	}
+	return out, nil
+}
+
+type statRow struct {
+	Name  string
+	Value string
+}
+
+func nxRows(nx []NxStat, n, l string) []statRow {
+	var out []statRow
+	for _, x := range nx {
+		out = append(out,
+			statRow{fmt.Sprintf("%v%v", n, x.X), fmt.Sprint(x.N)},
+			statRow{fmt.Sprintf("%v%v", l, x.X), fmt.Sprint(x.L)},
+		)
+	}
+	return out
+}
+
+// One named row per stat, with contig stats prefixed "Contig".
+func faStatsRows(s FaStats, prefix string) []statRow {
+	out := []statRow{
+		{"Bp", fmt.Sprint(s.Bp)},
+		{"NumSeqs", fmt.Sprint(s.NumSeqs)},
+		{"MeanLen", fmt.Sprint(s.MeanLen)},
+	}
+	if len(s.Nx) > 0 {
+		out = append(out, nxRows(s.Nx, "N", "L")...)
+	} else {
+		out = append(out, nxRows([]NxStat{{50, s.N50, s.L50, s.BpInN50}, {90, s.N90, s.L90, s.BpInN90}}, "N", "L")...)
+	}
+	out = append(out, nxRows(s.NGx, "NG", "LG")...)
+	out = append(out, statRow{"AuN", fmt.Sprint(s.AuN)})
+	if len(s.NGx) > 0 {
+		out = append(out, statRow{"AuNG", fmt.Sprint(s.AuNG)})
+	}
+	if s.Contigs != nil {
+		out = append(out, statRow{"NumGaps", fmt.Sprint(s.NumGaps)}, statRow{"GapBp", fmt.Sprint(s.GapBp)})
+		out = append(out, faStatsRows(*s.Contigs, "Contig")...)
+	}
+	for i := range out {
+		out[i].Name = prefix + out[i].Name
+	}
+	return out
+}
+
+// A table with a header row, then one row per stat and one column per
+// assembly. Assemblies should share the same FaStatsOptions.
+func AssemblyStatsTable(as []AssemblyStats) [][]string {
+	header := []string{"stat"}
+	var rows [][]string
+	for i, a := range as {
+		header = append(header, a.Name)
+		for j, r := range faStatsRows(a.Stats, "") {
+			if i == 0 {
+				rows = append(rows, []string{r.Name})
+			}
+			if j < len(rows) {
+				rows[j] = append(rows[j], r.Value)
+			}
+		}
+	}
+	return append([][]string{header}, rows...)
+}
+
+func WriteAssemblyStatsTsv(w io.Writer, as []AssemblyStats) error {
+	for _, row := range AssemblyStatsTable(as) {
+		if _, e := fmt.Fprintln(w, strings.Join(row, "\t")); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func WriteAssemblyStatsMarkdown(w io.Writer, as []AssemblyStats) error {
+	table := AssemblyStatsTable(as)
+	line := func(row []string) error {
+		_, e := fmt.Fprintf(w, "| %v |\n", strings.Join(row, " | "))
+		return e
+	}
+	if e := line(table[0]); e != nil {
+		return e
+	}
+	align := []string{"---"}
+	for range as {
+		align = append(align, "---:")
+	}
+	if e := line(align); e != nil {
+		return e
+	}
+	for _, row := range table[1:] {
+		if e := line(row); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func WriteAssemblyStatsJson(w io.Writer, as []AssemblyStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(as)
+}
+
+func WriteAssemblyStats(w io.Writer, as []AssemblyStats, format string) error {
+	switch format {
+	case "tsv":
+		return WriteAssemblyStatsTsv(w, as)
+	case "md":
+		return WriteAssemblyStatsMarkdown(w, as)
+	case "json":
+		return WriteAssemblyStatsJson(w, as)
+	}
+	return fmt.Errorf("WriteAssemblyStats: unknown format %v", format)
+}
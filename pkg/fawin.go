@@ -51,3 +51,32 @@ func FaWins[F FaEnter](fa iter.Seq2[F, error], size int64, step int64) iter.Seq2
 		}
 	}
 }
+
+func FaiEntryWins(fr *FastaIndexedReader, f FaiEntry, size int64, step int64) iter.Seq2[BedEntry[string], error] {
+	return func(yield func(BedEntry[string], error) bool) {
+		for s := range Wins(0, f.Len, size, step) {
+			seq, e := fr.Fetch(f.Name, s)
+			fv := BedEntry[string]{
+				ChrSpan: ChrSpan{f.Name, s},
+				Fields:  seq,
+			}
+			if !yield(fv, e) {
+				return
+			}
+		}
+	}
+}
+
+// Like FaWins, but reads each window from disk so that only one window is in
+// memory at a time.
+func FaWinsIndexed(fr *FastaIndexedReader, size int64, step int64) iter.Seq2[BedEntry[string], error] {
+	return func(yield func(BedEntry[string], error) bool) {
+		for _, f := range fr.Index {
+			for view, e := range FaiEntryWins(fr, f, size, step) {
+				if !yield(view, e) {
+					return
+				}
+			}
+		}
+	}
+}
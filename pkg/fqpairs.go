@@ -0,0 +1,234 @@
+package fastats
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+var ErrFqPairName = errors.New("mate read names do not match")
+var ErrFqPairShort = errors.New("paired fastq files are not the same length")
+
+// An Illumina CASAVA 1.8+ comment, such as "1:N:0:ATCACG"
+var illuminaCommentRe = regexp.MustCompile(`^([12]):[YN]:`)
+
+// The read name without its comment and without a /1 or /2 mate suffix.
+func FqReadName(header string) string {
+	name, _, _ := strings.Cut(header, " ")
+	name, _, _ = strings.Cut(name, "\t")
+	if strings.HasSuffix(name, "/1") || strings.HasSuffix(name, "/2") {
+		name = name[:len(name)-2]
+	}
+	return name
+}
+
+// The mate number from a /1 or /2 suffix or an Illumina comment, or 0 if the
+// header has neither.
+func FqMateNumber(header string) int {
+	name, comment, _ := strings.Cut(header, " ")
+	switch {
+	case strings.HasSuffix(name, "/1"):
+		return 1
+	case strings.HasSuffix(name, "/2"):
+		return 2
+	}
+	if m := illuminaCommentRe.FindStringSubmatch(comment); m != nil {
+		return int(m[1][0] - '0')
+	}
+	return 0
+}
+
+// Check that two reads are mates: their names match, and their mate numbers,
+// where given, are 1 and 2.
+func CheckFqPair[F1, F2 FaEnter](r1 F1, r2 F2) error {
+	h1, h2 := r1.FaHeader(), r2.FaHeader()
+	if FqReadName(h1) != FqReadName(h2) {
+		return fmt.Errorf("CheckFqPair: %w: %q and %q", ErrFqPairName, h1, h2)
+	}
+	m1, m2 := FqMateNumber(h1), FqMateNumber(h2)
+	if (m1 != 0 && m1 != 1) || (m2 != 0 && m2 != 2) {
+		return fmt.Errorf("CheckFqPair: %w: mate numbers %v and %v in %q and %q", ErrFqPairName, m1, m2, h1, h2)
+	}
+	return nil
+}
+
+// Pair the reads of two fastq iterators, checking each pair with
+// CheckFqPair. Stops after the first error.
+func ZipFastqPairs[F1, F2 FqEnter](it1 iter.Seq2[F1, error], it2 iter.Seq2[F2, error]) iter.Seq2[Tuple2[FqEntry, FqEntry], error] {
+	return func(yield func(Tuple2[FqEntry, FqEntry], error) bool) {
+		next2, stop := iter.Pull2(it2)
+		defer stop()
+		for f1, e := range it1 {
+			if e != nil {
+				yield(Tuple2[FqEntry, FqEntry]{}, e)
+				return
+			}
+			f2, e, ok := next2()
+			if !ok {
+				yield(Tuple2[FqEntry, FqEntry]{}, fmt.Errorf("ZipFastqPairs: %w: no mate for %q", ErrFqPairShort, f1.FaHeader()))
+				return
+			}
+			if e != nil {
+				yield(Tuple2[FqEntry, FqEntry]{}, e)
+				return
+			}
+			pair := Tuple2[FqEntry, FqEntry]{ToFqEntry(f1), ToFqEntry(f2)}
+			if e := CheckFqPair(pair.V1, pair.V2); e != nil {
+				yield(pair, e)
+				return
+			}
+			if !yield(pair, nil) {
+				return
+			}
+		}
+		if f2, e, ok := next2(); ok {
+			if e == nil {
+				e = fmt.Errorf("ZipFastqPairs: %w: no mate for %q", ErrFqPairShort, f2.FaHeader())
+			}
+			yield(Tuple2[FqEntry, FqEntry]{}, e)
+		}
+	}
+}
+
+// Read pairs from R1 and R2 fastq files.
+func ParseFastqPairs(r1, r2 io.Reader) iter.Seq2[Tuple2[FqEntry, FqEntry], error] {
+	return ZipFastqPairs(ParseFastq(r1), ParseFastq(r2))
+}
+
+// Pair consecutive reads of an interleaved fastq.
+func DeinterleaveFastq[F FqEnter](it iter.Seq2[F, error]) iter.Seq2[Tuple2[FqEntry, FqEntry], error] {
+	return func(yield func(Tuple2[FqEntry, FqEntry], error) bool) {
+		var pair Tuple2[FqEntry, FqEntry]
+		odd := false
+		for f, e := range it {
+			if e != nil {
+				yield(Tuple2[FqEntry, FqEntry]{}, e)
+				return
+			}
+			if !odd {
+				pair.V1 = ToFqEntry(f)
+				odd = true
+				continue
+			}
+			pair.V2 = ToFqEntry(f)
+			odd = false
+			if e := CheckFqPair(pair.V1, pair.V2); e != nil {
+				yield(pair, e)
+				return
+			}
+			if !yield(pair, nil) {
+				return
+			}
+		}
+		if odd {
+			yield(Tuple2[FqEntry, FqEntry]{}, fmt.Errorf("DeinterleaveFastq: %w: no mate for %q", ErrFqPairShort, pair.V1.Header))
+		}
+	}
+}
+
+func ParseInterleavedFastq(r io.Reader) iter.Seq2[Tuple2[FqEntry, FqEntry], error] {
+	return DeinterleaveFastq(ParseFastq(r))
+}
+
+// Each pair's reads one after the other.
+func InterleaveFastq(it iter.Seq2[Tuple2[FqEntry, FqEntry], error]) iter.Seq2[FqEntry, error] {
+	return func(yield func(FqEntry, error) bool) {
+		for pair, e := range it {
+			if e != nil {
+				yield(FqEntry{}, e)
+				return
+			}
+			if !yield(pair.V1, nil) || !yield(pair.V2, nil) {
+				return
+			}
+		}
+	}
+}
+
+func WriteInterleavedFq(w io.Writer, it iter.Seq2[Tuple2[FqEntry, FqEntry], error]) error {
+	return WriteFq(w, InterleaveFastq(it))
+}
+
+func WriteFqPairs(w1, w2 io.Writer, it iter.Seq2[Tuple2[FqEntry, FqEntry], error]) error {
+	for pair, e := range it {
+		if e != nil {
+			return e
+		}
+		if e := WriteFqEntries(w1, pair.V1); e != nil {
+			return e
+		}
+		if e := WriteFqEntries(w2, pair.V2); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+type FqInterleaveFlags struct {
+	R1           string
+	R2           string
+	Deinterleave bool
+}
+
+func FullFqInterleave() {
+	var f FqInterleaveFlags
+	flag.StringVar(&f.R1, "1", "", "R1 fastq (required)")
+	flag.StringVar(&f.R2, "2", "", "R2 fastq (required)")
+	flag.BoolVar(&f.Deinterleave, "d", false, "Split interleaved fastq on stdin into -1 and -2 instead")
+	flag.Parse()
+
+	if f.R1 == "" || f.R2 == "" {
+		log.Fatal("missing -1 or -2")
+	}
+
+	if f.Deinterleave {
+		w1, e := zfile.Create(f.R1)
+		if e != nil {
+			log.Fatal(e)
+		}
+		w2, e := zfile.Create(f.R2)
+		if e != nil {
+			log.Fatal(e)
+		}
+		bw1, bw2 := bufio.NewWriter(w1), bufio.NewWriter(w2)
+		if e := WriteFqPairs(bw1, bw2, ParseInterleavedFastq(os.Stdin)); e != nil {
+			log.Fatal(e)
+		}
+		for _, e := range []error{bw1.Flush(), bw2.Flush(), w1.Close(), w2.Close()} {
+			if e != nil {
+				log.Fatal(e)
+			}
+		}
+		return
+	}
+
+	r1, e := zfile.Open(f.R1)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer r1.Close()
+	r2, e := zfile.Open(f.R2)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer r2.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	if e := WriteInterleavedFq(w, ParseFastqPairs(r1, r2)); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -0,0 +1,76 @@
+package fastats
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFqReadName(t *testing.T) {
+	tests := []struct {
+		header string
+		name   string
+		mate   int
+	}{
+		{"r1/1", "r1", 1},
+		{"r1/2 extra", "r1", 2},
+		{"EAS139:136:FC706VJ:2:2104:15343:197393 1:Y:18:ATCACG", "EAS139:136:FC706VJ:2:2104:15343:197393", 1},
+		{"EAS139:136:FC706VJ:2:2104:15343:197393 2:N:18:ATCACG", "EAS139:136:FC706VJ:2:2104:15343:197393", 2},
+		{"SRR001666.1 length=36", "SRR001666.1", 0},
+	}
+	for _, test := range tests {
+		if name := FqReadName(test.header); name != test.name {
+			t.Errorf("FqReadName(%q) %q != %q", test.header, name, test.name)
+		}
+		if mate := FqMateNumber(test.header); mate != test.mate {
+			t.Errorf("FqMateNumber(%q) %v != %v", test.header, mate, test.mate)
+		}
+	}
+}
+
+const fqR1 = "@a/1\nAC\n+\nII\n@b 1:N:0:ACGT\nGG\n+\nII\n"
+const fqR2 = "@a/2\nTT\n+\nII\n@b 2:N:0:ACGT\nCC\n+\nII\n"
+
+func TestParseFastqPairs(t *testing.T) {
+	pairs, e := CollectErr(ParseFastqPairs(strings.NewReader(fqR1), strings.NewReader(fqR2)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(pairs) != 2 || pairs[1].V1.Seq != "GG" || pairs[1].V2.Seq != "CC" {
+		t.Errorf("bad pairs %v", pairs)
+	}
+
+	var inter, w1, w2 strings.Builder
+	if e := WriteInterleavedFq(&inter, SliceIter2(pairs)); e != nil {
+		t.Fatal(e)
+	}
+	want := "@a/1\nAC\n+\nII\n@a/2\nTT\n+\nII\n@b 1:N:0:ACGT\nGG\n+\nII\n@b 2:N:0:ACGT\nCC\n+\nII\n"
+	if inter.String() != want {
+		t.Errorf("interleaved %q != %q", inter.String(), want)
+	}
+	if e := WriteFqPairs(&w1, &w2, ParseInterleavedFastq(strings.NewReader(inter.String()))); e != nil {
+		t.Fatal(e)
+	}
+	if w1.String() != fqR1 || w2.String() != fqR2 {
+		t.Errorf("deinterleaved %q %q", w1.String(), w2.String())
+	}
+}
+
+func TestParseFastqPairsErrors(t *testing.T) {
+	_, e := CollectErr(ParseFastqPairs(strings.NewReader(fqR1), strings.NewReader("@a/2\nTT\n+\nII\n@c/2\nCC\n+\nII\n")))
+	if !errors.Is(e, ErrFqPairName) {
+		t.Errorf("mismatched names: %v", e)
+	}
+	_, e = CollectErr(ParseFastqPairs(strings.NewReader(fqR1), strings.NewReader("@a/1\nTT\n+\nII\n")))
+	if !errors.Is(e, ErrFqPairName) {
+		t.Errorf("two R1 reads: %v", e)
+	}
+	_, e = CollectErr(ParseFastqPairs(strings.NewReader(fqR1), strings.NewReader("@a/2\nTT\n+\nII\n")))
+	if !errors.Is(e, ErrFqPairShort) {
+		t.Errorf("short R2: %v", e)
+	}
+	_, e = CollectErr(ParseInterleavedFastq(strings.NewReader(fqR1[:len(fqR1)/2])))
+	if !errors.Is(e, ErrFqPairShort) {
+		t.Errorf("odd interleaved: %v", e)
+	}
+}
@@ -53,14 +53,14 @@ func parseFastq(r io.Reader, yield func(FqEntry, error) bool) {
 	var lines []string
 	for lines, err := ScanFour(lines, s); err != io.EOF; lines, err = ScanFour(lines, s) {
 		if err != nil {
-			if !yield(FqEntry{}, err) {
-				return
-			}
+			yield(FqEntry{}, err)
+			return
 		}
 		if len(lines[0]) < 1 {
 			if !yield(FqEntry{}, fmt.Errorf("parseFastq: empty header line")) {
 				return
 			}
+			continue
 		}
 		if !yield(FqEntry{FaEntry: FaEntry{Header: lines[0][1:], Seq: lines[1]}, Qual: lines[3]}, nil) {
 			return
@@ -0,0 +1,346 @@
+package fastats
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"io"
+	"iter"
+	"log"
+	"math"
+	"os"
+	"slices"
+)
+
+// The highest phred score tracked; higher scores are counted as this.
+const MaxPhred = 93
+
+type FqQCOptions struct {
+	// Reads at the start of the file used to estimate duplication and
+	// overrepresented sequences; 0 for all
+	DupReads int64
+	// Sequences making up at least this fraction of the sampled reads are
+	// reported as overrepresented
+	OverrepFrac float64
+	// Sequences longer than this are truncated to it before counting
+	// duplicates, as in FastQC; 0 to keep them whole
+	DupTrunc int
+}
+
+func DefaultFqQCOptions() FqQCOptions {
+	return FqQCOptions{DupReads: 200000, OverrepFrac: 0.001, DupTrunc: 50}
+}
+
+// Phred score quantiles at one read position (0-based).
+type PosQual struct {
+	Pos    int
+	Mean   float64
+	P10    int
+	Q1     int
+	Median int
+	Q3     int
+	P90    int
+}
+
+// Fraction of each base at one read position (0-based). Other holds letters
+// other than ACGTN.
+type PosBases struct {
+	Pos   int
+	A     float64
+	C     float64
+	G     float64
+	T     float64
+	N     float64
+	Other float64
+}
+
+type LenCount struct {
+	Len   int64
+	Count int64
+}
+
+// Sequences seen Level times, with the fraction of distinct sequences and of
+// reads they make up.
+type DupLevel struct {
+	Level    string
+	SeqFrac  float64
+	ReadFrac float64
+}
+
+type OverrepSeq struct {
+	Seq   string
+	Count int64
+	Frac  float64
+}
+
+type FqQC struct {
+	Reads   int64
+	Bases   int64
+	NBases  int64
+	GCFrac  float64
+	MinLen  int64
+	MaxLen  int64
+	MeanLen float64
+
+	PosQuals []PosQual
+	PosBases []PosBases
+	// GCHist[p] is the number of reads with p percent GC, rounded
+	GCHist  []int64
+	LenHist []LenCount
+	// Reads with at least one N
+	NReads int64
+
+	// Duplication among the first DupReads reads
+	DupSampled int64
+	// Fraction of sampled reads left after removing duplicates
+	DedupFrac float64
+	DupLevels []DupLevel
+	Overrep   []OverrepSeq
+}
+
+// Accumulates FqQC one read at a time.
+type FqQCCollector struct {
+	o        FqQCOptions
+	reads    int64
+	bases    int64
+	gc       float64
+	gcBases  float64
+	nReads   int64
+	qualHist [][MaxPhred + 1]int64
+	baseHist [][6]int64
+	gcHist   [101]int64
+	lens     map[int64]int64
+	sampled  int64
+	seqs     map[string]int64
+}
+
+func NewFqQCCollector(o FqQCOptions) *FqQCCollector {
+	return &FqQCCollector{o: o, lens: map[int64]int64{}, seqs: map[string]int64{}}
+}
+
+func baseIndex(b byte) int {
+	switch b {
+	case 'A', 'a':
+		return 0
+	case 'C', 'c':
+		return 1
+	case 'G', 'g':
+		return 2
+	case 'T', 't':
+		return 3
+	case 'N', 'n':
+		return 4
+	}
+	return 5
+}
+
+func (c *FqQCCollector) Add(f FqEntry) {
+	seq, qual := f.Seq, f.Qual
+	c.reads++
+	c.bases += int64(len(seq))
+	c.lens[int64(len(seq))]++
+
+	c.qualHist = GrowLen(c.qualHist, len(qual))
+	for i := 0; i < len(qual); i++ {
+		q := min(max(int(qual[i])-33, 0), MaxPhred)
+		c.qualHist[i][q]++
+	}
+
+	c.baseHist = GrowLen(c.baseHist, len(seq))
+	hasN := false
+	for i := 0; i < len(seq); i++ {
+		b := baseIndex(seq[i])
+		c.baseHist[i][b]++
+		hasN = hasN || b == 4
+	}
+	if hasN {
+		c.nReads++
+	}
+
+	gc, bp := GCCount(seq)
+	c.gc += gc
+	c.gcBases += bp
+	if bp > 0 {
+		c.gcHist[int(math.Round(100*gc/bp))]++
+	}
+
+	if c.o.DupReads <= 0 || c.sampled < c.o.DupReads {
+		c.sampled++
+		if c.o.DupTrunc > 0 && len(seq) > c.o.DupTrunc {
+			seq = seq[:c.o.DupTrunc]
+		}
+		c.seqs[seq]++
+	}
+}
+
+// The smallest score with at least frac of counts at or below it.
+func histQuantile(hist []int64, total int64, frac float64) int {
+	want := int64(math.Ceil(float64(total) * frac))
+	var cum int64
+	for q, n := range hist {
+		cum += n
+		if cum >= max(want, 1) {
+			return q
+		}
+	}
+	return len(hist) - 1
+}
+
+func posQual(pos int, hist []int64) PosQual {
+	var total int64
+	sum := 0.0
+	for q, n := range hist {
+		total += n
+		sum += float64(q) * float64(n)
+	}
+	return PosQual{
+		Pos:    pos,
+		Mean:   sum / float64(total),
+		P10:    histQuantile(hist, total, 0.1),
+		Q1:     histQuantile(hist, total, 0.25),
+		Median: histQuantile(hist, total, 0.5),
+		Q3:     histQuantile(hist, total, 0.75),
+		P90:    histQuantile(hist, total, 0.9),
+	}
+}
+
+var dupLevelBounds = []struct {
+	min   int64
+	label string
+}{
+	{1, "1"}, {2, "2"}, {3, "3"}, {4, "4"}, {5, "5"}, {6, "6"}, {7, "7"}, {8, "8"}, {9, "9"},
+	{10, "10+"}, {50, "50+"}, {100, "100+"}, {500, "500+"}, {1000, "1k+"}, {5000, "5k+"}, {10000, "10k+"},
+}
+
+func dupLevels(seqs map[string]int64, sampled int64) []DupLevel {
+	out := make([]DupLevel, len(dupLevelBounds))
+	for i, b := range dupLevelBounds {
+		out[i].Level = b.label
+	}
+	for _, n := range seqs {
+		i := len(dupLevelBounds) - 1
+		for dupLevelBounds[i].min > n {
+			i--
+		}
+		out[i].SeqFrac++
+		out[i].ReadFrac += float64(n)
+	}
+	for i := range out {
+		out[i].SeqFrac /= float64(len(seqs))
+		out[i].ReadFrac /= float64(sampled)
+	}
+	return out
+}
+
+func (c *FqQCCollector) Report() FqQC {
+	r := FqQC{
+		Reads:      c.reads,
+		Bases:      c.bases,
+		NReads:     c.nReads,
+		GCHist:     slices.Clone(c.gcHist[:]),
+		DupSampled: c.sampled,
+		Overrep:    []OverrepSeq{},
+	}
+	if c.reads == 0 {
+		return r
+	}
+	if c.gcBases > 0 {
+		r.GCFrac = c.gc / c.gcBases
+	}
+
+	for length, n := range c.lens {
+		r.LenHist = append(r.LenHist, LenCount{length, n})
+	}
+	slices.SortFunc(r.LenHist, func(a, b LenCount) int { return cmp.Compare(a.Len, b.Len) })
+	r.MinLen = r.LenHist[0].Len
+	r.MaxLen = r.LenHist[len(r.LenHist)-1].Len
+	r.MeanLen = float64(c.bases) / float64(c.reads)
+
+	for i := range c.qualHist {
+		r.PosQuals = append(r.PosQuals, posQual(i, c.qualHist[i][:]))
+	}
+	for i, h := range c.baseHist {
+		var total int64
+		for _, n := range h {
+			total += n
+		}
+		t := float64(total)
+		r.PosBases = append(r.PosBases, PosBases{i, float64(h[0]) / t, float64(h[1]) / t, float64(h[2]) / t, float64(h[3]) / t, float64(h[4]) / t, float64(h[5]) / t})
+		r.NBases += h[4]
+	}
+
+	r.DedupFrac = float64(len(c.seqs)) / float64(c.sampled)
+	r.DupLevels = dupLevels(c.seqs, c.sampled)
+	for seq, n := range c.seqs {
+		if frac := float64(n) / float64(c.sampled); frac >= c.o.OverrepFrac && n > 1 {
+			r.Overrep = append(r.Overrep, OverrepSeq{seq, n, frac})
+		}
+	}
+	slices.SortFunc(r.Overrep, func(a, b OverrepSeq) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+	return r
+}
+
+// Collect QC stats in one pass over a fastq file. Quality scores are read as
+// phred+33.
+func FastqQC[F FqEnter](it iter.Seq2[F, error], o FqQCOptions) (FqQC, error) {
+	c := NewFqQCCollector(o)
+	for f, e := range it {
+		if e != nil {
+			return FqQC{}, e
+		}
+		c.Add(ToFqEntry(f))
+	}
+	return c.Report(), nil
+}
+
+type FqQCFlags struct {
+	Html        string
+	Title       string
+	DupReads    int64
+	OverrepFrac float64
+}
+
+func FullFqQC() {
+	var f FqQCFlags
+	flag.StringVar(&f.Html, "html", "", "Also write an HTML report to this path")
+	flag.StringVar(&f.Title, "title", "stdin", "Title of the HTML report")
+	flag.Int64Var(&f.DupReads, "d", 200000, "Reads sampled for duplication and overrepresented sequences (0 for all)")
+	flag.Float64Var(&f.OverrepFrac, "o", 0.001, "Fraction of sampled reads above which a sequence is overrepresented")
+	flag.Parse()
+
+	o := DefaultFqQCOptions()
+	o.DupReads = f.DupReads
+	o.OverrepFrac = f.OverrepFrac
+	qc, e := FastqQC(ParseFastq(os.Stdin), o)
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	if f.Html != "" {
+		w, e := os.Create(f.Html)
+		if e != nil {
+			log.Fatal(e)
+		}
+		if e := WriteFqQCHtml(w, f.Title, qc); e != nil {
+			log.Fatal(e)
+		}
+		if e := w.Close(); e != nil {
+			log.Fatal(e)
+		}
+	}
+
+	if e := WriteFqQCJson(os.Stdout, qc); e != nil {
+		log.Fatal(e)
+	}
+}
+
+func WriteFqQCJson(w io.Writer, qc FqQC) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(qc)
+}
@@ -0,0 +1,79 @@
+package fastats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fqQCInput = `@r1
+ACGT
++
+!+5?
+@r2
+ACGT
++
+++++
+@r3
+GGNA
++
+5555
+@r4
+CC
++
+??
+`
+
+func TestFastqQC(t *testing.T) {
+	o := FqQCOptions{DupReads: 3, OverrepFrac: 0.5}
+	qc, e := FastqQC(ParseFastq(strings.NewReader(fqQCInput)), o)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if qc.Reads != 4 || qc.Bases != 14 || qc.NBases != 1 || qc.NReads != 1 {
+		t.Errorf("counts wrong: %+v", qc)
+	}
+	if qc.MinLen != 2 || qc.MaxLen != 4 || qc.MeanLen != 3.5 {
+		t.Errorf("lengths wrong: %v %v %v", qc.MinLen, qc.MaxLen, qc.MeanLen)
+	}
+	if want := []LenCount{{2, 1}, {4, 3}}; !reflect.DeepEqual(qc.LenHist, want) {
+		t.Errorf("LenHist %v != %v", qc.LenHist, want)
+	}
+
+	// Position 0 has scores 0, 10, 20 and 30.
+	if want := (PosQual{0, 15, 0, 0, 10, 20, 30}); qc.PosQuals[0] != want {
+		t.Errorf("PosQuals[0] %+v != %+v", qc.PosQuals[0], want)
+	}
+	if len(qc.PosQuals) != 4 {
+		t.Errorf("len(PosQuals) %v != 4", len(qc.PosQuals))
+	}
+	if want := (PosBases{Pos: 2, G: 2.0 / 3, N: 1.0 / 3}); qc.PosBases[2] != want {
+		t.Errorf("PosBases[2] %+v != %+v", qc.PosBases[2], want)
+	}
+
+	// ACGT twice at 50%, GGNA at 67% and CC at 100%.
+	if qc.GCHist[50] != 2 || qc.GCHist[67] != 1 || qc.GCHist[100] != 1 {
+		t.Errorf("GCHist wrong: %v", qc.GCHist)
+	}
+
+	// Only the first three reads are sampled.
+	if qc.DupSampled != 3 || qc.DedupFrac != 2.0/3 {
+		t.Errorf("duplication wrong: %v %v", qc.DupSampled, qc.DedupFrac)
+	}
+	if l := qc.DupLevels[1]; l.Level != "2" || l.SeqFrac != 0.5 || l.ReadFrac != 2.0/3 {
+		t.Errorf("DupLevels[1] %+v", l)
+	}
+	if want := []OverrepSeq{{"ACGT", 2, 2.0 / 3}}; !reflect.DeepEqual(qc.Overrep, want) {
+		t.Errorf("Overrep %v != %v", qc.Overrep, want)
+	}
+
+	var b strings.Builder
+	if e := WriteFqQCHtml(&b, "<reads>", qc); e != nil {
+		t.Fatal(e)
+	}
+	h := b.String()
+	if strings.Count(h, "<svg") != 5 || !strings.Contains(h, "&lt;reads&gt;") || strings.Contains(h, "<script") {
+		t.Errorf("bad HTML report")
+	}
+}
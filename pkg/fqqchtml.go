@@ -0,0 +1,258 @@
+package fastats
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// A minimal SVG plot with linear axes, for reports that must not depend on
+// scripts or files other than themselves.
+type svgPlot struct {
+	b                        strings.Builder
+	w, h                     float64
+	left, right, top, bottom float64
+	x0, x1, y0, y1           float64
+}
+
+func newSvgPlot(x0, x1, y0, y1 float64) *svgPlot {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	p := &svgPlot{w: 800, h: 300, left: 60, right: 20, top: 20, bottom: 45, x0: x0, x1: x1, y0: y0, y1: y1}
+	fmt.Fprintf(&p.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v">`, p.w, p.h, p.w, p.h)
+	return p
+}
+
+func (p *svgPlot) X(x float64) float64 {
+	return p.left + (x-p.x0)/(p.x1-p.x0)*(p.w-p.left-p.right)
+}
+
+func (p *svgPlot) Y(y float64) float64 {
+	return p.h - p.bottom - (y-p.y0)/(p.y1-p.y0)*(p.h-p.top-p.bottom)
+}
+
+func (p *svgPlot) Rect(x0, y0, x1, y1 float64, fill string) {
+	fmt.Fprintf(&p.b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%v"/>`,
+		p.X(x0), p.Y(y1), p.X(x1)-p.X(x0), p.Y(y0)-p.Y(y1), fill)
+}
+
+func (p *svgPlot) Segment(x0, y0, x1, y1 float64, stroke string) {
+	fmt.Fprintf(&p.b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="%v"/>`, p.X(x0), p.Y(y0), p.X(x1), p.Y(y1), stroke)
+}
+
+func (p *svgPlot) Line(xs, ys []float64, stroke string) {
+	fmt.Fprintf(&p.b, `<polyline fill="none" stroke="%v" stroke-width="1.5" points="`, stroke)
+	for i := range xs {
+		fmt.Fprintf(&p.b, "%.2f,%.2f ", p.X(xs[i]), p.Y(ys[i]))
+	}
+	p.b.WriteString(`"/>`)
+}
+
+func (p *svgPlot) Text(x, y float64, anchor, text string) {
+	fmt.Fprintf(&p.b, `<text x="%.2f" y="%.2f" font-size="11" text-anchor="%v">%v</text>`, x, y, anchor, html.EscapeString(text))
+}
+
+// Axes with evenly spaced ticks. xticks may name the ticks at 0, 1, 2...
+// instead.
+func (p *svgPlot) Axes(xlabel, ylabel string, xticks []string) {
+	p.Segment(p.x0, p.y0, p.x1, p.y0, "black")
+	p.Segment(p.x0, p.y0, p.x0, p.y1, "black")
+	for i := 0; i <= 5; i++ {
+		y := p.y0 + float64(i)*(p.y1-p.y0)/5
+		p.Text(p.left-5, p.Y(y)+4, "end", fmt.Sprintf("%.3g", y))
+	}
+	if xticks != nil {
+		for i, t := range xticks {
+			p.Text(p.X(float64(i)), p.h-p.bottom+15, "middle", t)
+		}
+	} else {
+		for i := 0; i <= 10; i++ {
+			x := p.x0 + float64(i)*(p.x1-p.x0)/10
+			p.Text(p.X(x), p.h-p.bottom+15, "middle", fmt.Sprintf("%.4g", x))
+		}
+	}
+	p.Text((p.left+p.w-p.right)/2, p.h-5, "middle", xlabel)
+	fmt.Fprintf(&p.b, `<text x="15" y="%.2f" font-size="11" text-anchor="middle" transform="rotate(-90 15 %.2f)">%v</text>`,
+		p.h/2, p.h/2, html.EscapeString(ylabel))
+}
+
+func (p *svgPlot) Legend(names, colors []string) {
+	for i, name := range names {
+		y := p.top + 5 + float64(i)*15
+		fmt.Fprintf(&p.b, `<rect x="%.2f" y="%.2f" width="10" height="10" fill="%v"/>`, p.w-p.right-80, y, colors[i])
+		p.Text(p.w-p.right-65, y+9, "start", name)
+	}
+}
+
+func (p *svgPlot) HTML() template.HTML {
+	return template.HTML(p.b.String() + "</svg>")
+}
+
+var baseColors = []string{"#2ca02c", "#1f77b4", "#222222", "#d62728", "#9467bd"}
+
+func qualPlot(pq []PosQual) template.HTML {
+	top := 41.0
+	for _, q := range pq {
+		top = max(top, float64(q.P90+1))
+	}
+	p := newSvgPlot(0.5, float64(len(pq))+0.5, 0, top)
+	p.Rect(p.x0, 28, p.x1, top, "#e6f5e6")
+	p.Rect(p.x0, 20, p.x1, 28, "#fbf5dc")
+	p.Rect(p.x0, 0, p.x1, 20, "#f8e1e1")
+	var xs, means []float64
+	for _, q := range pq {
+		x := float64(q.Pos + 1)
+		p.Segment(x, float64(q.P10), x, float64(q.P90), "black")
+		p.Rect(x-0.35, float64(q.Q1), x+0.35, float64(q.Q3), "#f2d94e")
+		p.Segment(x-0.35, float64(q.Median), x+0.35, float64(q.Median), "#d62728")
+		xs = append(xs, x)
+		means = append(means, q.Mean)
+	}
+	p.Line(xs, means, "#1f77b4")
+	p.Axes("Position in read (bp)", "Phred score", nil)
+	return p.HTML()
+}
+
+func basesPlot(pb []PosBases) template.HTML {
+	p := newSvgPlot(1, float64(len(pb)), 0, 100)
+	series := make([][]float64, 5)
+	var xs []float64
+	for _, b := range pb {
+		xs = append(xs, float64(b.Pos+1))
+		for i, f := range []float64{b.A, b.C, b.G, b.T, b.N} {
+			series[i] = append(series[i], 100*f)
+		}
+	}
+	for i, s := range series {
+		p.Line(xs, s, baseColors[i])
+	}
+	p.Axes("Position in read (bp)", "Percent of bases", nil)
+	p.Legend([]string{"A", "C", "G", "T", "N"}, baseColors)
+	return p.HTML()
+}
+
+func gcPlot(hist []int64) template.HTML {
+	var xs, ys []float64
+	top := 0.0
+	for gc, n := range hist {
+		xs = append(xs, float64(gc))
+		ys = append(ys, float64(n))
+		top = max(top, float64(n))
+	}
+	p := newSvgPlot(0, 100, 0, top)
+	p.Line(xs, ys, "#d62728")
+	p.Axes("GC content (%)", "Reads", nil)
+	return p.HTML()
+}
+
+func lenPlot(hist []LenCount) template.HTML {
+	var xs, ys []float64
+	top := 0.0
+	for _, l := range hist {
+		xs = append(xs, float64(l.Len))
+		ys = append(ys, float64(l.Count))
+		top = max(top, float64(l.Count))
+	}
+	x0, x1 := 0.0, 1.0
+	if len(xs) > 0 {
+		x0, x1 = xs[0]-1, xs[len(xs)-1]+1
+	}
+	p := newSvgPlot(x0, x1, 0, top)
+	for i := range xs {
+		p.Segment(xs[i], 0, xs[i], ys[i], "#1f77b4")
+	}
+	p.Line(xs, ys, "#1f77b4")
+	p.Axes("Read length (bp)", "Reads", nil)
+	return p.HTML()
+}
+
+func dupPlot(levels []DupLevel) template.HTML {
+	p := newSvgPlot(-0.5, float64(len(levels))-0.5, 0, 100)
+	var xs, reads, seqs []float64
+	var labels []string
+	for i, l := range levels {
+		xs = append(xs, float64(i))
+		reads = append(reads, 100*l.ReadFrac)
+		seqs = append(seqs, 100*l.SeqFrac)
+		labels = append(labels, l.Level)
+	}
+	p.Line(xs, reads, "#d62728")
+	p.Line(xs, seqs, "#1f77b4")
+	p.Axes("Times a sequence is seen", "Percent", labels)
+	p.Legend([]string{"reads", "sequences"}, []string{"#d62728", "#1f77b4"})
+	return p.HTML()
+}
+
+const fqQCTemplateText = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>FASTQ QC: {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: right; }
+td.seq { font-family: monospace; text-align: left; }
+</style>
+</head>
+<body>
+<h1>FASTQ QC: {{.Title}}</h1>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Reads</th><td>{{.QC.Reads}}</td></tr>
+<tr><th>Bases</th><td>{{.QC.Bases}}</td></tr>
+<tr><th>Read length</th><td>{{.QC.MinLen}}&ndash;{{.QC.MaxLen}} (mean {{printf "%.1f" .QC.MeanLen}})</td></tr>
+<tr><th>GC</th><td>{{printf "%.2f" (pct .QC.GCFrac)}}%</td></tr>
+<tr><th>N bases</th><td>{{.QC.NBases}}</td></tr>
+<tr><th>Reads with N</th><td>{{.QC.NReads}}</td></tr>
+<tr><th>Reads left after deduplication</th><td>{{printf "%.2f" (pct .QC.DedupFrac)}}% of {{.QC.DupSampled}} sampled</td></tr>
+</table>
+
+<h2>Quality per position</h2>
+<p>Boxes span the quartiles, whiskers the 10th to 90th percentiles; red marks the median and blue the mean.</p>
+{{.Qual}}
+
+<h2>Base composition per position</h2>
+{{.Bases}}
+
+<h2>GC content per read</h2>
+{{.GC}}
+
+<h2>Read lengths</h2>
+{{.Len}}
+
+<h2>Duplication levels</h2>
+{{.Dup}}
+
+<h2>Overrepresented sequences</h2>
+{{if .QC.Overrep}}
+<table>
+<tr><th>Sequence</th><th>Count</th><th>Percent</th></tr>
+{{range .QC.Overrep}}<tr><td class="seq">{{.Seq}}</td><td>{{.Count}}</td><td>{{printf "%.3f" (pct .Frac)}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>None.</p>
+{{end}}
+</body>
+</html>
+`
+
+var fqQCTemplate = template.Must(template.New("fqqc").Funcs(template.FuncMap{
+	"pct": func(f float64) float64 { return 100 * f },
+}).Parse(fqQCTemplateText))
+
+// Write qc as one HTML file with inline SVG plots.
+func WriteFqQCHtml(w io.Writer, title string, qc FqQC) error {
+	return fqQCTemplate.Execute(w, struct {
+		Title                     string
+		QC                        FqQC
+		Qual, Bases, GC, Len, Dup template.HTML
+	}{title, qc, qualPlot(qc.PosQuals), basesPlot(qc.PosBases), gcPlot(qc.GCHist), lenPlot(qc.LenHist), dupPlot(qc.DupLevels)})
+}
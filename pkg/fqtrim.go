@@ -0,0 +1,401 @@
+package fastats
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+// The start of the Illumina TruSeq and Nextera adapters.
+const (
+	TruSeqAdapter  = "AGATCGGAAGAGC"
+	NexteraAdapter = "CTGTCTCTTATACACATCT"
+)
+
+type FqTrimOptions struct {
+	// Adapters to cut at, with everything after them
+	Adapters []string
+	// Mismatches allowed per base of adapter overlap
+	AdapterMismatchRate float64
+	// Shortest adapter prefix matched at the 3' end of a read
+	MinAdapterOverlap int
+	// Shortest poly-G or poly-A tail trimmed; 0 to keep them. One mismatch is
+	// allowed per 8 bases of tail.
+	PolyG int
+	PolyA int
+	// Sliding window quality trimming; Window 0 to skip
+	Window  int
+	MinQual int
+	// Reads, or pairs with either read, shorter than this after trimming are
+	// dropped
+	MinLen int
+}
+
+func DefaultFqTrimOptions() FqTrimOptions {
+	return FqTrimOptions{
+		Adapters:            []string{TruSeqAdapter},
+		AdapterMismatchRate: 0.1,
+		MinAdapterOverlap:   3,
+		PolyG:               10,
+		Window:              4,
+		MinQual:             20,
+		MinLen:              15,
+	}
+}
+
+// Bases trimmed from one read, by cause.
+type FqTrimResult struct {
+	AdapterBp int
+	PolyGBp   int
+	PolyABp   int
+	QualBp    int
+}
+
+// Totals over a trimming run. Reads are counted singly, so a pair counts as
+// two reads.
+type FqTrimSummary struct {
+	ReadsIn          int64
+	ReadsOut         int64
+	BasesIn          int64
+	BasesOut         int64
+	PairsIn          int64 `json:",omitempty"`
+	PairsOut         int64 `json:",omitempty"`
+	ReadsWithAdapter int64
+	AdapterBp        int64
+	PolyGBp          int64
+	PolyABp          int64
+	QualBp           int64
+	TooShort         int64
+}
+
+func (s *FqTrimSummary) add(in FqEntry, r FqTrimResult) {
+	s.ReadsIn++
+	s.BasesIn += int64(len(in.Seq))
+	if r.AdapterBp > 0 {
+		s.ReadsWithAdapter++
+	}
+	s.AdapterBp += int64(r.AdapterBp)
+	s.PolyGBp += int64(r.PolyGBp)
+	s.PolyABp += int64(r.PolyABp)
+	s.QualBp += int64(r.QualBp)
+}
+
+func (s *FqTrimSummary) keep(f FqEntry) {
+	s.ReadsOut++
+	s.BasesOut += int64(len(f.Seq))
+}
+
+func baseEq(a, b byte) bool {
+	return a == b || a == b+'a'-'A' || a+'a'-'A' == b
+}
+
+// The start of the first match of adapter in seq, allowing mismatchRate
+// mismatches per base compared, and allowing a prefix of the adapter at least
+// minOverlap long to hang off the 3' end. len(seq) if there is none.
+func FindAdapter(seq, adapter string, mismatchRate float64, minOverlap int) int {
+	minOverlap = max(1, min(minOverlap, len(adapter)))
+	for i := 0; i+minOverlap <= len(seq); i++ {
+		n := min(len(adapter), len(seq)-i)
+		allowed := int(mismatchRate * float64(n))
+		mism := 0
+		for j := 0; j < n && mism <= allowed; j++ {
+			if !baseEq(seq[i+j], adapter[j]) {
+				mism++
+			}
+		}
+		if mism <= allowed {
+			return i
+		}
+	}
+	return len(seq)
+}
+
+// The start of a 3' tail of base at least minLen long, allowing one mismatch
+// per 8 bases, or len(seq) if there is none.
+func PolyXTail(seq string, base byte, minLen int) int {
+	if minLen < 1 {
+		return len(seq)
+	}
+	start := len(seq)
+	mism := 0
+	for i := len(seq) - 1; i >= 0; i-- {
+		if baseEq(seq[i], base) {
+			start = i
+			continue
+		}
+		mism++
+		if mism > (len(seq)-i)/8 {
+			break
+		}
+	}
+	if len(seq)-start < minLen {
+		return len(seq)
+	}
+	return start
+}
+
+// The end of the read after sliding window trimming: the read is cut at the
+// first window whose mean error probability, by QualScore, is above that of
+// minQual, keeping the bases at the start of that window that pass minQual.
+func QualWindowEnd(qual string, window, minQual int) int {
+	if window < 1 || len(qual) == 0 {
+		return len(qual)
+	}
+	window = min(window, len(qual))
+	cutoff := QualScore(QualToAscii(int64(minQual)))
+	sum := 0.0
+	for i := 0; i < window; i++ {
+		sum += QualScore(qual[i])
+	}
+	for start := 0; ; start++ {
+		if sum/float64(window) > cutoff {
+			end := start
+			for end < len(qual) && int(qual[end])-33 >= minQual {
+				end++
+			}
+			return end
+		}
+		if start+window >= len(qual) {
+			return len(qual)
+		}
+		sum += QualScore(qual[start+window]) - QualScore(qual[start])
+	}
+}
+
+func cutFq(f FqEntry, end int) FqEntry {
+	f.Seq = f.Seq[:end]
+	if len(f.Qual) > end {
+		f.Qual = f.Qual[:end]
+	}
+	return f
+}
+
+// Trim one read: adapters first, then poly-G and poly-A tails, then low
+// quality bases.
+func TrimFq(f FqEntry, o FqTrimOptions) (FqEntry, FqTrimResult) {
+	var r FqTrimResult
+	end := len(f.Seq)
+	for _, a := range o.Adapters {
+		end = min(end, FindAdapter(f.Seq[:end], a, o.AdapterMismatchRate, o.MinAdapterOverlap))
+	}
+	r.AdapterBp = len(f.Seq) - end
+	f = cutFq(f, end)
+
+	end = PolyXTail(f.Seq, 'G', o.PolyG)
+	r.PolyGBp = len(f.Seq) - end
+	f = cutFq(f, end)
+
+	end = PolyXTail(f.Seq, 'A', o.PolyA)
+	r.PolyABp = len(f.Seq) - end
+	f = cutFq(f, end)
+
+	end = QualWindowEnd(f.Qual, o.Window, o.MinQual)
+	r.QualBp = len(f.Seq) - min(end, len(f.Seq))
+	f = cutFq(f, min(end, len(f.Seq)))
+	return f, r
+}
+
+// Trim single-end reads, dropping those shorter than o.MinLen. Totals are
+// added to sum, which may be nil.
+func TrimFastq[F FqEnter](it iter.Seq2[F, error], o FqTrimOptions, sum *FqTrimSummary) iter.Seq2[FqEntry, error] {
+	if sum == nil {
+		sum = &FqTrimSummary{}
+	}
+	return func(yield func(FqEntry, error) bool) {
+		for f, e := range it {
+			if e != nil {
+				yield(FqEntry{}, e)
+				return
+			}
+			in := ToFqEntry(f)
+			out, r := TrimFq(in, o)
+			sum.add(in, r)
+			if len(out.Seq) < o.MinLen {
+				sum.TooShort++
+				continue
+			}
+			sum.keep(out)
+			if !yield(out, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Trim pairs, dropping both mates if either is shorter than o.MinLen.
+func TrimFastqPairs(it iter.Seq2[Tuple2[FqEntry, FqEntry], error], o FqTrimOptions, sum *FqTrimSummary) iter.Seq2[Tuple2[FqEntry, FqEntry], error] {
+	if sum == nil {
+		sum = &FqTrimSummary{}
+	}
+	return func(yield func(Tuple2[FqEntry, FqEntry], error) bool) {
+		for pair, e := range it {
+			if e != nil {
+				yield(Tuple2[FqEntry, FqEntry]{}, e)
+				return
+			}
+			sum.PairsIn++
+			out1, r1 := TrimFq(pair.V1, o)
+			out2, r2 := TrimFq(pair.V2, o)
+			sum.add(pair.V1, r1)
+			sum.add(pair.V2, r2)
+			if len(out1.Seq) < o.MinLen || len(out2.Seq) < o.MinLen {
+				sum.TooShort += 2
+				continue
+			}
+			sum.PairsOut++
+			sum.keep(out1)
+			sum.keep(out2)
+			if !yield(Tuple2[FqEntry, FqEntry]{out1, out2}, nil) {
+				return
+			}
+		}
+	}
+}
+
+type FqTrimFlags struct {
+	R1          string
+	R2          string
+	Out1        string
+	Out2        string
+	Interleaved bool
+	Adapters    string
+	Mismatch    float64
+	Overlap     int
+	PolyG       int
+	PolyA       int
+	Window      int
+	MinQual     int
+	MinLen      int
+	Summary     string
+}
+
+func FullFqTrim() {
+	var f FqTrimFlags
+	flag.StringVar(&f.R1, "1", "", "R1 or single-end fastq to read instead of stdin")
+	flag.StringVar(&f.R2, "2", "", "R2 fastq, for paired-end input")
+	flag.StringVar(&f.Out1, "o1", "", "Output for R1 or single-end reads instead of stdout")
+	flag.StringVar(&f.Out2, "o2", "", "Output for R2 (required with -2)")
+	flag.BoolVar(&f.Interleaved, "i", false, "Input and output are interleaved pairs")
+	flag.StringVar(&f.Adapters, "a", TruSeqAdapter, "Comma-separated adapter sequences")
+	flag.Float64Var(&f.Mismatch, "e", 0.1, "Adapter mismatches allowed per base")
+	flag.IntVar(&f.Overlap, "O", 3, "Shortest adapter overlap at the 3' end")
+	flag.IntVar(&f.PolyG, "g", 10, "Shortest poly-G tail to trim (0 to keep)")
+	flag.IntVar(&f.PolyA, "A", 0, "Shortest poly-A tail to trim (0 to keep)")
+	flag.IntVar(&f.Window, "w", 4, "Quality window size (0 to skip quality trimming)")
+	flag.IntVar(&f.MinQual, "q", 20, "Lowest mean phred score of a quality window")
+	flag.IntVar(&f.MinLen, "l", 15, "Shortest read to keep")
+	flag.StringVar(&f.Summary, "s", "", "Write the JSON summary here instead of stderr")
+	flag.Parse()
+
+	o := FqTrimOptions{
+		AdapterMismatchRate: f.Mismatch,
+		MinAdapterOverlap:   f.Overlap,
+		PolyG:               f.PolyG,
+		PolyA:               f.PolyA,
+		Window:              f.Window,
+		MinQual:             f.MinQual,
+		MinLen:              f.MinLen,
+	}
+	for _, a := range strings.Split(f.Adapters, ",") {
+		if a != "" {
+			o.Adapters = append(o.Adapters, a)
+		}
+	}
+	if f.R2 != "" && f.Out2 == "" {
+		log.Fatal("-2 needs -o2")
+	}
+
+	var sum FqTrimSummary
+	if e := runFqTrim(f, o, &sum); e != nil {
+		log.Fatal(e)
+	}
+
+	var sw io.Writer = os.Stderr
+	if f.Summary != "" {
+		w, e := os.Create(f.Summary)
+		if e != nil {
+			log.Fatal(e)
+		}
+		defer func() { Must(w.Close()) }()
+		sw = w
+	}
+	enc := json.NewEncoder(sw)
+	enc.SetIndent("", "\t")
+	if e := enc.Encode(sum); e != nil {
+		log.Fatal(e)
+	}
+}
+
+func openFqInput(path string) (io.ReadCloser, error) {
+	if path == "" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return zfile.Open(path)
+}
+
+// A buffered writer to path, or to stdout if path is "". close flushes it.
+func createFqOutput(path string) (w *bufio.Writer, close func() error, err error) {
+	if path == "" {
+		w = bufio.NewWriter(os.Stdout)
+		return w, w.Flush, nil
+	}
+	zw, e := zfile.Create(path)
+	if e != nil {
+		return nil, nil, e
+	}
+	w = bufio.NewWriter(zw)
+	return w, func() error {
+		if e := w.Flush(); e != nil {
+			zw.Close()
+			return e
+		}
+		return zw.Close()
+	}, nil
+}
+
+func runFqTrim(f FqTrimFlags, o FqTrimOptions, sum *FqTrimSummary) error {
+	r1, e := openFqInput(f.R1)
+	if e != nil {
+		return e
+	}
+	defer r1.Close()
+	w1, close1, e := createFqOutput(f.Out1)
+	if e != nil {
+		return e
+	}
+
+	switch {
+	case f.R2 != "":
+		r2, e := zfile.Open(f.R2)
+		if e != nil {
+			return e
+		}
+		defer r2.Close()
+		w2, close2, e := createFqOutput(f.Out2)
+		if e != nil {
+			return e
+		}
+		if e := WriteFqPairs(w1, w2, TrimFastqPairs(ParseFastqPairs(r1, r2), o, sum)); e != nil {
+			return e
+		}
+		if e := close2(); e != nil {
+			return e
+		}
+	case f.Interleaved:
+		if e := WriteInterleavedFq(w1, TrimFastqPairs(ParseInterleavedFastq(r1), o, sum)); e != nil {
+			return e
+		}
+	default:
+		if e := WriteFq(w1, TrimFastq(ParseFastq(r1), o, sum)); e != nil {
+			return e
+		}
+	}
+	return close1()
+}
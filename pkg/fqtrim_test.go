@@ -0,0 +1,102 @@
+package fastats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindAdapter(t *testing.T) {
+	tests := []struct {
+		seq  string
+		rate float64
+		want int
+	}{
+		{"CCCCAGATCGGAAGAGCTT", 0, 4},
+		{"CCCCAGATCGGTAGAGCTT", 0, 19},
+		{"CCCCAGATCGGTAGAGCTT", 0.1, 4},
+		{"CCCCCCCCAGAT", 0, 8},
+		{"CCCCCCCCCCAG", 0, 12},
+		{"ccccagatcggaagagc", 0, 4},
+	}
+	for _, test := range tests {
+		if got := FindAdapter(test.seq, TruSeqAdapter, test.rate, 3); got != test.want {
+			t.Errorf("FindAdapter(%q, %v) %v != %v", test.seq, test.rate, got, test.want)
+		}
+	}
+}
+
+func TestPolyXTail(t *testing.T) {
+	tests := []struct {
+		seq  string
+		want int
+	}{
+		{"ACATTTGGGGGGGAGGGGGGGG", 6},
+		{"ACGTGGGGAGGGGG", 9},
+		{"ACGTGGGGGC", 10},
+		{"ACGTGGGG", 8},
+	}
+	for _, test := range tests {
+		if got := PolyXTail(test.seq, 'G', 5); got != test.want {
+			t.Errorf("PolyXTail(%q) %v != %v", test.seq, got, test.want)
+		}
+	}
+}
+
+func TestQualWindowEnd(t *testing.T) {
+	tests := []struct {
+		qual string
+		want int
+	}{
+		{"IIIIIIII", 8},
+		{"IIIII###", 5},
+		{"IIII5#II", 5},
+		{"####", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := QualWindowEnd(test.qual, 4, 20); got != test.want {
+			t.Errorf("QualWindowEnd(%q) %v != %v", test.qual, got, test.want)
+		}
+	}
+}
+
+func TestTrimFastqPairs(t *testing.T) {
+	r1 := "@a/1\nACGTACGTACAGATCGGAAG\n+\nIIIIIIIIIIIIIIIIIIII\n" +
+		"@b/1\nACGTACGTACGTACGTACGT\n+\nIIIIIIIIIIIIIIIIIIII\n"
+	r2 := "@a/2\nTTTTTTTTTTTTTTTGGGGG\n+\nIIIIIIIIIIIIIIIIIIII\n" +
+		"@b/2\nACGTACGTAC##########\n+\nIIIIIIIIII##########\n"
+	o := DefaultFqTrimOptions()
+	o.PolyG = 5
+	o.MinLen = 10
+
+	var sum FqTrimSummary
+	pairs, e := CollectErr(TrimFastqPairs(ParseFastqPairs(strings.NewReader(r1), strings.NewReader(r2)), o, &sum))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(pairs) != 2 {
+		t.Fatalf("len(pairs) %v != 2", len(pairs))
+	}
+	if p := pairs[0]; p.V1.Seq != "ACGTACGTAC" || p.V1.Qual != "IIIIIIIIII" || p.V2.Seq != "TTTTTTTTTTTTTTT" {
+		t.Errorf("pair a %+v", p)
+	}
+	if p := pairs[1]; len(p.V1.Seq) != 20 || p.V2.Seq != "ACGTACGTAC" {
+		t.Errorf("pair b %+v", p)
+	}
+
+	want := FqTrimSummary{
+		ReadsIn: 4, ReadsOut: 4, BasesIn: 80, BasesOut: 55, PairsIn: 2, PairsOut: 2,
+		ReadsWithAdapter: 1, AdapterBp: 10, PolyGBp: 5, QualBp: 10,
+	}
+	if sum != want {
+		t.Errorf("summary %+v != %+v", sum, want)
+	}
+
+	// Raising the minimum length drops pair b together.
+	o.MinLen = 12
+	sum = FqTrimSummary{}
+	pairs, _ = CollectErr(TrimFastqPairs(ParseFastqPairs(strings.NewReader(r1), strings.NewReader(r2)), o, &sum))
+	if len(pairs) != 0 || sum.TooShort != 4 || sum.PairsOut != 0 {
+		t.Errorf("pairs %v, summary %+v", pairs, sum)
+	}
+}
@@ -0,0 +1,28 @@
+package fastats
+
+import (
+	"fmt"
+	"io"
+	"iter"
+)
+
+func WriteFqEntries[F FqEnter](w io.Writer, fs ...F) error {
+	for _, f := range fs {
+		if _, e := fmt.Fprintf(w, "@%s\n%s\n+\n%s\n", f.FaHeader(), f.FaSeq(), f.FqQual()); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func WriteFq[F FqEnter](w io.Writer, it iter.Seq2[F, error]) error {
+	for f, e := range it {
+		if e != nil {
+			return e
+		}
+		if e := WriteFqEntries(w, f); e != nil {
+			return e
+		}
+	}
+	return nil
+}
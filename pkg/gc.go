@@ -9,34 +9,10 @@ import (
 	"os"
 )
 
+// The GC fraction of seq, counting IUPAC ambiguity codes as in GCCount.
 func GCFrac(seq string) float64 {
-	gcCount := 0.0
-	bpCount := 0.0
-	for _, c := range []byte(seq) {
-		switch c {
-		case 'g':
-			fallthrough
-		case 'G':
-			fallthrough
-		case 'c':
-			fallthrough
-		case 'C':
-			gcCount++
-			fallthrough
-		case 'a':
-			fallthrough
-		case 'A':
-			fallthrough
-		case 't':
-			fallthrough
-		case 'T':
-			bpCount++
-		case 'n':
-		case 'N':
-		default:
-		}
-	}
-	return gcCount / bpCount
+	gc, bp := GCCount(seq)
+	return gc / bp
 }
 
 func GCIter[B BedEnter[string]](views iter.Seq2[B, error]) iter.Seq2[BedEntry[float64], error] {
@@ -67,14 +43,39 @@ func WriteGC[B BedEnter[float64]](w io.Writer, it iter.Seq2[B, error]) (n int, e
 func RunGC() {
 	sizep := flag.Int("size", 1, "Window size")
 	stepp := flag.Int("step", 1, "Window step distance")
+	fapathp := flag.String("f", "", "Fasta with a .fai index (see faidx) to read instead of stdin")
+	genomep := flag.String("g", "", "Genome file of chromosome lengths; window these chromosomes, with NaN past the end of the fasta")
 	flag.Parse()
 
-	r := bufio.NewReader(os.Stdin)
+	var genome []FaLen
+	if *genomep != "" {
+		var e error
+		if genome, e = ReadGenomeFilePath(*genomep); e != nil {
+			panic(e)
+		}
+	}
+
 	w := bufio.NewWriter(os.Stdout)
 	defer w.Flush()
 
-	fait := ParseFasta(r)
-	wins := FaWins(fait, int64(*sizep), int64(*stepp))
+	var wins iter.Seq2[BedEntry[string], error]
+	if *fapathp != "" {
+		fa, e := OpenFastaIndexed(*fapathp, false)
+		if e != nil {
+			panic(e)
+		}
+		defer fa.Close()
+		wins = FaWinsIndexed(fa.FastaIndexedReader, int64(*sizep), int64(*stepp))
+		if genome != nil {
+			wins = FaWinsIndexedGenome(fa.FastaIndexedReader, genome, int64(*sizep), int64(*stepp))
+		}
+	} else {
+		fait := ParseFasta(bufio.NewReader(os.Stdin))
+		wins = FaWins(fait, int64(*sizep), int64(*stepp))
+		if genome != nil {
+			wins = FaWinsGenome(fait, genome, int64(*sizep), int64(*stepp))
+		}
+	}
 	gc := GCIter(wins)
 
 	_, e := WriteGC(w, gc)
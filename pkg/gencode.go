@@ -0,0 +1,132 @@
+package fastats
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// An NCBI genetic code table. AAs and Starts list the 64 codons in the NCBI
+// order, TTT, TTC, TTA, TTG, TCT and so on with bases in the order TCAG.
+type GeneticCode struct {
+	ID     int
+	Name   string
+	AAs    string
+	Starts string
+}
+
+var GeneticCodes = []GeneticCode{
+	{1, "Standard", "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------**--*----M---------------M----------------------------"},
+	{2, "Vertebrate Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSS**VVVVAAAADDEEGGGG", "----------**--------------------MMMM----------**---M------------"},
+	{3, "Yeast Mitochondrial", "FFLLSSSSYY**CCWWTTTTPPPPHHQQRRRRIIMMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**----------------------MM----------------------------"},
+	{4, "Mold, Protozoan, and Coelenterate Mitochondrial; Mycoplasma; Spiroplasma", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--MM------**-------M------------MMMM---------------M------------"},
+	{5, "Invertebrate Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSSSVVVVAAAADDEEGGGG", "---M------**--------------------MMMM---------------M------------"},
+	{6, "Ciliate, Dasycladacean and Hexamita Nuclear", "FFLLSSSSYYQQCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	{9, "Echinoderm and Flatworm Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG", "----------**-----------------------M---------------M------------"},
+	{10, "Euplotid Nuclear", "FFLLSSSSYY**CCCWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**-----------------------M----------------------------"},
+	{11, "Bacterial, Archaeal and Plant Plastid", "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------**--*----M------------MMMM---------------M------------"},
+	{12, "Alternative Yeast Nuclear", "FFLLSSSSYY**CC*WLLLSPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**--*----M---------------M----------------------------"},
+	{13, "Ascidian Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSGGVVVVAAAADDEEGGGG", "---M------**----------------------MM---------------M------------"},
+	{14, "Alternative Flatworm Mitochondrial", "FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG", "-----------*-----------------------M----------------------------"},
+	{16, "Chlorophycean Mitochondrial", "FFLLSSSSYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------*---*--------------------M----------------------------"},
+	{21, "Trematode Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNNKSSSSVVVVAAAADDEEGGGG", "----------**-----------------------M---------------M------------"},
+	{22, "Scenedesmus obliquus Mitochondrial", "FFLLSS*SYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "------*---*---*--------------------M----------------------------"},
+	{23, "Thraustochytrium Mitochondrial", "FF*LSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--*-------**--*-----------------M--M---------------M------------"},
+	{24, "Rhabdopleuridae Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG", "---M------**-------M---------------M---------------M------------"},
+	{25, "Candidate Division SR1 and Gracilibacteria", "FFLLSSSSYY**CCGWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------**-----------------------M---------------M------------"},
+	{26, "Pachysolen tannophilus Nuclear", "FFLLSSSSYY**CC*WLLLAPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**--*----M---------------M----------------------------"},
+	{27, "Karyorelict Nuclear", "FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	{28, "Condylostoma Nuclear", "FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**--*--------------------M----------------------------"},
+	{29, "Mesodinium Nuclear", "FFLLSSSSYYYYCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	{30, "Peritrich Nuclear", "FFLLSSSSYYEECC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	{31, "Blastocrithidia Nuclear", "FFLLSSSSYYEECCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**-----------------------M----------------------------"},
+	{33, "Cephalodiscidae Mitochondrial", "FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG", "---M-------*-------M---------------M---------------M------------"},
+}
+
+func GetGeneticCode(id int) (GeneticCode, error) {
+	i := slices.IndexFunc(GeneticCodes, func(g GeneticCode) bool { return g.ID == id })
+	if i < 0 {
+		return GeneticCode{}, fmt.Errorf("GetGeneticCode: no NCBI genetic code %v", id)
+	}
+	return GeneticCodes[i], nil
+}
+
+func codonBaseIndex(b byte) int {
+	switch b {
+	case 'T', 't', 'U', 'u':
+		return 0
+	case 'C', 'c':
+		return 1
+	case 'A', 'a':
+		return 2
+	case 'G', 'g':
+		return 3
+	}
+	return -1
+}
+
+// The index of a codon in AAs and Starts, or -1 if it has any base other
+// than ACGTU.
+func CodonIndex(codon string) int {
+	if len(codon) != 3 {
+		return -1
+	}
+	idx := 0
+	for i := 0; i < 3; i++ {
+		b := codonBaseIndex(codon[i])
+		if b < 0 {
+			return -1
+		}
+		idx = idx*4 + b
+	}
+	return idx
+}
+
+// The amino acid of one codon, '*' for a stop and 'X' for a codon that
+// cannot be translated. A codon with IUPAC ambiguity codes translates to the
+// amino acid all of its expansions agree on, or 'X' if they differ.
+func (g GeneticCode) Translate(codon string) byte {
+	if i := CodonIndex(codon); i >= 0 {
+		return g.AAs[i]
+	}
+	if len(codon) != 3 {
+		return 'X'
+	}
+	var aa byte
+	for _, b0 := range IUPACBases(codon[0]) {
+		for _, b1 := range IUPACBases(codon[1]) {
+			for _, b2 := range IUPACBases(codon[2]) {
+				x := g.AAs[CodonIndex(string([]rune{b0, b1, b2}))]
+				if aa != 0 && x != aa {
+					return 'X'
+				}
+				aa = x
+			}
+		}
+	}
+	if aa == 0 {
+		return 'X'
+	}
+	return aa
+}
+
+func (g GeneticCode) IsStart(codon string) bool {
+	i := CodonIndex(codon)
+	return i >= 0 && g.Starts[i] == 'M'
+}
+
+// Translate seq codon by codon, dropping an incomplete final codon. With
+// start set, an alternative start codon at the beginning is translated as M.
+func (g GeneticCode) TranslateSeq(seq string, start bool) string {
+	var b strings.Builder
+	b.Grow(len(seq) / 3)
+	for i := 0; i+3 <= len(seq); i += 3 {
+		codon := seq[i : i+3]
+		if i == 0 && start && g.IsStart(codon) {
+			b.WriteByte('M')
+			continue
+		}
+		b.WriteByte(g.Translate(codon))
+	}
+	return b.String()
+}
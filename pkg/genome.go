@@ -0,0 +1,207 @@
+package fastats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+func (l FaLen) SpanChr() string  { return l.Name }
+func (l FaLen) SpanStart() int64 { return 0 }
+func (l FaLen) SpanEnd() int64   { return l.Len }
+
+// Read a genome file of chromosome names and lengths, as in a bedtools
+// .genome, UCSC .chrom.sizes or samtools .fai file. Columns after the second
+// are ignored.
+func ParseGenomeFile(r io.Reader) iter.Seq2[FaLen, error] {
+	return func(yield func(FaLen, error) bool) {
+		s := bufio.NewScanner(r)
+		s.Buffer([]byte{}, 1e12)
+		for s.Scan() {
+			line := strings.TrimSuffix(s.Text(), "\r")
+			if len(line) < 1 || line[0] == '#' {
+				continue
+			}
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				if !yield(FaLen{}, fmt.Errorf("ParseGenomeFile: len(fields) %v < 2; line %q", len(fields), line)) {
+					return
+				}
+				continue
+			}
+			l, e := strconv.ParseInt(fields[1], 10, 64)
+			if e == nil && l < 0 {
+				e = fmt.Errorf("ParseGenomeFile: negative length in line %q", line)
+			}
+			if !yield(FaLen{Name: fields[0], Len: l}, e) {
+				return
+			}
+		}
+		if s.Err() != nil {
+			yield(FaLen{}, s.Err())
+		}
+	}
+}
+
+func ReadGenomeFilePath(path string) ([]FaLen, error) {
+	r, e := zfile.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer r.Close()
+	return CollectErr(ParseGenomeFile(r))
+}
+
+// Every window of every chromosome in the genome, in genome order. The last
+// windows of each chromosome are clamped to its end.
+func GenomeWins(genome []FaLen, size, step int64) iter.Seq[ChrSpan] {
+	return func(yield func(ChrSpan) bool) {
+		for _, l := range genome {
+			for s := range Wins(0, l.Len, size, step) {
+				if !yield(ChrSpan{l.Name, s}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func genomeLens(genome []FaLen) map[string]int64 {
+	lens := make(map[string]int64, len(genome))
+	for _, l := range genome {
+		lens[l.Name] = l.Len
+	}
+	return lens
+}
+
+// Like WindowSortedBed, but yields the full grid of GenomeWins, including
+// windows with no entries, with windows clamped to each chromosome's end.
+// Entries must be sorted by start within each chromosome and each chromosome
+// must be contiguous. Chromosomes come in input order, followed by the genome
+// chromosomes the input never reached. Entries past a chromosome's end are
+// dropped, and entries on chromosomes missing from the genome are an error.
+func WindowSortedBedGenome[B ChrSpanner](it iter.Seq2[B, error], genome []FaLen, winsize, winstep int) iter.Seq2[BedEntry[[]B], error] {
+	return func(yield func(BedEntry[[]B], error) bool) {
+		lens := genomeLens(genome)
+		done := map[string]bool{}
+		next, stop := iter.Pull2(it)
+		defer stop()
+		b, e, ok := next()
+
+		var d Deque[B]
+		out := BedEntry[[]B]{}
+		// Window every base of chr, consuming the entries on chr.
+		windowChr := func(chr string) bool {
+			l, inGenome := lens[chr]
+			if !inGenome {
+				yield(out, fmt.Errorf("WindowSortedBedGenome: chromosome %v not in genome", chr))
+				return false
+			}
+			done[chr] = true
+			for d.Len() > 0 {
+				d.PopFront()
+			}
+			last := int64(-1)
+			for s := range Wins(0, l, int64(winsize), int64(winstep)) {
+				win := ChrSpan{chr, s}
+				CheckAndPopMulti(win, &d)
+				for ok && e == nil && b.SpanChr() == chr && b.SpanStart() < win.End {
+					if b.SpanStart() < last {
+						yield(out, fmt.Errorf("WindowSortedBedGenome: input not sorted; %v after start %v", toChrSpan(b), last))
+						return false
+					}
+					last = b.SpanStart()
+					if b.SpanEnd() > win.Start {
+						d.PushBack(b)
+					}
+					b, e, ok = next()
+				}
+				if ok && e != nil {
+					yield(out, e)
+					return false
+				}
+				out.ChrSpan = win
+				out.Fields = d.AppendToSlice(out.Fields[:0])
+				if !yield(out, nil) {
+					return false
+				}
+			}
+			for ok && e == nil && b.SpanChr() == chr {
+				b, e, ok = next()
+			}
+			return true
+		}
+
+		for ok {
+			if e != nil {
+				yield(out, e)
+				return
+			}
+			if done[b.SpanChr()] {
+				yield(out, fmt.Errorf("WindowSortedBedGenome: input not sorted; chromosome %v is not contiguous", b.SpanChr()))
+				return
+			}
+			if !windowChr(b.SpanChr()) {
+				return
+			}
+		}
+		for _, l := range genome {
+			if !done[l.Name] && !windowChr(l.Name) {
+				return
+			}
+		}
+	}
+}
+
+// Like FaWins, but windows the chromosomes of the genome, in genome order,
+// instead of the sequences of the fasta. Windows past the end of a sequence,
+// including every window of a chromosome missing from the fasta, have empty
+// fields. Sequences are matched to chromosomes by FaiName. The fasta is held
+// in memory.
+func FaWinsGenome[F FaEnter](fa iter.Seq2[F, error], genome []FaLen, size, step int64) iter.Seq2[BedEntry[string], error] {
+	return func(yield func(BedEntry[string], error) bool) {
+		seqs := map[string]string{}
+		lens := genomeLens(genome)
+		for f, e := range fa {
+			if e != nil {
+				yield(BedEntry[string]{}, e)
+				return
+			}
+			name := FaiName(f.FaHeader())
+			if _, ok := lens[name]; ok {
+				seqs[name] = f.FaSeq()
+			}
+		}
+		for win := range GenomeWins(genome, size, step) {
+			seq := seqs[win.Chr]
+			fv := BedEntry[string]{ChrSpan: win}
+			if win.Start < int64(len(seq)) {
+				fv.Fields = seq[win.Start:min(win.End, int64(len(seq)))]
+			}
+			if !yield(fv, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Like FaWinsGenome, reading each window from an indexed fasta.
+func FaWinsIndexedGenome(fr *FastaIndexedReader, genome []FaLen, size, step int64) iter.Seq2[BedEntry[string], error] {
+	return func(yield func(BedEntry[string], error) bool) {
+		for win := range GenomeWins(genome, size, step) {
+			fv := BedEntry[string]{ChrSpan: win}
+			var e error
+			if f, ok := fr.Entry(win.Chr); ok && win.Start < f.Len {
+				fv.Fields, e = fr.Fetch(win.Chr, win.Span)
+			}
+			if !yield(fv, e) || e != nil {
+				return
+			}
+		}
+	}
+}
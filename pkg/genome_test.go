@@ -0,0 +1,105 @@
+package fastats
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const genomeTestFai = "chr1\t25\t6\t60\t61\nchr2\t10\t40\t60\t61\n# comment\nchr3\t5\n"
+
+func TestParseGenomeFile(t *testing.T) {
+	got, e := CollectErr(ParseGenomeFile(strings.NewReader(genomeTestFai)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []FaLen{{"chr1", 25}, {"chr2", 10}, {"chr3", 5}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+}
+
+func TestWinAvgSortedBedGenome(t *testing.T) {
+	genome := []FaLen{{"chr1", 25}, {"chr2", 10}}
+	bed := []BedEntry[float64]{
+		{ChrSpan{"chr1", Span{2, 3}}, 1},
+		{ChrSpan{"chr1", Span{5, 6}}, 3},
+		{ChrSpan{"chr1", Span{22, 23}}, 4},
+	}
+	got, e := CollectErr(WinAvgSortedBedGenome(SliceIter2(bed), genome, 10, 10))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []BedEntry[float64]{
+		{ChrSpan{"chr1", Span{0, 10}}, 2},
+		{ChrSpan{"chr1", Span{10, 20}}, math.NaN()},
+		{ChrSpan{"chr1", Span{20, 25}}, 4},
+		{ChrSpan{"chr2", Span{0, 10}}, math.NaN()},
+	}
+	if len(got) != len(exp) {
+		t.Fatalf("got %v != exp %v", got, exp)
+	}
+	for i := range exp {
+		g, x := got[i], exp[i]
+		if g.ChrSpan != x.ChrSpan || (g.Fields != x.Fields && !(math.IsNaN(g.Fields) && math.IsNaN(x.Fields))) {
+			t.Errorf("%v: got %v != exp %v", i, g, x)
+		}
+	}
+
+	sums, e := CollectErr(WinSumSortedBedGenome(SliceIter2(bed), genome, 10, 5, false))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var vals []float64
+	for _, s := range sums {
+		vals = append(vals, s.Fields)
+	}
+	if expv := []float64{4, 3, 0, 4, 4, 0, 0}; !reflect.DeepEqual(vals, expv) {
+		t.Errorf("sums %v != %v", sums, expv)
+	}
+
+	if _, e := CollectErr(WinAvgSortedBedGenome(SliceIter2(bed), genome[1:], 10, 10)); e == nil {
+		t.Errorf("expected error for chromosome missing from genome")
+	}
+}
+
+func TestFaWinsGenome(t *testing.T) {
+	// Genome names are the first word of the header.
+	fa := []FaEntry{{"a chromosome a", "GGCCAT"}, {"x", "AAAA"}}
+	genome := []FaLen{{"b", 2}, {"a", 8}}
+	got, e := CollectErr(FaWinsGenome(SliceIter2(fa), genome, 4, 4))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []BedEntry[string]{
+		{ChrSpan{"b", Span{0, 2}}, ""},
+		{ChrSpan{"a", Span{0, 4}}, "GGCC"},
+		{ChrSpan{"a", Span{4, 8}}, "AT"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+}
+
+func TestWinSortedBedEmpty(t *testing.T) {
+	// Without a genome, windows over gaps are NaN, as stats.Mean and
+	// stats.Sum give for empty input.
+	bed := []BedEntry[float64]{
+		{ChrSpan{"chr1", Span{2, 3}}, 1},
+		{ChrSpan{"chr1", Span{22, 23}}, 4},
+	}
+	avgs, e := CollectErr(WinAvgSortedBed(SliceIter2(bed), 10, 10))
+	if e != nil {
+		t.Fatal(e)
+	}
+	sums, e := CollectErr(WinSumSortedBed(SliceIter2(bed), 10, 10, false))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, got := range [][]BedEntry[float64]{avgs, sums} {
+		if len(got) != 3 || got[0].Fields != 1 || !math.IsNaN(got[1].Fields) || got[2].Fields != 4 {
+			t.Errorf("got %v; exp [1 NaN 4]", got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"iter"
 	"regexp"
+	"strings"
 )
 
 type GffHead struct {
@@ -38,6 +39,7 @@ func (g GffHead) GffHasScore() bool { return g.HasScore }
 func (g GffHead) GffStrand() byte   { return g.Strand }
 func (g GffHead) GffPhase() int     { return g.Phase }
 func (g GffHead) GffHasPhase() bool { return g.HasPhase }
+func (g GffHead) SpanStrand() byte  { return g.Strand }
 
 func ToGffHead[G GffHeader](g G) GffHead {
 	if ptr, ok := any(&g).(*GffHead); ok {
@@ -120,7 +122,11 @@ func ParseGffEntry[AT any](line []string, attributeParse func(string) (AT, error
 		g.Phase = int(tempPhase)
 	}
 
-	g.Attributes, e = attributeParse(line[8])
+	attributes := ""
+	if len(line) > 8 {
+		attributes = line[8]
+	}
+	g.Attributes, e = attributeParse(attributes)
 	if e != nil {
 		return g, fmt.Errorf("ParseGffEntry: Attributes: %w", e)
 	}
@@ -163,6 +169,95 @@ func ParseAttributePairs(field string) ([]AttributePair, error) {
 	return out, nil
 }
 
+// Split s, which follows an opening quote, at its closing quote, unescaping
+// \" and \\ in the value.
+func cutGtfQuoted(s string) (val, after string, ok bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], true
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", "", false
+}
+
 func ParseGffFlat(r io.Reader) iter.Seq2[GffEntry[[]AttributePair], error] {
 	return ParseGff(r, ParseAttributePairs)
 }
+
+// Parse GTF attributes, as in `gene_id "x"; transcript_id "y"; level 2;`.
+// Quotes are removed from values, and semicolons inside quotes are kept.
+// Inside quotes, \" and \\ stand for " and \.
+func ParseGtfAttributePairs(field string) ([]AttributePair, error) {
+	var out []AttributePair
+	rest := strings.TrimSpace(field)
+	for len(rest) > 0 {
+		tag, after, _ := strings.Cut(rest, " ")
+		if strings.HasSuffix(tag, ";") {
+			return nil, fmt.Errorf("ParseGtfAttributePairs: tag %q without value in %q", strings.TrimSuffix(tag, ";"), field)
+		}
+		after = strings.TrimLeft(after, " ")
+		var val string
+		if strings.HasPrefix(after, "\"") {
+			var ok bool
+			val, after, ok = cutGtfQuoted(after[1:])
+			if !ok {
+				return nil, fmt.Errorf("ParseGtfAttributePairs: unterminated quote in %q", field)
+			}
+		} else {
+			end := strings.IndexByte(after, ';')
+			if end < 0 {
+				end = len(after)
+			}
+			val = strings.TrimSpace(after[:end])
+			after = after[end:]
+		}
+		if tag == "" {
+			return nil, fmt.Errorf("ParseGtfAttributePairs: empty tag in %q", field)
+		}
+		out = append(out, AttributePair{tag, val})
+		after = strings.TrimLeft(after, " ")
+		after = strings.TrimPrefix(after, ";")
+		rest = strings.TrimLeft(after, " ")
+	}
+	return out, nil
+}
+
+func ParseGtfFlat(r io.Reader) iter.Seq2[GffEntry[[]AttributePair], error] {
+	return ParseGff(r, ParseGtfAttributePairs)
+}
+
+// The attribute syntax of a GFF file.
+type GffDialect int
+
+const (
+	Gff3 GffDialect = iota
+	Gtf
+)
+
+func ParseGffDialect(s string) (GffDialect, error) {
+	switch strings.ToLower(s) {
+	case "gff", "gff3":
+		return Gff3, nil
+	case "gtf", "gff2":
+		return Gtf, nil
+	}
+	return 0, fmt.Errorf("ParseGffDialect: unknown dialect %v", s)
+}
+
+func (d GffDialect) ParseAttributes(field string) ([]AttributePair, error) {
+	if d == Gtf {
+		return ParseGtfAttributePairs(field)
+	}
+	return ParseAttributePairs(field)
+}
+
+func ParseGffDialectFlat(r io.Reader, d GffDialect) iter.Seq2[GffEntry[[]AttributePair], error] {
+	return ParseGff(r, d.ParseAttributes)
+}
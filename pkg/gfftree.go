@@ -0,0 +1,281 @@
+package fastats
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+)
+
+var ErrGffOrphan = errors.New("gff Parent not found")
+var ErrGffDuplicateID = errors.New("gff duplicate ID")
+var ErrGffCycle = errors.New("gff Parent cycle")
+
+type GffFlatEntry = GffEntry[[]AttributePair]
+
+// The first value of tag, or false if it is absent.
+func GffAttribute(pairs []AttributePair, tag string) (string, bool) {
+	for _, p := range pairs {
+		if p.Tag == tag {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// The comma-separated values of tag, as for Parent.
+func GffAttributeValues(pairs []AttributePair, tag string) []string {
+	var out []string
+	for _, p := range pairs {
+		if p.Tag == tag && p.Value != "" {
+			out = append(out, strings.Split(p.Value, ",")...)
+		}
+	}
+	return out
+}
+
+// One feature of a GFF3 file. Lines sharing an ID, such as the pieces of a
+// CDS, are one feature with several entries.
+type GffFeature struct {
+	ID string
+	// Sorted by start
+	Entries  []GffFlatEntry
+	Parents  []*GffFeature
+	Children []*GffFeature
+}
+
+func (f *GffFeature) Type() string     { return f.Entries[0].Type }
+func (f *GffFeature) Strand() byte     { return f.Entries[0].Strand }
+func (f *GffFeature) SpanChr() string  { return f.Entries[0].Chr }
+func (f *GffFeature) SpanStart() int64 { return f.Entries[0].Start }
+func (f *GffFeature) SpanEnd() int64 {
+	end := f.Entries[0].End
+	for _, g := range f.Entries[1:] {
+		end = max(end, g.End)
+	}
+	return end
+}
+
+func (f *GffFeature) Attribute(tag string) (string, bool) {
+	return GffAttribute(f.Entries[0].Attributes, tag)
+}
+
+// The value of Name, or else the ID.
+func (f *GffFeature) Name() string {
+	if n, ok := f.Attribute("Name"); ok {
+		return n
+	}
+	return f.ID
+}
+
+// Children of any of the given types, sorted by start.
+func (f *GffFeature) ChildrenOfType(types ...string) []*GffFeature {
+	var out []*GffFeature
+	for _, c := range f.Children {
+		if slices.Contains(types, c.Type()) {
+			out = append(out, c)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b *GffFeature) int {
+		return cmp.Compare(a.SpanStart(), b.SpanStart())
+	})
+	return out
+}
+
+// Every entry of every child of the given types, sorted by start. Unlike
+// ChildrenOfType, a CDS split over several lines yields each line.
+func (f *GffFeature) ChildEntries(types ...string) []GffFlatEntry {
+	var out []GffFlatEntry
+	for _, c := range f.ChildrenOfType(types...) {
+		out = append(out, c.Entries...)
+	}
+	slices.SortStableFunc(out, func(a, b GffFlatEntry) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	return out
+}
+
+func (f *GffFeature) Exons() []GffFlatEntry { return f.ChildEntries("exon") }
+func (f *GffFeature) CDS() []GffFlatEntry   { return f.ChildEntries("CDS") }
+
+func IsGffGeneType(t string) bool {
+	return t == "gene" || t == "pseudogene" || strings.HasSuffix(t, "_gene")
+}
+
+var gffTranscriptTypes = []string{
+	"mRNA", "transcript", "primary_transcript", "ncRNA", "lnc_RNA", "lncRNA",
+	"tRNA", "rRNA", "snRNA", "snoRNA", "miRNA", "pseudogenic_transcript",
+	"V_gene_segment", "C_gene_segment", "D_gene_segment", "J_gene_segment",
+}
+
+func IsGffTranscriptType(t string) bool {
+	return slices.Contains(gffTranscriptTypes, t)
+}
+
+// Transcripts among the feature's children: children of a transcript type,
+// or any child that has exons or CDS below it.
+func (f *GffFeature) Transcripts() []*GffFeature {
+	var out []*GffFeature
+	for _, c := range f.Children {
+		if IsGffTranscriptType(c.Type()) || len(c.ChildrenOfType("exon", "CDS")) > 0 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+type GffTree struct {
+	// Features with no parents, in file order
+	Roots []*GffFeature
+	// Every feature, in file order
+	Features []*GffFeature
+	ids      map[string]*GffFeature
+}
+
+func (t *GffTree) Feature(id string) (*GffFeature, bool) {
+	f, ok := t.ids[id]
+	return f, ok
+}
+
+func sameParents(a, b []AttributePair) bool {
+	return slices.Equal(GffAttributeValues(a, "Parent"), GffAttributeValues(b, "Parent"))
+}
+
+// Link GFF3 lines into a feature tree by their ID and Parent attributes.
+// Lines without an ID are features of their own. Lines sharing an ID must
+// have the same type, chromosome and parents, or they are reported as
+// ErrGffDuplicateID. Parents that do not exist are reported as ErrGffOrphan,
+// and the feature is kept as a root; Parent loops are reported as ErrGffCycle
+// and broken. The tree is usable even when the error is not nil.
+func NewGffTree(entries []GffFlatEntry) (*GffTree, error) {
+	t := &GffTree{ids: map[string]*GffFeature{}}
+	var errs []error
+	for _, g := range entries {
+		id, hasID := GffAttribute(g.Attributes, "ID")
+		if hasID {
+			if f, ok := t.ids[id]; ok {
+				first := f.Entries[0]
+				if first.Type != g.Type || first.Chr != g.Chr || !sameParents(first.Attributes, g.Attributes) {
+					errs = append(errs, fmt.Errorf("%w: %v at %v:%v and %v:%v", ErrGffDuplicateID, id, first.Chr, first.Start+1, g.Chr, g.Start+1))
+					continue
+				}
+				f.Entries = append(f.Entries, g)
+				continue
+			}
+		}
+		f := &GffFeature{ID: id, Entries: []GffFlatEntry{g}}
+		if hasID {
+			t.ids[id] = f
+		}
+		t.Features = append(t.Features, f)
+	}
+
+	for _, f := range t.Features {
+		slices.SortStableFunc(f.Entries, func(a, b GffFlatEntry) int {
+			return cmp.Compare(a.Start, b.Start)
+		})
+		for _, pid := range GffAttributeValues(f.Entries[0].Attributes, "Parent") {
+			p, ok := t.ids[pid]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%w: %v, parent of %v at %v:%v", ErrGffOrphan, pid, f.ID, f.SpanChr(), f.SpanStart()+1))
+				continue
+			}
+			if p == f || p.hasAncestor(f) {
+				errs = append(errs, fmt.Errorf("%w: %v and %v", ErrGffCycle, f.ID, pid))
+				continue
+			}
+			f.Parents = append(f.Parents, p)
+			p.Children = append(p.Children, f)
+		}
+	}
+	for _, f := range t.Features {
+		if len(f.Parents) == 0 {
+			t.Roots = append(t.Roots, f)
+		}
+	}
+	return t, errors.Join(errs...)
+}
+
+func (f *GffFeature) hasAncestor(a *GffFeature) bool {
+	for _, p := range f.Parents {
+		if p == a || p.hasAncestor(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a GFF3 file into a tree. Parse errors are returned alone; tree errors
+// are returned with the tree, as in NewGffTree.
+func ReadGffTree(r io.Reader) (*GffTree, error) {
+	entries, e := CollectErr(ParseGffFlat(r))
+	if e != nil {
+		return nil, e
+	}
+	return NewGffTree(entries)
+}
+
+// Every feature with the depth below its root, parents before children.
+// Features with several parents are visited once under each.
+func (t *GffTree) Walk() iter.Seq2[int, *GffFeature] {
+	return func(yield func(int, *GffFeature) bool) {
+		var walk func(depth int, f *GffFeature) bool
+		walk = func(depth int, f *GffFeature) bool {
+			if !yield(depth, f) {
+				return false
+			}
+			for _, c := range f.Children {
+				if !walk(depth+1, c) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, r := range t.Roots {
+			if !walk(0, r) {
+				return
+			}
+		}
+	}
+}
+
+// Every gene, in file order.
+func (t *GffTree) Genes() iter.Seq[*GffFeature] {
+	return func(yield func(*GffFeature) bool) {
+		for _, f := range t.Features {
+			if IsGffGeneType(f.Type()) && !yield(f) {
+				return
+			}
+		}
+	}
+}
+
+// Every transcript with its gene, in file order. Transcripts without a gene
+// parent come with a nil gene.
+func (t *GffTree) Transcripts() iter.Seq2[*GffFeature, *GffFeature] {
+	return func(yield func(*GffFeature, *GffFeature) bool) {
+		for _, f := range t.Features {
+			if len(f.Parents) == 0 {
+				if IsGffTranscriptType(f.Type()) && !yield(nil, f) {
+					return
+				}
+				continue
+			}
+			for _, p := range f.Parents {
+				if !slices.Contains(p.Transcripts(), f) {
+					continue
+				}
+				gene := p
+				if !IsGffGeneType(p.Type()) {
+					gene = nil
+				}
+				if !yield(gene, f) {
+					return
+				}
+			}
+		}
+	}
+}
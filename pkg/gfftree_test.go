@@ -0,0 +1,82 @@
+package fastats
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const gffTreeEx = `##gff-version 3
+1	fake	gene	1	100	.	+	.	ID=gene1;Name=g1
+1	fake	mRNA	1	100	.	+	.	ID=tx1;Parent=gene1
+1	fake	exon	60	100	.	+	.	Parent=tx1
+1	fake	exon	1	20	.	+	.	Parent=tx1
+1	fake	CDS	65	90	.	+	2	ID=cds1;Parent=tx1
+1	fake	CDS	10	20	.	+	0	ID=cds1;Parent=tx1
+1	fake	ncRNA	200	300	.	-	.	ID=tx2
+`
+
+func TestGffTree(t *testing.T) {
+	tree, e := ReadGffTree(strings.NewReader(gffTreeEx))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var genes []string
+	for g := range tree.Genes() {
+		genes = append(genes, g.Name())
+	}
+	if !reflect.DeepEqual(genes, []string{"g1"}) {
+		t.Errorf("genes %v", genes)
+	}
+
+	var txs []string
+	for g, tx := range tree.Transcripts() {
+		gid := ""
+		if g != nil {
+			gid = g.ID
+		}
+		txs = append(txs, gid+">"+tx.ID)
+	}
+	if !reflect.DeepEqual(txs, []string{"gene1>tx1", ">tx2"}) {
+		t.Errorf("transcripts %v", txs)
+	}
+
+	tx, _ := tree.Feature("tx1")
+	var exons, cds []Span
+	for _, x := range tx.Exons() {
+		exons = append(exons, x.Span)
+	}
+	for _, x := range tx.CDS() {
+		cds = append(cds, x.Span)
+	}
+	if !reflect.DeepEqual(exons, []Span{{0, 20}, {59, 100}}) || !reflect.DeepEqual(cds, []Span{{9, 20}, {64, 90}}) {
+		t.Errorf("exons %v cds %v", exons, cds)
+	}
+
+	var depths []int
+	for d := range tree.Walk() {
+		depths = append(depths, d)
+	}
+	if !reflect.DeepEqual(depths, []int{0, 1, 2, 2, 2, 0}) {
+		t.Errorf("depths %v", depths)
+	}
+}
+
+func TestGffTreeErrors(t *testing.T) {
+	const in = `1	fake	gene	1	100	.	+	.	ID=gene1
+1	fake	mRNA	1	100	.	+	.	ID=gene1;Parent=gene1
+1	fake	exon	1	10	.	+	.	Parent=missing
+1	fake	mRNA	1	10	.	+	.	ID=a;Parent=b
+1	fake	mRNA	1	10	.	+	.	ID=b;Parent=a
+`
+	tree, e := ReadGffTree(strings.NewReader(in))
+	for _, want := range []error{ErrGffDuplicateID, ErrGffOrphan, ErrGffCycle} {
+		if !errors.Is(e, want) {
+			t.Errorf("missing %v in %v", want, e)
+		}
+	}
+	if tree == nil || len(tree.Roots) != 3 {
+		t.Errorf("roots %v", tree.Roots)
+	}
+}
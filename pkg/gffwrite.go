@@ -3,6 +3,7 @@ package fastats
 import (
 	"fmt"
 	"io"
+	"strings"
 )
 
 func GffScoreStr[G GffHeader](g G) string {
@@ -38,6 +39,9 @@ func WriteGffEntry[G GffEnter[T], T any](w io.Writer, g G, f func(io.Writer, T)
 	if e := WriteGffHeader(w, g); e != nil {
 		return e
 	}
+	if _, e := fmt.Fprintf(w, "\t"); e != nil {
+		return e
+	}
 	return f(w, g.GffAttributes())
 }
 
@@ -58,3 +62,40 @@ func WriteGffAttributePairs(w io.Writer, pairs []AttributePair) error {
 func WriteGffFlat[G GffEnter[[]AttributePair]](w io.Writer, g G) error {
 	return WriteGffEntry(w, g, WriteGffAttributePairs)
 }
+
+var gtfQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Write GTF attributes, quoting every value and escaping " and \ in it.
+func WriteGtfAttributePairs(w io.Writer, pairs []AttributePair) error {
+	for i, p := range pairs {
+		if i > 0 {
+			if _, e := fmt.Fprintf(w, " "); e != nil {
+				return e
+			}
+		}
+		if _, e := fmt.Fprintf(w, "%v \"%v\";", p.Tag, gtfQuoteEscaper.Replace(p.Value)); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func WriteGtfFlat[G GffEnter[[]AttributePair]](w io.Writer, g G) error {
+	return WriteGffEntry(w, g, WriteGtfAttributePairs)
+}
+
+func (d GffDialect) WriteAttributes(w io.Writer, pairs []AttributePair) error {
+	if d == Gtf {
+		return WriteGtfAttributePairs(w, pairs)
+	}
+	return WriteGffAttributePairs(w, pairs)
+}
+
+// Write one entry and a newline, with attributes in dialect d.
+func WriteGffDialectFlat[G GffEnter[[]AttributePair]](w io.Writer, g G, d GffDialect) error {
+	if e := WriteGffEntry(w, g, d.WriteAttributes); e != nil {
+		return e
+	}
+	_, e := fmt.Fprintln(w)
+	return e
+}
@@ -0,0 +1,336 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"iter"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+var gff3Escaper = strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D", "&", "%26", ",", "%2C", "\t", "%09")
+var gff3Unescaper = strings.NewReplacer("%25", "%", "%3B", ";", "%3D", "=", "%26", "&", "%2C", ",", "%09", "\t")
+
+// Percent-encode the characters that are reserved in GFF3 attribute values.
+func Gff3Escape(s string) string   { return gff3Escaper.Replace(s) }
+func Gff3Unescape(s string) string { return gff3Unescaper.Replace(s) }
+
+// GTF attributes as GFF3 attributes after ids: gene_id and transcript_id are
+// dropped, nameTag becomes Name, and repeated tags are joined by commas.
+func gtfToGff3Attributes(ids []AttributePair, pairs []AttributePair, nameTag string) []AttributePair {
+	out := slices.Clone(ids)
+	idx := map[string]int{}
+	for _, p := range pairs {
+		tag := p.Tag
+		switch {
+		case tag == "gene_id" || tag == "transcript_id":
+			continue
+		case tag == nameTag:
+			tag = "Name"
+		}
+		if i, ok := idx[tag]; ok {
+			out[i].Value += "," + Gff3Escape(p.Value)
+			continue
+		}
+		idx[tag] = len(out)
+		out = append(out, AttributePair{tag, Gff3Escape(p.Value)})
+	}
+	return out
+}
+
+// The attributes whose tags start with one of prefixes.
+func filterAttributePrefixes(pairs []AttributePair, prefixes ...string) []AttributePair {
+	var out []AttributePair
+	for _, p := range pairs {
+		for _, pre := range prefixes {
+			if strings.HasPrefix(p.Tag, pre) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+type gtfTranscript struct {
+	id       string
+	line     *GffFlatEntry
+	children []GffFlatEntry
+}
+
+type gtfGene struct {
+	id          string
+	line        *GffFlatEntry
+	transcripts []*gtfTranscript
+}
+
+func spanGffEntries(typ string, es []GffFlatEntry) GffFlatEntry {
+	g := GffFlatEntry{GffHead: es[0].GffHead}
+	g.Type = typ
+	g.HasScore, g.HasPhase, g.Phase, g.Score = false, false, 0, 0
+	for _, e := range es[1:] {
+		g.Start = min(g.Start, e.Start)
+		g.End = max(g.End, e.End)
+	}
+	return g
+}
+
+// Convert GTF entries to GFF3. Each gene_id becomes a gene with that ID, and
+// each transcript_id an mRNA, or a transcript if it has no CDS, with Parent
+// set to its gene, and gene_name and transcript_name become their Names. Gene
+// and transcript lines are made from the span of their children when the GTF
+// has none. Gene lines of any gene type, as by IsGffGeneType, keep their
+// type. Other lines become children of their transcript. Genes come in
+// order of first appearance, each followed by its transcripts and their
+// children. The whole input is read before output.
+func GtfToGff3(it iter.Seq2[GffFlatEntry, error]) iter.Seq2[GffFlatEntry, error] {
+	return func(yield func(GffFlatEntry, error) bool) {
+		var genes []*gtfGene
+		geneIdx := map[string]*gtfGene{}
+		txIdx := map[string]*gtfTranscript{}
+		for g, e := range it {
+			if e != nil {
+				yield(g, e)
+				return
+			}
+			gid, ok := GffAttribute(g.Attributes, "gene_id")
+			if !ok {
+				yield(g, fmt.Errorf("GtfToGff3: %v:%v: no gene_id", g.Chr, g.Start+1))
+				return
+			}
+			gene, ok := geneIdx[gid]
+			if !ok {
+				gene = &gtfGene{id: gid}
+				geneIdx[gid] = gene
+				genes = append(genes, gene)
+			}
+			if IsGffGeneType(g.Type) {
+				gene.line = &g
+				continue
+			}
+			tid, ok := GffAttribute(g.Attributes, "transcript_id")
+			if !ok {
+				yield(g, fmt.Errorf("GtfToGff3: %v:%v: no transcript_id", g.Chr, g.Start+1))
+				return
+			}
+			tx, ok := txIdx[tid]
+			if !ok {
+				tx = &gtfTranscript{id: tid}
+				txIdx[tid] = tx
+				gene.transcripts = append(gene.transcripts, tx)
+			}
+			if g.Type == "transcript" {
+				tx.line = &g
+				continue
+			}
+			tx.children = append(tx.children, g)
+		}
+
+		for _, gene := range genes {
+			var all []GffFlatEntry
+			for _, tx := range gene.transcripts {
+				if tx.line == nil {
+					if len(tx.children) == 0 {
+						continue
+					}
+					hasCDS := slices.ContainsFunc(tx.children, func(g GffFlatEntry) bool { return g.Type == "CDS" })
+					typ := "transcript"
+					if hasCDS {
+						typ = "mRNA"
+					}
+					l := spanGffEntries(typ, tx.children)
+					l.Attributes = filterAttributePrefixes(tx.children[0].Attributes, "gene_", "transcript_")
+					tx.line = &l
+				} else if slices.ContainsFunc(tx.children, func(g GffFlatEntry) bool { return g.Type == "CDS" }) {
+					tx.line.Type = "mRNA"
+				}
+				all = append(all, *tx.line)
+			}
+			if gene.line == nil {
+				if len(all) == 0 {
+					continue
+				}
+				l := spanGffEntries("gene", all)
+				l.Attributes = filterAttributePrefixes(all[0].Attributes, "gene_")
+				gene.line = &l
+			}
+
+			gl := *gene.line
+			gl.Attributes = gtfToGff3Attributes([]AttributePair{{"ID", Gff3Escape(gene.id)}}, gl.Attributes, "gene_name")
+			if !yield(gl, nil) {
+				return
+			}
+			for _, tx := range gene.transcripts {
+				if tx.line == nil {
+					continue
+				}
+				tl := *tx.line
+				tl.Attributes = gtfToGff3Attributes([]AttributePair{{"ID", Gff3Escape(tx.id)}, {"Parent", Gff3Escape(gene.id)}}, tl.Attributes, "transcript_name")
+				if !yield(tl, nil) {
+					return
+				}
+				for _, c := range tx.children {
+					c.Attributes = gtfToGff3Attributes([]AttributePair{{"Parent", Gff3Escape(tx.id)}}, c.Attributes, "")
+					if !yield(c, nil) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// GFF3 attributes as GTF attributes: ID and Parent are dropped, Name becomes
+// nameTag, and comma-separated values become repeated tags.
+func gff3ToGtfAttributes(ids []AttributePair, pairs []AttributePair, nameTag string) []AttributePair {
+	out := slices.Clone(ids)
+	for _, p := range pairs {
+		tag := p.Tag
+		switch tag {
+		case "ID", "Parent":
+			continue
+		case "Name":
+			if nameTag == "" {
+				continue
+			}
+			tag = nameTag
+		}
+		for _, v := range strings.Split(p.Value, ",") {
+			out = append(out, AttributePair{tag, Gff3Unescape(v)})
+		}
+	}
+	return out
+}
+
+// Convert a GFF3 tree to GTF. Each transcript is written as a transcript line
+// followed by the lines of its children, with gene_id set to the ID of its
+// gene, or its own ID if it has no gene. Genes keep their type, such as
+// pseudogene or ncRNA_gene, and are written before their first transcript. Features outside a gene or transcript are left out, since GTF
+// has no way to group them.
+func Gff3ToGtf(t *GffTree) iter.Seq[GffFlatEntry] {
+	return func(yield func(GffFlatEntry) bool) {
+		written := map[*GffFeature]bool{}
+		writeGene := func(gene *GffFeature) bool {
+			if written[gene] {
+				return true
+			}
+			written[gene] = true
+			ids := []AttributePair{{"gene_id", Gff3Unescape(gene.ID)}}
+			for _, g := range gene.Entries {
+				g.Attributes = gff3ToGtfAttributes(ids, g.Attributes, "gene_name")
+				if !yield(g) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for gene, tx := range t.Transcripts() {
+			gid := tx.ID
+			if gene != nil {
+				gid = gene.ID
+				if !writeGene(gene) {
+					return
+				}
+			}
+			ids := []AttributePair{{"gene_id", Gff3Unescape(gid)}, {"transcript_id", Gff3Unescape(tx.ID)}}
+			for _, g := range tx.Entries {
+				g.Attributes = gff3ToGtfAttributes(ids, g.Attributes, "transcript_name")
+				g.Type = "transcript"
+				if !yield(g) {
+					return
+				}
+			}
+			for _, c := range tx.ChildEntries(childTypes(tx)...) {
+				c.Attributes = gff3ToGtfAttributes(ids, c.Attributes, "")
+				if !yield(c) {
+					return
+				}
+			}
+		}
+		for gene := range t.Genes() {
+			if !writeGene(gene) {
+				return
+			}
+		}
+	}
+}
+
+func childTypes(f *GffFeature) []string {
+	var types []string
+	for _, c := range f.Children {
+		if !slices.Contains(types, c.Type()) {
+			types = append(types, c.Type())
+		}
+	}
+	return types
+}
+
+type GffConvertFlags struct {
+	From string
+	To   string
+}
+
+func FullGffConvert() {
+	var f GffConvertFlags
+	flag.StringVar(&f.From, "i", "gtf", "Input dialect: gtf or gff3")
+	flag.StringVar(&f.To, "o", "gff3", "Output dialect: gtf or gff3")
+	flag.Parse()
+
+	from, e := ParseGffDialect(f.From)
+	if e != nil {
+		log.Fatal(e)
+	}
+	to, e := ParseGffDialect(f.To)
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+
+	in := ParseGffDialectFlat(os.Stdin, from)
+	var out iter.Seq2[GffFlatEntry, error]
+	switch {
+	case from == to:
+		out = in
+	case from == Gtf:
+		out = GtfToGff3(in)
+	default:
+		tree, e := ReadGffTree(os.Stdin)
+		if e != nil {
+			log.Print(e)
+		}
+		if tree == nil {
+			os.Exit(1)
+		}
+		out = func(yield func(GffFlatEntry, error) bool) {
+			for g := range Gff3ToGtf(tree) {
+				if !yield(g, nil) {
+					return
+				}
+			}
+		}
+	}
+
+	if to == Gff3 {
+		if _, e := fmt.Fprintln(w, "##gff-version 3"); e != nil {
+			log.Fatal(e)
+		}
+	}
+	for g, e := range out {
+		if e != nil {
+			log.Fatal(e)
+		}
+		if e := WriteGffDialectFlat(w, g, to); e != nil {
+			log.Fatal(e)
+		}
+	}
+}
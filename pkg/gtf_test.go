@@ -0,0 +1,117 @@
+package fastats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const gtfEx = `1	fake	exon	1	20	.	+	.	gene_id "g1"; transcript_id "t1"; gene_name "Abc;1"; tag "basic"; tag "mane";
+1	fake	CDS	10	20	.	+	0	gene_id "g1"; transcript_id "t1"; exon_number 1;
+1	fake	exon	60	100	.	+	.	gene_id "g1"; transcript_id "t2";
+`
+
+func TestParseGtfAttributePairs(t *testing.T) {
+	got, e := ParseGtfAttributePairs(`gene_id "g1"; gene_name "a; b";level 2; empty "";`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []AttributePair{{"gene_id", "g1"}, {"gene_name", "a; b"}, {"level", "2"}, {"empty", ""}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+	got, e = ParseGtfAttributePairs(`note "say \"hi\"; c:\\"; x "\\";`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp = []AttributePair{{"note", `say "hi"; c:\`}, {"x", `\`}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+	var b strings.Builder
+	if e := WriteGtfAttributePairs(&b, exp); e != nil {
+		t.Fatal(e)
+	}
+	if again, e := ParseGtfAttributePairs(b.String()); e != nil || !reflect.DeepEqual(again, exp) {
+		t.Errorf("%q parsed to %v, %v", b.String(), again, e)
+	}
+	if _, e := ParseGtfAttributePairs(`gene_id "g1`); e == nil {
+		t.Errorf("expected unterminated quote error")
+	}
+}
+
+func TestGtfGff3RoundTrip(t *testing.T) {
+	gff, e := CollectErr(GtfToGff3(ParseGtfFlat(strings.NewReader(gtfEx))))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var b strings.Builder
+	for _, g := range gff {
+		if e := WriteGffDialectFlat(&b, g, Gff3); e != nil {
+			t.Fatal(e)
+		}
+	}
+	expGff := `1	fake	gene	1	100	.	+	.	ID=g1;Name=Abc%3B1
+1	fake	mRNA	1	20	.	+	.	ID=t1;Parent=g1;gene_name=Abc%3B1
+1	fake	exon	1	20	.	+	.	Parent=t1;gene_name=Abc%3B1;tag=basic,mane
+1	fake	CDS	10	20	.	+	0	Parent=t1;exon_number=1
+1	fake	transcript	60	100	.	+	.	ID=t2;Parent=g1
+1	fake	exon	60	100	.	+	.	Parent=t2
+`
+	if b.String() != expGff {
+		t.Errorf("gff3:\n%v\n!= exp\n%v", b.String(), expGff)
+	}
+
+	tree, e := ReadGffTree(strings.NewReader(expGff))
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.Reset()
+	for g := range Gff3ToGtf(tree) {
+		if e := WriteGffDialectFlat(&b, g, Gtf); e != nil {
+			t.Fatal(e)
+		}
+	}
+	expGtf := `1	fake	gene	1	100	.	+	.	gene_id "g1"; gene_name "Abc;1";
+1	fake	transcript	1	20	.	+	.	gene_id "g1"; transcript_id "t1"; gene_name "Abc;1";
+1	fake	exon	1	20	.	+	.	gene_id "g1"; transcript_id "t1"; gene_name "Abc;1"; tag "basic"; tag "mane";
+1	fake	CDS	10	20	.	+	0	gene_id "g1"; transcript_id "t1"; exon_number "1";
+1	fake	transcript	60	100	.	+	.	gene_id "g1"; transcript_id "t2";
+1	fake	exon	60	100	.	+	.	gene_id "g1"; transcript_id "t2";
+`
+	if b.String() != expGtf {
+		t.Errorf("gtf:\n%v\n!= exp\n%v", b.String(), expGtf)
+	}
+}
+
+func TestGff3ToGtfGeneTypes(t *testing.T) {
+	gff := `1	fake	pseudogene	1	100	.	+	.	ID=p1
+1	fake	pseudogenic_transcript	1	100	.	+	.	ID=pt1;Parent=p1
+1	fake	ncRNA_gene	200	300	.	-	.	ID=n1
+`
+	tree, e := ReadGffTree(strings.NewReader(gff))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var gtf []GffFlatEntry
+	var types []string
+	for g := range Gff3ToGtf(tree) {
+		gtf = append(gtf, g)
+		types = append(types, g.Type)
+	}
+	if exp := []string{"pseudogene", "transcript", "ncRNA_gene"}; !reflect.DeepEqual(types, exp) {
+		t.Errorf("gtf types %v != %v", types, exp)
+	}
+
+	back, e := CollectErr(GtfToGff3(SliceIter2(gtf)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	types = nil
+	for _, g := range back {
+		types = append(types, g.Type)
+	}
+	if exp := []string{"pseudogene", "transcript", "ncRNA_gene"}; !reflect.DeepEqual(types, exp) {
+		t.Errorf("gff3 types %v != %v", types, exp)
+	}
+}
@@ -0,0 +1,358 @@
+package fastats
+
+import (
+	"fmt"
+	"iter"
+	"sort"
+)
+
+type intervalChr[C ChrSpanner] struct {
+	items []C
+	// Sorted by start
+	starts []int64
+	ends   []int64
+	// maxEnd[mid] is the largest end in the implicit subtree rooted at mid
+	maxEnd []int64
+	// prefixEnd[i] is the largest end in items[:i+1]
+	prefixEnd []int64
+}
+
+// A static interval tree: intervals sorted by start, with each midpoint of
+// a binary search range storing the largest end below it.
+type IntervalTree[C ChrSpanner] struct {
+	chrs map[string]*intervalChr[C]
+}
+
+func buildMaxEnd(ends, maxEnd []int64, lo, hi int) int64 {
+	if lo >= hi {
+		return -1
+	}
+	mid := (lo + hi) / 2
+	m := max(ends[mid], buildMaxEnd(ends, maxEnd, lo, mid), buildMaxEnd(ends, maxEnd, mid+1, hi))
+	maxEnd[mid] = m
+	return m
+}
+
+func NewIntervalTree[C ChrSpanner](items []C) *IntervalTree[C] {
+	t := &IntervalTree[C]{chrs: map[string]*intervalChr[C]{}}
+	for _, c := range items {
+		ic, ok := t.chrs[c.SpanChr()]
+		if !ok {
+			ic = &intervalChr[C]{}
+			t.chrs[c.SpanChr()] = ic
+		}
+		ic.items = append(ic.items, c)
+	}
+	for _, ic := range t.chrs {
+		sort.SliceStable(ic.items, func(i, j int) bool {
+			return ic.items[i].SpanStart() < ic.items[j].SpanStart()
+		})
+		ic.starts = make([]int64, len(ic.items))
+		ic.ends = make([]int64, len(ic.items))
+		ic.maxEnd = make([]int64, len(ic.items))
+		ic.prefixEnd = make([]int64, len(ic.items))
+		for i, c := range ic.items {
+			ic.starts[i] = c.SpanStart()
+			ic.ends[i] = c.SpanEnd()
+			ic.prefixEnd[i] = ic.ends[i]
+			if i > 0 {
+				ic.prefixEnd[i] = max(ic.prefixEnd[i], ic.prefixEnd[i-1])
+			}
+		}
+		buildMaxEnd(ic.ends, ic.maxEnd, 0, len(ic.items))
+	}
+	return t
+}
+
+func CollectIntervalTree[C ChrSpanner](it iter.Seq2[C, error]) (*IntervalTree[C], error) {
+	items, e := CollectErr(it)
+	if e != nil {
+		return nil, e
+	}
+	return NewIntervalTree(items), nil
+}
+
+func (ic *intervalChr[C]) query(start, end int64, lo, hi int, yield func(C) bool) bool {
+	if lo >= hi {
+		return true
+	}
+	mid := (lo + hi) / 2
+	if ic.maxEnd[mid] <= start {
+		return true
+	}
+	if !ic.query(start, end, lo, mid, yield) {
+		return false
+	}
+	if ic.starts[mid] >= end {
+		return true
+	}
+	if ic.ends[mid] > start {
+		if !yield(ic.items[mid]) {
+			return false
+		}
+	}
+	return ic.query(start, end, mid+1, hi, yield)
+}
+
+// Intervals overlapping q by at least one base, in order of start.
+func (t *IntervalTree[C]) Overlaps(q ChrSpanner) iter.Seq[C] {
+	return func(yield func(C) bool) {
+		ic, ok := t.chrs[q.SpanChr()]
+		if !ok {
+			return
+		}
+		ic.query(q.SpanStart(), q.SpanEnd(), 0, len(ic.items), yield)
+	}
+}
+
+func (t *IntervalTree[C]) HasOverlap(q ChrSpanner) bool {
+	for range t.Overlaps(q) {
+		return true
+	}
+	return false
+}
+
+// The intervals closest to q, with ties all returned, and their distance:
+// 0 if they overlap q, otherwise the gap between them plus one, so that
+// book-ended intervals are at distance 1. Returns -1 if q's chromosome has
+// no intervals.
+func (t *IntervalTree[C]) Nearest(q ChrSpanner) ([]C, int64) {
+	if over := Collect(t.Overlaps(q)); len(over) > 0 {
+		return over, 0
+	}
+	ic, ok := t.chrs[q.SpanChr()]
+	if !ok || len(ic.items) == 0 {
+		return nil, -1
+	}
+
+	var out []C
+	dist := int64(-1)
+	// Downstream: the intervals with the first start at or after q's end.
+	down := sort.Search(len(ic.starts), func(i int) bool { return ic.starts[i] >= q.SpanEnd() })
+	if down < len(ic.starts) {
+		dist = ic.starts[down] - q.SpanEnd() + 1
+		for i := down; i < len(ic.starts) && ic.starts[i] == ic.starts[down]; i++ {
+			out = append(out, ic.items[i])
+		}
+	}
+
+	// Upstream: everything starting before q ends lies fully left of q, so
+	// the nearest ones are those with the largest end.
+	if down > 0 {
+		upEnd := ic.prefixEnd[down-1]
+		updist := q.SpanStart() - upEnd + 1
+		if dist < 0 || updist < dist {
+			out = out[:0]
+			dist = updist
+		}
+		if updist == dist {
+			var up []C
+			for c := range t.Overlaps(ChrSpan{q.SpanChr(), Span{upEnd - 1, upEnd}}) {
+				if c.SpanEnd() == upEnd {
+					up = append(up, c)
+				}
+			}
+			out = append(up, out...)
+		}
+	}
+	return out, dist
+}
+
+func ChrSpanOverlap[C1, C2 ChrSpanner](a C1, b C2) (ChrSpan, bool) {
+	if a.SpanChr() != b.SpanChr() {
+		return ChrSpan{}, false
+	}
+	s := ChrSpan{a.SpanChr(), Span{max(a.SpanStart(), b.SpanStart()), min(a.SpanEnd(), b.SpanEnd())}}
+	return s, s.Start < s.End
+}
+
+// Every overlapping pair of an a interval and a tree interval.
+func Intersect[A, B ChrSpanner](a iter.Seq2[A, error], t *IntervalTree[B]) iter.Seq2[Tuple2[A, B], error] {
+	return func(yield func(Tuple2[A, B], error) bool) {
+		for x, e := range a {
+			if e != nil {
+				yield(Tuple2[A, B]{}, e)
+				return
+			}
+			for y := range t.Overlaps(x) {
+				if !yield(Tuple2[A, B]{x, y}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// The a intervals that overlap anything in t, or with invert, those that
+// overlap nothing.
+func IntersectAny[A, B ChrSpanner](a iter.Seq2[A, error], t *IntervalTree[B], invert bool) iter.Seq2[A, error] {
+	return func(yield func(A, error) bool) {
+		for x, e := range a {
+			if e != nil {
+				yield(x, e)
+				return
+			}
+			if t.HasOverlap(x) != invert {
+				if !yield(x, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// The parts of each a interval not covered by t. An interval split by t
+// yields one entry per remaining piece, each with the original fields.
+func Subtract[A BedEnter[T], T any, B ChrSpanner](a iter.Seq2[A, error], t *IntervalTree[B]) iter.Seq2[BedEntry[T], error] {
+	return func(yield func(BedEntry[T], error) bool) {
+		for x, e := range a {
+			if e != nil {
+				yield(BedEntry[T]{}, e)
+				return
+			}
+			pos := x.SpanStart()
+			// Overlaps come in start order, so pos only moves right.
+			for y := range t.Overlaps(x) {
+				if y.SpanStart() > pos {
+					if !yield(BedEntry[T]{ChrSpan{x.SpanChr(), Span{pos, y.SpanStart()}}, x.BedFields()}, nil) {
+						return
+					}
+				}
+				pos = max(pos, y.SpanEnd())
+			}
+			if pos < x.SpanEnd() {
+				if !yield(BedEntry[T]{ChrSpan{x.SpanChr(), Span{pos, x.SpanEnd()}}, x.BedFields()}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Merge sorted intervals that overlap or are within dist of each other,
+// combining the fields of each merged group with agg. Each group gets its own
+// slice, so agg may keep it.
+func MergeSorted[B BedEnter[T], T, U any](it iter.Seq2[B, error], dist int64, agg func([]T) (U, error)) iter.Seq2[BedEntry[U], error] {
+	return func(yield func(BedEntry[U], error) bool) {
+		var cur ChrSpan
+		var fields []T
+		started := false
+		emit := func() bool {
+			u, e := agg(fields)
+			return yield(BedEntry[U]{cur, u}, e) && e == nil
+		}
+		for b, e := range it {
+			if e != nil {
+				yield(BedEntry[U]{}, e)
+				return
+			}
+			cs := ToChrSpan(b)
+			if started && cs.Chr == cur.Chr && cs.Start < cur.Start {
+				yield(BedEntry[U]{}, fmt.Errorf("MergeSorted: input not sorted; %v after %v", cs, cur))
+				return
+			}
+			if started && cs.Chr == cur.Chr && cs.Start <= cur.End+dist {
+				cur.End = max(cur.End, cs.End)
+				fields = append(fields, b.BedFields())
+				continue
+			}
+			if started && !emit() {
+				return
+			}
+			cur = cs
+			fields = []T{b.BedFields()}
+			started = true
+		}
+		if started {
+			emit()
+		}
+	}
+}
+
+// Merge sorted intervals without keeping any fields.
+func MergeSpans[C ChrSpanner](it iter.Seq2[C, error], dist int64) iter.Seq2[ChrSpan, error] {
+	return func(yield func(ChrSpan, error) bool) {
+		wrapped := func(y func(BedEntry[struct{}], error) bool) {
+			for c, e := range it {
+				if !y(BedEntry[struct{}]{ChrSpan: ToChrSpan(c)}, e) {
+					return
+				}
+			}
+		}
+		for b, e := range MergeSorted(wrapped, dist, func([]struct{}) (struct{}, error) { return struct{}{}, nil }) {
+			if !yield(b.ChrSpan, e) {
+				return
+			}
+		}
+	}
+}
+
+// Regions of the genome not covered by any interval, in genome order.
+// Intervals need not be sorted.
+func Complement[C ChrSpanner](it iter.Seq2[C, error], genome []FaLen) iter.Seq2[ChrSpan, error] {
+	return func(yield func(ChrSpan, error) bool) {
+		items, e := CollectErr(it)
+		if e != nil {
+			yield(ChrSpan{}, e)
+			return
+		}
+		spans := make([]ChrSpan, 0, len(items))
+		lens := map[string]bool{}
+		for _, l := range genome {
+			lens[l.Name] = true
+		}
+		for _, c := range items {
+			if !lens[c.SpanChr()] {
+				yield(ChrSpan{}, fmt.Errorf("Complement: chromosome %v not in genome", c.SpanChr()))
+				return
+			}
+			spans = append(spans, ToChrSpan(c))
+		}
+		SortBed(spans)
+		merged, _ := CollectErr(MergeSpans(SliceIter2(spans), 0))
+		byChr := map[string][]ChrSpan{}
+		for _, m := range merged {
+			byChr[m.Chr] = append(byChr[m.Chr], m)
+		}
+
+		for _, l := range genome {
+			pos := int64(0)
+			for _, m := range byChr[l.Name] {
+				if m.Start > pos {
+					if !yield(ChrSpan{l.Name, Span{pos, min(m.Start, l.Len)}}, nil) {
+						return
+					}
+				}
+				pos = max(pos, m.End)
+			}
+			if pos < l.Len {
+				if !yield(ChrSpan{l.Name, Span{pos, l.Len}}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+type ClosestHit[A, B any] struct {
+	A A
+	// All equally close intervals; empty if none are on A's chromosome
+	B []B
+	// As in IntervalTree.Nearest
+	Distance int64
+}
+
+func Closest[A, B ChrSpanner](a iter.Seq2[A, error], t *IntervalTree[B]) iter.Seq2[ClosestHit[A, B], error] {
+	return func(yield func(ClosestHit[A, B], error) bool) {
+		for x, e := range a {
+			if e != nil {
+				yield(ClosestHit[A, B]{}, e)
+				return
+			}
+			bs, d := t.Nearest(x)
+			if !yield(ClosestHit[A, B]{x, bs, d}, nil) {
+				return
+			}
+		}
+	}
+}
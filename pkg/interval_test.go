@@ -0,0 +1,112 @@
+package fastats
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIntervalTreeOverlaps(t *testing.T) {
+	var items []ChrSpan
+	for i := int64(0); i < 50; i++ {
+		items = append(items, ChrSpan{"chr1", Span{i * 10, i*10 + 25}})
+	}
+	items = append(items, ChrSpan{"chr1", Span{0, 1000}}, ChrSpan{"chr2", Span{5, 6}})
+	tree := NewIntervalTree(items)
+
+	q := ChrSpan{"chr1", Span{100, 112}}
+	var exp []ChrSpan
+	for _, c := range items {
+		if _, ok := ChrSpanOverlap(c, q); ok {
+			exp = append(exp, c)
+		}
+	}
+	SortBed(exp)
+	got := Collect(tree.Overlaps(q))
+	SortBed(got)
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+	if tree.HasOverlap(ChrSpan{"chr2", Span{6, 10}}) || tree.HasOverlap(ChrSpan{"chr3", Span{0, 10}}) {
+		t.Errorf("unexpected overlap")
+	}
+}
+
+func TestNearest(t *testing.T) {
+	tree := NewIntervalTree([]ChrSpan{{"c", Span{0, 10}}, {"c", Span{5, 10}}, {"c", Span{30, 40}}, {"c", Span{50, 60}}})
+	got, d := tree.Nearest(ChrSpan{"c", Span{15, 20}})
+	if d != 6 || !reflect.DeepEqual(got, []ChrSpan{{"c", Span{0, 10}}, {"c", Span{5, 10}}}) {
+		t.Errorf("upstream: %v %v", got, d)
+	}
+	got, d = tree.Nearest(ChrSpan{"c", Span{22, 29}})
+	if d != 2 || !reflect.DeepEqual(got, []ChrSpan{{"c", Span{30, 40}}}) {
+		t.Errorf("downstream: %v %v", got, d)
+	}
+	got, d = tree.Nearest(ChrSpan{"c", Span{40, 45}})
+	if d != 1 || !reflect.DeepEqual(got, []ChrSpan{{"c", Span{30, 40}}}) {
+		t.Errorf("book-ended: %v %v", got, d)
+	}
+	if _, d = tree.Nearest(ChrSpan{"x", Span{0, 1}}); d != -1 {
+		t.Errorf("missing chromosome: %v", d)
+	}
+}
+
+const intervalsA = "chr1\t0\t100\ta1\t1\nchr1\t150\t200\ta2\t2\nchr1\t190\t300\ta3\t3\nchr2\t10\t20\ta4\t4\n"
+const intervalsB = "chr1\t50\t60\tb1\nchr1\t80\t160\tb2\n"
+
+func runIntervalsTest(t *testing.T, cmd string, f IntervalsFlags, exp string) {
+	dir := t.TempDir()
+	write := func(name, s string) string {
+		path := dir + "/" + name
+		if e := os.WriteFile(path, []byte(s), 0644); e != nil {
+			t.Fatal(e)
+		}
+		return path
+	}
+	f.A = write("a.bed", intervalsA)
+	f.B = write("b.bed", intervalsB)
+	f.Genome = write("g.txt", "chr1\t400\nchr2\t30\nchr3\t5\n")
+	var b strings.Builder
+	if e := runIntervals(&b, cmd, f); e != nil {
+		t.Fatal(e)
+	}
+	if b.String() != exp {
+		t.Errorf("%v: got:\n%v\nexp:\n%v", cmd, b.String(), exp)
+	}
+}
+
+func TestIntervalsCommands(t *testing.T) {
+	runIntervalsTest(t, "intersect", IntervalsFlags{WriteB: true},
+		"chr1\t50\t60\ta1\t1\tchr1\t50\t60\tb1\nchr1\t80\t100\ta1\t1\tchr1\t80\t160\tb2\nchr1\t150\t160\ta2\t2\tchr1\t80\t160\tb2\n")
+	runIntervalsTest(t, "intersect", IntervalsFlags{Invert: true},
+		"chr1\t190\t300\ta3\t3\nchr2\t10\t20\ta4\t4\n")
+	runIntervalsTest(t, "subtract", IntervalsFlags{},
+		"chr1\t0\t50\ta1\t1\nchr1\t60\t80\ta1\t1\nchr1\t160\t200\ta2\t2\nchr1\t190\t300\ta3\t3\nchr2\t10\t20\ta4\t4\n")
+	runIntervalsTest(t, "merge", IntervalsFlags{Cols: "4,5", Ops: "collapse,sum"},
+		"chr1\t0\t100\ta1\t1\nchr1\t150\t300\ta2,a3\t5\nchr2\t10\t20\ta4\t4\n")
+	runIntervalsTest(t, "complement", IntervalsFlags{},
+		"chr1\t100\t150\nchr1\t300\t400\nchr2\t0\t10\nchr2\t20\t30\nchr3\t0\t5\n")
+	runIntervalsTest(t, "closest", IntervalsFlags{Distance: true},
+		"chr1\t0\t100\ta1\t1\tchr1\t50\t60\tb1\t0\nchr1\t0\t100\ta1\t1\tchr1\t80\t160\tb2\t0\nchr1\t150\t200\ta2\t2\tchr1\t80\t160\tb2\t0\nchr1\t190\t300\ta3\t3\tchr1\t80\t160\tb2\t31\nchr2\t10\t20\ta4\t4\t.\t-1\t-1\t-1\n")
+}
+
+func TestMergeSortedKeepsGroups(t *testing.T) {
+	bed := []BedEntry[string]{
+		{ChrSpan{"chr1", Span{0, 10}}, "a"},
+		{ChrSpan{"chr1", Span{5, 15}}, "b"},
+		{ChrSpan{"chr1", Span{30, 40}}, "c"},
+	}
+	// agg keeps its slice, which must not be overwritten by later groups.
+	got, e := CollectErr(MergeSorted(SliceIter2(bed), 0, func(fs []string) ([]string, error) { return fs, nil }))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []BedEntry[[]string]{
+		{ChrSpan{"chr1", Span{0, 15}}, []string{"a", "b"}},
+		{ChrSpan{"chr1", Span{30, 40}}, []string{"c"}},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+}
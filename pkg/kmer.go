@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"iter"
 	"os"
+	"strings"
 )
 
 func AddKmers(kmap map[string]int64, k int, seq string) {
@@ -14,13 +15,34 @@ func AddKmers(kmap map[string]int64, k int, seq string) {
 	}
 }
 
+// Count each k-mer together with its reverse complement, under whichever of
+// the two sorts first. K-mers with letters other than ACGT are skipped.
+func AddCanonicalKmers(kmap map[string]int64, k int, seq string) {
+	seq = strings.ToUpper(seq)
+	for i := 0; i+k <= len(seq); i++ {
+		kmer := seq[i : i+k]
+		if DNAAlphabet.Validate(kmer) != nil {
+			continue
+		}
+		kmap[min(kmer, ReverseComplement(kmer))]++
+	}
+}
+
 func CountKmers[F FaEnter](it iter.Seq2[F, error], k int) (map[string]int64, error) {
+	return countKmers(it, k, AddKmers)
+}
+
+func CountCanonicalKmers[F FaEnter](it iter.Seq2[F, error], k int) (map[string]int64, error) {
+	return countKmers(it, k, AddCanonicalKmers)
+}
+
+func countKmers[F FaEnter](it iter.Seq2[F, error], k int, add func(map[string]int64, int, string)) (map[string]int64, error) {
 	m := map[string]int64{}
 	for f, err := range it {
 		if err != nil {
 			return m, err
 		}
-		AddKmers(m, k, f.FaSeq())
+		add(m, k, f.FaSeq())
 	}
 	return m, nil
 }
@@ -49,21 +71,70 @@ func KmerHist(it iter.Seq[Kmer]) []int64 {
 	return out
 }
 
-func FullCountKmers() {
-	k := flag.Int("k", 1, "k")
+type KmerFlags struct {
+	K           int
+	Canonical   bool
+	Fastq       bool
+	Threads     int
+	MaxDistinct int64
+}
+
+func parseKmerFlags() KmerFlags {
+	var f KmerFlags
+	flag.IntVar(&f.K, "k", 1, "k")
+	flag.BoolVar(&f.Canonical, "c", false, "Count k-mers together with their reverse complements")
+	flag.BoolVar(&f.Fastq, "fq", false, "Read fastq instead of fasta")
+	flag.IntVar(&f.Threads, "t", 0, "Counting threads (default GOMAXPROCS)")
+	flag.Int64Var(&f.MaxDistinct, "max", 0, "Fail after this many distinct k-mers (default no limit)")
 	flag.Parse()
+	return f
+}
+
+// Count k-mers from stdin, packed when k is small enough, and in a string
+// map otherwise.
+func countStdinKmers(f KmerFlags) (iter.Seq[Kmer], error) {
+	var fa iter.Seq2[FaEntry, error] = ParseFasta(os.Stdin)
+	if f.Fastq {
+		fa = func(yield func(FaEntry, error) bool) {
+			for fq, e := range ParseFastq(os.Stdin) {
+				if !yield(fq.FaEntry, e) {
+					return
+				}
+			}
+		}
+	}
 
-	it := ParseFasta(os.Stdin)
+	if f.K <= MaxPackedK {
+		c, e := CountPackedKmers(EntrySeqs(fa), KmerCountOptions{K: f.K, Canonical: f.Canonical, Threads: f.Threads, MaxDistinct: f.MaxDistinct})
+		if e != nil {
+			return nil, e
+		}
+		return c.Kmers(), nil
+	}
+
+	count := CountKmers[FaEntry]
+	if f.Canonical {
+		count = CountCanonicalKmers[FaEntry]
+	}
+	m, e := count(fa, f.K)
+	if e != nil {
+		return nil, e
+	}
+	return KmerIter(m), nil
+}
+
+func FullCountKmers() {
+	f := parseKmerFlags()
 	w := bufio.NewWriter(os.Stdout)
 	defer w.Flush()
 
-	m, e := CountKmers(it, *k)
+	kmers, e := countStdinKmers(f)
 	if e != nil {
 		panic(e)
 	}
 
-	for key, val := range m {
-		_, e := fmt.Fprintf(w, "%v\t%v\n", key, val)
+	for k := range kmers {
+		_, e := fmt.Fprintf(w, "%v\t%v\n", k.Seq, k.Count)
 		if e != nil {
 			panic(e)
 		}
@@ -71,23 +142,16 @@ func FullCountKmers() {
 }
 
 func FullKmerHist() {
-	k := flag.Int("k", 1, "k")
-	flag.Parse()
-
-	it := ParseFasta(os.Stdin)
+	f := parseKmerFlags()
 	w := bufio.NewWriter(os.Stdout)
 	defer w.Flush()
 
-	m, e := CountKmers(it, *k)
-	if e != nil {
-		panic(e)
-	}
-
-	hist := KmerHist(KmerIter(m))
+	kmers, e := countStdinKmers(f)
 	if e != nil {
 		panic(e)
 	}
 
+	hist := KmerHist(kmers)
 	for count, freq := range hist {
 		_, e := fmt.Fprintf(w, "%v\t%v\n", count, freq)
 		if e != nil {
@@ -0,0 +1,266 @@
+package fastats
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Read a k-mer histogram of count and frequency columns, as written by
+// kmerhist or jellyfish histo. out[count] is the number of distinct k-mers
+// seen count times.
+func ParseKmerHist(r io.Reader) ([]int64, error) {
+	var out []int64
+	s := bufio.NewScanner(r)
+	s.Buffer([]byte{}, 1e12)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("ParseKmerHist: len(fields) %v < 2; line %q", len(fields), s.Text())
+		}
+		count, e := strconv.ParseInt(fields[0], 10, 64)
+		if e != nil || count < 0 {
+			return nil, fmt.Errorf("ParseKmerHist: bad count in line %q", s.Text())
+		}
+		freq, e := strconv.ParseInt(fields[1], 10, 64)
+		if e != nil {
+			return nil, fmt.Errorf("ParseKmerHist: bad frequency in line %q", s.Text())
+		}
+		out = GrowLen(out, int(count)+1)
+		out[count] = freq
+	}
+	return out, s.Err()
+}
+
+// Negative binomial probability of x with mean mu and variance mu*(1+bias).
+func negBinomPmf(x, mu, bias float64) float64 {
+	size := mu / bias
+	lg1, _ := math.Lgamma(x + size)
+	lg2, _ := math.Lgamma(size)
+	lg3, _ := math.Lgamma(x + 1)
+	return math.Exp(lg1 - lg2 - lg3 + size*math.Log(size/(size+mu)) + x*math.Log(mu/(size+mu)))
+}
+
+// Minimize f from x0 with the Nelder-Mead simplex method.
+func nelderMead(f func([]float64) float64, x0 []float64, step float64, maxIter int, tol float64) ([]float64, float64, bool) {
+	n := len(x0)
+	pts := make([][]float64, n+1)
+	vals := make([]float64, n+1)
+	for i := range pts {
+		pts[i] = slices.Clone(x0)
+		if i > 0 {
+			pts[i][i-1] += step
+		}
+		vals[i] = f(pts[i])
+	}
+	order := make([]int, n+1)
+	along := func(c, p []float64, t float64) []float64 {
+		out := make([]float64, n)
+		for i := range out {
+			out[i] = c[i] + t*(p[i]-c[i])
+		}
+		return out
+	}
+
+	for iter := 0; iter < maxIter; iter++ {
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortFunc(order, func(a, b int) int { return cmp.Compare(vals[a], vals[b]) })
+		best, worst, second := order[0], order[n], order[n-1]
+		if math.Abs(vals[worst]-vals[best]) <= tol*(math.Abs(vals[best])+1e-300) {
+			return pts[best], vals[best], true
+		}
+
+		centroid := make([]float64, n)
+		for _, i := range order[:n] {
+			for j := range centroid {
+				centroid[j] += pts[i][j] / float64(n)
+			}
+		}
+		refl := along(centroid, pts[worst], -1)
+		rv := f(refl)
+		switch {
+		case rv < vals[best]:
+			exp := along(centroid, pts[worst], -2)
+			if ev := f(exp); ev < rv {
+				pts[worst], vals[worst] = exp, ev
+			} else {
+				pts[worst], vals[worst] = refl, rv
+			}
+		case rv < vals[second]:
+			pts[worst], vals[worst] = refl, rv
+		default:
+			con := along(centroid, pts[worst], 0.5)
+			if cv := f(con); cv < vals[worst] {
+				pts[worst], vals[worst] = con, cv
+				continue
+			}
+			for _, i := range order[1:] {
+				pts[i] = along(pts[best], pts[i], 0.5)
+				vals[i] = f(pts[i])
+			}
+		}
+	}
+	best := 0
+	for i := range vals {
+		if vals[i] < vals[best] {
+			best = i
+		}
+	}
+	return pts[best], vals[best], false
+}
+
+type KmerSpectrumOptions struct {
+	K int
+	// Largest k-mer count used in the fit, as in GenomeScope; 0 for all
+	MaxCount int
+}
+
+// A diploid k-mer spectrum model fit, in the style of GenomeScope. Lengths
+// are haploid.
+type KmerSpectrumFit struct {
+	K int
+	// All k-mers above ErrorCutoff, divided by the homozygous coverage
+	GenomeSize float64
+	// Length explained by the two-peak model
+	UniqueLength   float64
+	RepeatLength   float64
+	RepeatFraction float64
+	Heterozygosity float64
+	// Coverage of the heterozygous peak; the homozygous peak is twice this
+	KmerCoverage float64
+	// Negative binomial overdispersion: variance is coverage * (1 + Bias)
+	Bias float64
+	// Counts below this are treated as sequencing errors
+	ErrorCutoff int64
+	ErrorRate   float64
+	// Residual sum of squares of the fit
+	RSS       float64
+	Converged bool
+}
+
+// Expected number of distinct k-mers seen x times: a heterozygous peak at
+// coverage kcov and a homozygous peak at 2*kcov, with the fraction of k-mers
+// covering a heterozygous site 1-(1-het)^k.
+func kmerSpectrumModel(x float64, k int, length, het, kcov, bias float64) float64 {
+	p := 1 - math.Pow(1-het, float64(k))
+	return length * (2*p*negBinomPmf(x, kcov, bias) + (1-p)*negBinomPmf(x, 2*kcov, bias))
+}
+
+// The first local minimum of the histogram, where the error peak ends.
+func kmerErrorCutoff(hist []int64) int64 {
+	for x := 1; x+1 < len(hist); x++ {
+		if hist[x] < hist[x+1] {
+			return int64(x)
+		}
+	}
+	return 1
+}
+
+// Fit a k-mer histogram, where hist[count] is the number of distinct k-mers
+// seen count times. The error peak is cut off at the first local minimum of
+// the histogram, and the rest is fit with kmerSpectrumModel by least squares.
+func FitKmerSpectrum(hist []int64, o KmerSpectrumOptions) (KmerSpectrumFit, error) {
+	fit := KmerSpectrumFit{K: o.K}
+	if o.K < 1 {
+		return fit, fmt.Errorf("FitKmerSpectrum: k %v < 1", o.K)
+	}
+	maxX := len(hist) - 1
+	if o.MaxCount > 0 {
+		maxX = min(maxX, o.MaxCount)
+	}
+	fit.ErrorCutoff = kmerErrorCutoff(hist[:maxX+1])
+	cut := int(fit.ErrorCutoff)
+
+	var total, errs float64
+	peak := cut
+	for x := 1; x <= maxX; x++ {
+		total += float64(x) * float64(hist[x])
+		if x < cut {
+			errs += float64(x) * float64(hist[x])
+		} else if hist[x] > hist[peak] {
+			peak = x
+		}
+	}
+	if total == 0 || peak >= maxX {
+		return fit, fmt.Errorf("FitKmerSpectrum: no coverage peak above the error cutoff %v", cut)
+	}
+	if errs > 0 {
+		fit.ErrorRate = 1 - math.Pow(1-errs/total, 1/float64(o.K))
+	}
+
+	rss := func(length, het, kcov, bias float64) float64 {
+		sum := 0.0
+		for x := cut; x <= maxX; x++ {
+			d := float64(hist[x]) - kmerSpectrumModel(float64(x), o.K, length, het, kcov, bias)
+			sum += d * d
+		}
+		return sum
+	}
+	// Parameters are log length, logit of 2*het, log kcov and log bias, so
+	// that every point of the search space is valid.
+	unpack := func(p []float64) (float64, float64, float64, float64) {
+		return math.Exp(p[0]), 0.5 / (1 + math.Exp(-p[1])), math.Exp(p[2]), math.Exp(p[3])
+	}
+	objective := func(p []float64) float64 {
+		return rss(unpack(p))
+	}
+
+	// The highest peak may be either the heterozygous or homozygous one.
+	best := math.Inf(1)
+	for _, kcov := range []float64{float64(peak), float64(peak) / 2} {
+		length := (total - errs) / (2 * kcov)
+		x0 := []float64{math.Log(length), math.Log(0.002 / 0.998), math.Log(kcov), math.Log(0.5)}
+		p, v, ok := nelderMead(objective, x0, 0.5, 20000, 1e-12)
+		p, v, ok = nelderMead(objective, p, 0.1, 20000, 1e-12)
+		if v < best {
+			best = v
+			fit.UniqueLength, fit.Heterozygosity, fit.KmerCoverage, fit.Bias = unpack(p)
+			fit.RSS, fit.Converged = v, ok
+		}
+	}
+
+	fit.GenomeSize = (total - errs) / (2 * fit.KmerCoverage)
+	fit.RepeatLength = max(0, fit.GenomeSize-fit.UniqueLength)
+	fit.RepeatFraction = fit.RepeatLength / fit.GenomeSize
+	return fit, nil
+}
+
+type KmerFitFlags struct {
+	K        int
+	MaxCount int
+}
+
+func FullKmerFit() {
+	var f KmerFitFlags
+	flag.IntVar(&f.K, "k", 21, "k-mer length of the histogram")
+	flag.IntVar(&f.MaxCount, "m", 1000, "Largest k-mer count to fit (0 for all)")
+	flag.Parse()
+
+	hist, err := ParseKmerHist(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fit, err := FitKmerSpectrum(hist, KmerSpectrumOptions{K: f.K, MaxCount: f.MaxCount})
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(fit); err != nil {
+		log.Fatal(err)
+	}
+}
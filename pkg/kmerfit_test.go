@@ -0,0 +1,49 @@
+package fastats
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseKmerHist(t *testing.T) {
+	got, e := ParseKmerHist(strings.NewReader("1 10\n3\t4\n"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 4 || got[1] != 10 || got[2] != 0 || got[3] != 4 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestFitKmerSpectrum(t *testing.T) {
+	const k, length, het, kcov, bias = 21, 1e6, 0.01, 25.0, 0.3
+	// A duplicated region of this length shows up at twice the homozygous
+	// coverage and adds twice its length to the genome.
+	const dup = 25000.0
+	hist := make([]int64, 301)
+	for x := 1; x < len(hist); x++ {
+		y := kmerSpectrumModel(float64(x), k, length, het, kcov, bias)
+		y += dup * negBinomPmf(float64(x), 4*kcov, bias)
+		y += 4e6 * math.Pow(float64(x), -6)
+		hist[x] = int64(math.Round(y))
+	}
+
+	fit, e := FitKmerSpectrum(hist, KmerSpectrumOptions{K: k})
+	if e != nil {
+		t.Fatal(e)
+	}
+	near := func(name string, got, exp, tol float64) {
+		if math.Abs(got-exp) > tol*exp {
+			t.Errorf("%v: got %v, expected %v", name, got, exp)
+		}
+	}
+	near("GenomeSize", fit.GenomeSize, length+2*dup, 0.03)
+	near("UniqueLength", fit.UniqueLength, length, 0.03)
+	near("Heterozygosity", fit.Heterozygosity, het, 0.05)
+	near("KmerCoverage", fit.KmerCoverage, kcov, 0.02)
+	near("RepeatLength", fit.RepeatLength, 2*dup, 0.5)
+	if fit.ErrorCutoff < 2 || fit.ErrorCutoff > 15 || fit.ErrorRate <= 0 {
+		t.Errorf("errors: cutoff %v rate %v", fit.ErrorCutoff, fit.ErrorRate)
+	}
+}
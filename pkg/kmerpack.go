@@ -0,0 +1,287 @@
+package fastats
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// The largest k that fits in a packed uint64 k-mer.
+const MaxPackedK = 32
+
+var ErrKmerLimit = errors.New("too many distinct k-mers")
+
+var packBase = func() [256]int8 {
+	var t [256]int8
+	for i := range t {
+		t[i] = -1
+	}
+	for i, b := range "ACGT" {
+		t[b] = int8(i)
+		t[b+'a'-'A'] = int8(i)
+	}
+	return t
+}()
+
+func kmerMask(k int) uint64 {
+	if k >= 32 {
+		return ^uint64(0)
+	}
+	return 1<<(2*uint(k)) - 1
+}
+
+// Pack a k-mer two bits per base, A=0, C=1, G=2, T=3, with the first base in
+// the highest bits. Returns false if the k-mer is too long or has a base other
+// than ACGT.
+func PackKmer(kmer string) (uint64, bool) {
+	if len(kmer) > MaxPackedK {
+		return 0, false
+	}
+	var x uint64
+	for i := 0; i < len(kmer); i++ {
+		b := packBase[kmer[i]]
+		if b < 0 {
+			return 0, false
+		}
+		x = x<<2 | uint64(b)
+	}
+	return x, true
+}
+
+func UnpackKmer(x uint64, k int) string {
+	out := make([]byte, k)
+	for i := k - 1; i >= 0; i-- {
+		out[i] = "ACGT"[x&3]
+		x >>= 2
+	}
+	return string(out)
+}
+
+func RevCompPacked(x uint64, k int) uint64 {
+	var out uint64
+	for i := 0; i < k; i++ {
+		out = out<<2 | (3 - x&3)
+		x >>= 2
+	}
+	return out
+}
+
+// Every packed k-mer of seq, skipping those that contain a base other than
+// ACGT. With canonical set, each k-mer is the smaller of itself and its
+// reverse complement.
+func PackedKmers(seq string, k int, canonical bool) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		if k < 1 || k > MaxPackedK {
+			return
+		}
+		mask := kmerMask(k)
+		shift := 2 * uint(k-1)
+		var fwd, rev uint64
+		n := 0
+		for i := 0; i < len(seq); i++ {
+			b := packBase[seq[i]]
+			if b < 0 {
+				n = 0
+				continue
+			}
+			fwd = (fwd<<2 | uint64(b)) & mask
+			rev = rev>>2 | uint64(3-b)<<shift
+			if n++; n < k {
+				continue
+			}
+			x := fwd
+			if canonical && rev < fwd {
+				x = rev
+			}
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
+
+type KmerCountOptions struct {
+	K         int
+	Canonical bool
+	// Counting goroutines, and the number of shards; 0 for GOMAXPROCS
+	Threads int
+	// Stop with ErrKmerLimit once more than this many distinct k-mers are
+	// stored; 0 for no limit
+	MaxDistinct int64
+}
+
+// K-mer counts keyed by packed k-mer, split into shards by hash.
+type KmerCounts struct {
+	K         int
+	Canonical bool
+	shards    []map[uint64]int64
+}
+
+func kmerShard(x uint64, n int) int {
+	return int((x * 0x9E3779B97F4A7C15 >> 32) % uint64(n))
+}
+
+// The count of one k-mer, canonicalized if the counts are.
+func (c *KmerCounts) Get(kmer string) int64 {
+	x, ok := PackKmer(kmer)
+	if !ok || len(kmer) != c.K {
+		return 0
+	}
+	if c.Canonical {
+		x = min(x, RevCompPacked(x, c.K))
+	}
+	return c.shards[kmerShard(x, len(c.shards))][x]
+}
+
+// The number of distinct k-mers.
+func (c *KmerCounts) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += len(s)
+	}
+	return n
+}
+
+func (c *KmerCounts) Packed() iter.Seq2[uint64, int64] {
+	return func(yield func(uint64, int64) bool) {
+		for _, s := range c.shards {
+			for x, n := range s {
+				if !yield(x, n) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Every k-mer and its count, in no particular order, as for KmerHist.
+func (c *KmerCounts) Kmers() iter.Seq[Kmer] {
+	return func(yield func(Kmer) bool) {
+		for x, n := range c.Packed() {
+			if !yield(Kmer{UnpackKmer(x, c.K), n}) {
+				return
+			}
+		}
+	}
+}
+
+// The sequences of fasta or fastq entries.
+func EntrySeqs[F FaEnter](it iter.Seq2[F, error]) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for f, e := range it {
+			if !yield(f.FaSeq(), e) || e != nil {
+				return
+			}
+		}
+	}
+}
+
+const kmerBatchSize = 4096
+
+// K-mers buffered across all workers' batches, about 32 MB.
+const kmerBatchBudget = 1 << 22
+
+// Each of threads workers holds a batch for each of threads shards, so
+// batches shrink with threads squared to keep the total near
+// kmerBatchBudget.
+func kmerBatchLen(threads int) int {
+	return min(kmerBatchSize, max(16, kmerBatchBudget/(threads*threads)))
+}
+
+// Count the packed k-mers of seqs. Sequences are split among o.Threads
+// goroutines, which send their k-mers in batches to one goroutine per shard,
+// so that no map is shared.
+func CountPackedKmers(seqs iter.Seq2[string, error], o KmerCountOptions) (*KmerCounts, error) {
+	if o.K < 1 || o.K > MaxPackedK {
+		return nil, fmt.Errorf("CountPackedKmers: k %v not in 1 to %v", o.K, MaxPackedK)
+	}
+	threads := o.Threads
+	if threads < 1 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	c := &KmerCounts{K: o.K, Canonical: o.Canonical, shards: make([]map[uint64]int64, threads)}
+
+	batchLen := kmerBatchLen(threads)
+
+	var distinct atomic.Int64
+	var full atomic.Bool
+	shardChans := make([]chan []uint64, threads)
+	var shardWg sync.WaitGroup
+	for i := range shardChans {
+		shardChans[i] = make(chan []uint64, 4)
+		c.shards[i] = map[uint64]int64{}
+		shardWg.Add(1)
+		go func(m map[uint64]int64, ch chan []uint64) {
+			defer shardWg.Done()
+			for batch := range ch {
+				if full.Load() {
+					continue
+				}
+				for _, x := range batch {
+					if _, ok := m[x]; !ok && o.MaxDistinct > 0 && distinct.Add(1) > o.MaxDistinct {
+						full.Store(true)
+						break
+					}
+					m[x]++
+				}
+			}
+		}(c.shards[i], shardChans[i])
+	}
+
+	seqChan := make(chan string, threads)
+	var workWg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		workWg.Add(1)
+		go func() {
+			defer workWg.Done()
+			batches := make([][]uint64, threads)
+			for seq := range seqChan {
+				if full.Load() {
+					continue
+				}
+				for x := range PackedKmers(seq, o.K, o.Canonical) {
+					s := kmerShard(x, threads)
+					batches[s] = append(batches[s], x)
+					if len(batches[s]) == batchLen {
+						shardChans[s] <- batches[s]
+						batches[s] = make([]uint64, 0, batchLen)
+					}
+				}
+			}
+			for s, b := range batches {
+				if len(b) > 0 {
+					shardChans[s] <- b
+				}
+			}
+		}()
+	}
+
+	var err error
+	for seq, e := range seqs {
+		if e != nil {
+			err = e
+			break
+		}
+		if full.Load() {
+			break
+		}
+		seqChan <- seq
+	}
+	close(seqChan)
+	workWg.Wait()
+	for _, ch := range shardChans {
+		close(ch)
+	}
+	shardWg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	if full.Load() {
+		return nil, fmt.Errorf("CountPackedKmers: %w: more than %v", ErrKmerLimit, o.MaxDistinct)
+	}
+	return c, nil
+}
@@ -0,0 +1,101 @@
+package fastats
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPackKmer(t *testing.T) {
+	for _, s := range []string{"A", "ACGT", "TTTTGGGGCCCCAAAATTTTGGGGCCCCAAAA", "GATTACA"} {
+		x, ok := PackKmer(s)
+		if !ok {
+			t.Fatalf("%v not packed", s)
+		}
+		if got := UnpackKmer(x, len(s)); got != s {
+			t.Errorf("unpack %v != %v", got, s)
+		}
+		if got := UnpackKmer(RevCompPacked(x, len(s)), len(s)); got != ReverseComplement(s) {
+			t.Errorf("revcomp %v != %v", got, ReverseComplement(s))
+		}
+	}
+	if _, ok := PackKmer("ACN"); ok {
+		t.Errorf("packed N")
+	}
+}
+
+func randomSeqs(r *rand.Rand, n, length int) []FaEntry {
+	var out []FaEntry
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		for j := 0; j < length; j++ {
+			b.WriteByte("ACGTACGTACGTN"[r.Intn(13)])
+		}
+		out = append(out, FaEntry{"s", b.String()})
+	}
+	return out
+}
+
+func TestCountPackedKmers(t *testing.T) {
+	seqs := randomSeqs(rand.New(rand.NewSource(1)), 50, 300)
+	for _, k := range []int{3, 11, 32} {
+		for _, canonical := range []bool{false, true} {
+			exp := map[string]int64{}
+			for _, f := range seqs {
+				if canonical {
+					AddCanonicalKmers(exp, k, f.Seq)
+					continue
+				}
+				for i := 0; i+k <= len(f.Seq); i++ {
+					if kmer := f.Seq[i : i+k]; !strings.Contains(kmer, "N") {
+						exp[kmer]++
+					}
+				}
+			}
+
+			c, e := CountPackedKmers(EntrySeqs(SliceIter2(seqs)), KmerCountOptions{K: k, Canonical: canonical, Threads: 3})
+			if e != nil {
+				t.Fatal(e)
+			}
+			got := map[string]int64{}
+			for km := range c.Kmers() {
+				got[km.Seq] = km.Count
+			}
+			if len(got) != len(exp) || c.Len() != len(exp) {
+				t.Fatalf("k %v canonical %v: %v k-mers != %v", k, canonical, len(got), len(exp))
+			}
+			for kmer, n := range exp {
+				if got[kmer] != n || c.Get(kmer) != n {
+					t.Errorf("k %v canonical %v: %v: %v != %v", k, canonical, kmer, got[kmer], n)
+				}
+			}
+		}
+	}
+
+	// Many threads get small batches, which must still count everything.
+	if n := kmerBatchLen(128); n*128*128 > kmerBatchBudget {
+		t.Errorf("batch length %v at 128 threads exceeds the budget", n)
+	}
+	few, e := CountPackedKmers(EntrySeqs(SliceIter2(seqs)), KmerCountOptions{K: 11, Threads: 1})
+	if e != nil {
+		t.Fatal(e)
+	}
+	many, e := CountPackedKmers(EntrySeqs(SliceIter2(seqs)), KmerCountOptions{K: 11, Threads: 128})
+	if e != nil {
+		t.Fatal(e)
+	}
+	for km := range few.Kmers() {
+		if many.Get(km.Seq) != km.Count {
+			t.Errorf("128 threads: %v: %v != %v", km.Seq, many.Get(km.Seq), km.Count)
+		}
+	}
+	if many.Len() != few.Len() {
+		t.Errorf("128 threads: %v k-mers != %v", many.Len(), few.Len())
+	}
+
+	_, e = CountPackedKmers(EntrySeqs(SliceIter2(seqs)), KmerCountOptions{K: 11, Threads: 2, MaxDistinct: 100})
+	if !errors.Is(e, ErrKmerLimit) {
+		t.Errorf("expected ErrKmerLimit, got %v", e)
+	}
+}
@@ -0,0 +1,424 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+// One read's contribution to one reference position.
+type PileupRead struct {
+	Qname    string
+	QueryPos int64
+	// The read base, or '*' if the read has a deletion over this position
+	Base byte
+	// Raw phred+33 base quality, or 0 if the read has no qualities
+	Qual    byte
+	Mapq    int64
+	Reverse bool
+	// First or last aligned base of the read
+	ReadStart bool
+	ReadEnd   bool
+	// Bases inserted, or reference bases deleted, immediately after this
+	// position
+	Insertion string
+	Deletion  string
+}
+
+func (r PileupRead) IsDel() bool {
+	return r.Base == '*'
+}
+
+// The base error probability, or NaN for deletions and reads without
+// qualities.
+func (r PileupRead) ErrorProb() float64 {
+	if r.IsDel() || r.Qual < 33 {
+		return math.NaN()
+	}
+	return QualScore(r.Qual)
+}
+
+type PileupEntry struct {
+	Chr string
+	// 0-based
+	Pos     int64
+	RefBase byte
+	Reads   []PileupRead
+}
+
+func (p PileupEntry) SpanChr() string  { return p.Chr }
+func (p PileupEntry) SpanStart() int64 { return p.Pos }
+func (p PileupEntry) SpanEnd() int64   { return p.Pos + 1 }
+
+const PileupBases = "ACGTN"
+
+// Index of b in PileupBases, case-insensitive. Any non-ACGT base counts as N.
+func PileupBaseIndex(b byte) int {
+	switch upperBase(b) {
+	case 'A':
+		return 0
+	case 'C':
+		return 1
+	case 'G':
+		return 2
+	case 'T':
+		return 3
+	}
+	return 4
+}
+
+type PileupCounts struct {
+	Depth int64
+	// Indexed by PileupBaseIndex
+	Bases   [5]int64
+	Reverse [5]int64
+	// Sum of error probabilities per base, for mean base quality
+	ErrorProbs [5]float64
+	Deleted    int64
+	Insertions map[string]int64
+	Deletions  map[string]int64
+}
+
+func (p PileupEntry) Counts() PileupCounts {
+	c := PileupCounts{Insertions: map[string]int64{}, Deletions: map[string]int64{}}
+	for _, r := range p.Reads {
+		c.Depth++
+		if r.Insertion != "" {
+			c.Insertions[strings.ToUpper(r.Insertion)]++
+		}
+		if r.Deletion != "" {
+			c.Deletions[r.Deletion]++
+		}
+		if r.IsDel() {
+			c.Deleted++
+			continue
+		}
+		i := PileupBaseIndex(r.Base)
+		c.Bases[i]++
+		if r.Reverse {
+			c.Reverse[i]++
+		}
+		if p := r.ErrorProb(); !math.IsNaN(p) {
+			c.ErrorProbs[i] += p
+		}
+	}
+	return c
+}
+
+func (c PileupCounts) Count(base byte) int64 {
+	return c.Bases[PileupBaseIndex(base)]
+}
+
+type PileupOptions struct {
+	MinMapq      int64
+	MinBaseQual  int64
+	RequireFlags uint16
+	ExcludeFlags uint16
+}
+
+// Same default flag filter as samtools mpileup.
+func DefaultPileupOptions() PileupOptions {
+	return PileupOptions{ExcludeFlags: SamUnmapped | SamSecondary | SamQcFail | SamDuplicate}
+}
+
+func PileupKeep(s SamEntry, o PileupOptions) bool {
+	return SamCovKeep(s, SamCovOptions{MinMapq: o.MinMapq, RequireFlags: o.RequireFlags, ExcludeFlags: o.ExcludeFlags}) &&
+		s.CIGAR != "*" && s.Seq != "*"
+}
+
+// Reference sequences by name. Only the first word of each header is used.
+func PileupRefs[F FaEnter](refs []F) map[string]string {
+	out := make(map[string]string, len(refs))
+	for _, r := range refs {
+		name, _, _ := strings.Cut(r.FaHeader(), " ")
+		out[name] = r.FaSeq()
+	}
+	return out
+}
+
+type pileup struct {
+	o     PileupOptions
+	refs  map[string]string
+	yield func(PileupEntry, error) bool
+
+	chr      string
+	ref      string
+	bufStart int64
+	d        Deque[PileupEntry]
+}
+
+func (p *pileup) refBase(pos int64) byte {
+	if pos < int64(len(p.ref)) {
+		return upperBase(p.ref[pos])
+	}
+	return 'N'
+}
+
+// Emit all positions before pos, which no later alignment can cover.
+func (p *pileup) flushTo(pos int64) bool {
+	for p.bufStart < pos && p.d.Len() > 0 {
+		ent, _ := p.d.PopFront()
+		p.bufStart++
+		if len(ent.Reads) == 0 {
+			continue
+		}
+		if !p.yield(ent, nil) {
+			return false
+		}
+	}
+	if p.bufStart < pos {
+		p.bufStart = pos
+	}
+	return true
+}
+
+func (p *pileup) flushAll() bool {
+	return p.flushTo(p.bufStart + int64(p.d.Len()))
+}
+
+func (p *pileup) refSeq(start, end int64) string {
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		b.WriteByte(p.refBase(i))
+	}
+	return b.String()
+}
+
+// Add r at pos and return where it was stored.
+func (p *pileup) addRead(pos int64, r PileupRead) (idx, ridx int) {
+	idx = int(pos - p.bufStart)
+	for p.d.Len() <= idx {
+		n := p.bufStart + int64(p.d.Len())
+		p.d.PushBack(PileupEntry{Chr: p.chr, Pos: n, RefBase: p.refBase(n)})
+	}
+	ent := p.d.Get(idx)
+	ent.Reads = append(ent.Reads, r)
+	p.d.Set(idx, ent)
+	return idx, len(ent.Reads) - 1
+}
+
+func (p *pileup) read(idx, ridx int) *PileupRead {
+	return &p.d.Get(idx).Reads[ridx]
+}
+
+func (p *pileup) add(s SamEntry) error {
+	ops, e := ParseCIGAR(s.CIGAR)
+	if e != nil {
+		return e
+	}
+	if ql := CIGARQueryLen(ops); ql != int64(len(s.Seq)) {
+		return fmt.Errorf("Pileup: read %v: CIGAR query length %v != len(seq) %v", s.Qname, ql, len(s.Seq))
+	}
+	hasQual := s.Qual != "*"
+	if hasQual && len(s.Qual) != len(s.Seq) {
+		return fmt.Errorf("Pileup: read %v: len(qual) %v != len(seq) %v", s.Qname, len(s.Qual), len(s.Seq))
+	}
+
+	// Where this read's previous base was stored, so that indels can be
+	// attached to it; idx is -1 if the previous base was not kept.
+	idx, ridx := -1, -1
+	first, lastIdx, lastRidx := true, -1, -1
+	ref, q := s.Pos-1, int64(0)
+	base := PileupRead{Qname: s.Qname, Mapq: s.Mapq, Reverse: s.Flag&SamReverse != 0}
+
+	for _, op := range ops {
+		switch op.Letter {
+		case 'M', '=', 'X':
+			for i := int64(0); i < op.Count; i++ {
+				r := base
+				r.QueryPos = q + i
+				r.Base = s.Seq[q+i]
+				if hasQual {
+					r.Qual = s.Qual[q+i]
+				}
+				if hasQual && int64(r.Qual)-33 < p.o.MinBaseQual {
+					idx = -1
+					continue
+				}
+				r.ReadStart = first
+				first = false
+				idx, ridx = p.addRead(ref+i, r)
+				lastIdx, lastRidx = idx, ridx
+			}
+			ref += op.Count
+			q += op.Count
+		case 'D':
+			if idx >= 0 {
+				p.read(idx, ridx).Deletion = p.refSeq(ref, ref+op.Count)
+			}
+			for i := int64(0); i < op.Count; i++ {
+				r := base
+				r.QueryPos = q
+				r.Base = '*'
+				idx, ridx = p.addRead(ref+i, r)
+			}
+			ref += op.Count
+		case 'I':
+			if idx >= 0 {
+				p.read(idx, ridx).Insertion += s.Seq[q : q+op.Count]
+			}
+			q += op.Count
+		case 'N':
+			idx = -1
+			ref += op.Count
+		case 'S':
+			q += op.Count
+		}
+	}
+	if lastIdx >= 0 {
+		p.read(lastIdx, lastRidx).ReadEnd = true
+	}
+	return nil
+}
+
+// Pile up coordinate-sorted alignments against refs, yielding one entry per
+// covered reference position in order. Positions on references missing from
+// refs get an 'N' reference base.
+func Pileup(it iter.Seq2[SamEntry, error], refs map[string]string, o PileupOptions) iter.Seq2[PileupEntry, error] {
+	return func(yield func(PileupEntry, error) bool) {
+		p := &pileup{o: o, refs: refs, yield: yield}
+		seen := map[string]bool{}
+
+		for s, e := range it {
+			if e != nil {
+				yield(PileupEntry{}, e)
+				return
+			}
+			if !PileupKeep(s, o) {
+				continue
+			}
+			if s.Rname != p.chr {
+				if seen[s.Rname] {
+					yield(PileupEntry{}, fmt.Errorf("Pileup: alignments not sorted; %v appears twice", s.Rname))
+					return
+				}
+				seen[s.Rname] = true
+				if !p.flushAll() {
+					return
+				}
+				p.chr = s.Rname
+				p.ref = refs[s.Rname]
+				p.bufStart = 0
+			}
+			pos := s.Pos - 1
+			if pos < p.bufStart {
+				yield(PileupEntry{}, fmt.Errorf("Pileup: alignments not sorted; %v:%v after %v", s.Rname, s.Pos, p.bufStart+1))
+				return
+			}
+			if !p.flushTo(pos) {
+				return
+			}
+			if e := p.add(s); e != nil {
+				yield(PileupEntry{}, e)
+				return
+			}
+		}
+		p.flushAll()
+	}
+}
+
+func caseByStrand(s string, reverse bool) string {
+	if reverse {
+		return strings.ToLower(s)
+	}
+	return strings.ToUpper(s)
+}
+
+// Write p in samtools mpileup format: chromosome, 1-based position, reference
+// base, depth, read bases and base qualities.
+func WritePileupEntry(w io.Writer, p PileupEntry) error {
+	var bases, quals strings.Builder
+	for _, r := range p.Reads {
+		if r.ReadStart {
+			bases.WriteByte('^')
+			bases.WriteByte(byte(min(max(r.Mapq, 0), 93) + 33))
+		}
+		switch {
+		case r.IsDel():
+			bases.WriteByte('*')
+		case upperBase(r.Base) == p.RefBase && r.Reverse:
+			bases.WriteByte(',')
+		case upperBase(r.Base) == p.RefBase:
+			bases.WriteByte('.')
+		default:
+			bases.WriteString(caseByStrand(string(r.Base), r.Reverse))
+		}
+		if r.Insertion != "" {
+			fmt.Fprintf(&bases, "+%v%v", len(r.Insertion), caseByStrand(r.Insertion, r.Reverse))
+		}
+		if r.Deletion != "" {
+			fmt.Fprintf(&bases, "-%v%v", len(r.Deletion), caseByStrand(r.Deletion, r.Reverse))
+		}
+		if r.ReadEnd {
+			bases.WriteByte('$')
+		}
+		if r.Qual < 33 {
+			quals.WriteByte('!')
+		} else {
+			quals.WriteByte(r.Qual)
+		}
+	}
+	_, e := fmt.Fprintf(w, "%v\t%v\t%c\t%v\t%v\t%v\n", p.Chr, p.Pos+1, p.RefBase, len(p.Reads), bases.String(), quals.String())
+	return e
+}
+
+func WritePileup(w io.Writer, it iter.Seq2[PileupEntry, error]) error {
+	for p, e := range it {
+		if e != nil {
+			return e
+		}
+		if e := WritePileupEntry(w, p); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func FullPileup() {
+	o := DefaultPileupOptions()
+	var requireFlags, excludeFlags uint
+	refp := flag.String("f", "", "Reference fasta (required)")
+	flag.Int64Var(&o.MinMapq, "q", 0, "Minimum mapping quality")
+	flag.Int64Var(&o.MinBaseQual, "Q", 13, "Minimum base quality")
+	flag.UintVar(&requireFlags, "rf", 0, "Only use alignments with all of these flags")
+	flag.UintVar(&excludeFlags, "ff", uint(o.ExcludeFlags), "Skip alignments with any of these flags")
+	flag.Parse()
+	o.RequireFlags = uint16(requireFlags)
+	o.ExcludeFlags = uint16(excludeFlags)
+	if *refp == "" {
+		log.Fatal("missing -f")
+	}
+
+	rr, e := zfile.Open(*refp)
+	if e != nil {
+		log.Fatal(e)
+	}
+	refs, e := CollectErr(ParseFasta(rr))
+	rr.Close()
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	_, it, e := ParseSamOrBamPlusHeader(os.Stdin)
+	if e != nil {
+		log.Fatal(e)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+
+	if e := WritePileup(w, Pileup(it, PileupRefs(refs), o)); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -0,0 +1,75 @@
+package fastats
+
+import (
+	"strings"
+	"testing"
+)
+
+const pileupSam = `@SQ	SN:chr1	LN:12
+r1	0	chr1	2	60	4M	*	0	0	ACTT	IIII
+r2	16	chr1	3	30	1M1I1M2D2M	*	0	0	CAGTC	II#II
+r3	0	chr1	4	60	2S2M	*	0	0	GGAT	IIII
+`
+
+func TestPileup(t *testing.T) {
+	ref := []FaEntry{{Header: "chr1 test", Seq: "AACGTACGTAAA"}}
+	_, it, e := ParseSamPlusHeader(strings.NewReader(pileupSam))
+	if e != nil {
+		t.Fatal(e)
+	}
+	o := DefaultPileupOptions()
+	o.MinBaseQual = 10
+	got, e := CollectErr(Pileup(it, PileupRefs(ref), o))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	var b strings.Builder
+	for _, p := range got {
+		if e := WritePileupEntry(&b, p); e != nil {
+			t.Fatal(e)
+		}
+	}
+	exp := `chr1	2	A	1	^].	I
+chr1	3	C	2	.^?,+1a	II
+chr1	4	G	2	T^]A	II
+chr1	5	T	3	.$*.$	I!I
+chr1	6	A	1	*	!
+chr1	7	C	1	t	I
+chr1	8	G	1	c$	I
+`
+	if b.String() != exp {
+		t.Errorf("got:\n%v\nexp:\n%v", b.String(), exp)
+	}
+
+	c := got[2].Counts()
+	if c.Depth != 2 || c.Count('T') != 1 || c.Count('a') != 1 {
+		t.Errorf("counts %+v", c)
+	}
+	c = got[1].Counts()
+	if c.Insertions["A"] != 1 || c.Reverse[PileupBaseIndex('C')] != 1 {
+		t.Errorf("counts %+v", c)
+	}
+}
+
+func TestPileupDeletion(t *testing.T) {
+	ref := map[string]string{"chr1": "ACGTACGT"}
+	s := `r1	0	chr1	1	60	2M3D1M	*	0	0	ACA	III
+`
+	got, e := CollectErr(Pileup(ParseSam(strings.NewReader(s)), ref, DefaultPileupOptions()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 6 {
+		t.Fatalf("len(got) %v != 6", len(got))
+	}
+	if d := got[1].Reads[0].Deletion; d != "GTA" {
+		t.Errorf("deletion %q != GTA", d)
+	}
+	if c := got[1].Counts(); c.Deletions["GTA"] != 1 {
+		t.Errorf("counts %+v", c)
+	}
+	if c := got[3].Counts(); c.Deleted != 1 || c.Depth != 1 {
+		t.Errorf("counts %+v", c)
+	}
+}
@@ -0,0 +1,318 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"iter"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// Allele counts at one VCF site, per sample group.
+type PopGenSite struct {
+	ChrSpan
+	// Counts[group][allele], with allele 0 the reference
+	Counts [][]int
+}
+
+// Count the called alleles of each group of samples at each site. Groups are
+// lists of sample indices.
+func PopGenSites(it iter.Seq2[VcfEntry[VcfTypedInfoSamples], error], groups [][]int) iter.Seq2[PopGenSite, error] {
+	return func(yield func(PopGenSite, error) bool) {
+		for v, e := range it {
+			if e != nil {
+				yield(PopGenSite{}, e)
+				return
+			}
+			gts, e := VcfGenotypes(v.InfoAndSamples)
+			if e != nil {
+				yield(PopGenSite{}, fmt.Errorf("PopGenSites: %v:%v: %w", v.Chr, v.Start+1, e))
+				return
+			}
+			s := PopGenSite{ChrSpan: ChrSpan{v.Chr, Span{v.Start, v.Start + 1}}, Counts: make([][]int, len(groups))}
+			nalleles := len(v.Alts) + 1
+			if len(v.Alts) == 1 && v.Alts[0] == "." {
+				nalleles = 1
+			}
+			for i, g := range groups {
+				s.Counts[i] = make([]int, nalleles)
+				for _, idx := range g {
+					if idx >= len(gts) {
+						yield(PopGenSite{}, fmt.Errorf("PopGenSites: %v:%v: no sample %v", v.Chr, v.Start+1, idx))
+						return
+					}
+					for _, a := range gts[idx].Alleles {
+						if a == GenotypeMissing {
+							continue
+						}
+						if a >= nalleles {
+							yield(PopGenSite{}, fmt.Errorf("%w: PopGenSites: %v:%v: allele %v out of range", ErrVcfFormat, v.Chr, v.Start+1, a))
+							return
+						}
+						s.Counts[i][a]++
+					}
+				}
+			}
+			if !yield(s, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Look up the samples of each group by name.
+func PopGenGroups(h VcfMeta, names [][]string) ([][]int, error) {
+	out := make([][]int, 0, len(names))
+	for _, group := range names {
+		var idxs []int
+		for _, name := range group {
+			i := h.SampleIndex(name)
+			if i < 0 {
+				return nil, fmt.Errorf("PopGenGroups: sample %v not in VCF header", name)
+			}
+			idxs = append(idxs, i)
+		}
+		out = append(out, idxs)
+	}
+	return out, nil
+}
+
+func sumInts(xs []int) int {
+	n := 0
+	for _, x := range xs {
+		n += x
+	}
+	return n
+}
+
+// Unbiased expected heterozygosity of one site, n/(n-1) * (1 - sum p^2), or
+// NaN with fewer than two called alleles.
+func SitePi(counts []int) float64 {
+	n := sumInts(counts)
+	if n < 2 {
+		return math.NaN()
+	}
+	h := 1.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * p
+	}
+	return h * float64(n) / float64(n-1)
+}
+
+func IsSegregating(counts []int) bool {
+	seen := 0
+	for _, c := range counts {
+		if c > 0 {
+			seen++
+		}
+	}
+	return seen > 1
+}
+
+func wattersonA(n int) (a1, a2 float64) {
+	for i := 1; i < n; i++ {
+		a1 += 1 / float64(i)
+		a2 += 1 / float64(i*i)
+	}
+	return a1, a2
+}
+
+func windowPi(sites []PopGenSite, group int) float64 {
+	pi := 0.0
+	for _, s := range sites {
+		if p := SitePi(s.Counts[group]); !math.IsNaN(p) {
+			pi += p
+		}
+	}
+	return pi
+}
+
+// Watterson's theta summed over segregating sites, each scaled by a1 for the
+// number of alleles called at that site.
+func windowThetaW(sites []PopGenSite, group int) float64 {
+	theta := 0.0
+	for _, s := range sites {
+		if IsSegregating(s.Counts[group]) {
+			a1, _ := wattersonA(sumInts(s.Counts[group]))
+			theta += 1 / a1
+		}
+	}
+	return theta
+}
+
+// Tajima's D, using the mean number of called alleles at segregating sites
+// as the sample size.
+func windowTajimasD(sites []PopGenSite, group int) float64 {
+	pi, segs, nsum := 0.0, 0, 0
+	for _, s := range sites {
+		c := s.Counts[group]
+		if !IsSegregating(c) {
+			continue
+		}
+		pi += SitePi(c)
+		segs++
+		nsum += sumInts(c)
+	}
+	if segs == 0 {
+		return math.NaN()
+	}
+	n := int(math.Round(float64(nsum) / float64(segs)))
+	if n < 4 {
+		return math.NaN()
+	}
+
+	fn := float64(n)
+	S := float64(segs)
+	a1, a2 := wattersonA(n)
+	b1 := (fn + 1) / (3 * (fn - 1))
+	b2 := 2 * (fn*fn + fn + 3) / (9 * fn * (fn - 1))
+	c1 := b1 - 1/a1
+	c2 := b2 - (fn+2)/(a1*fn) + a2/(a1*a1)
+	e1 := c1 / a1
+	e2 := c2 / (a1*a1 + a2)
+	return (pi - S/a1) / math.Sqrt(e1*S+e2*S*(S-1))
+}
+
+// Hudson's FST as 1 - Hw/Hb, with the within- and between-group diversities
+// summed over the window before taking the ratio.
+func windowFst(sites []PopGenSite, g1, g2 int) float64 {
+	hw, hb := 0.0, 0.0
+	for _, s := range sites {
+		c1, c2 := s.Counts[g1], s.Counts[g2]
+		n1, n2 := sumInts(c1), sumInts(c2)
+		if n1 < 2 || n2 < 2 {
+			continue
+		}
+		same := 0.0
+		for a := range c1 {
+			same += float64(c1[a]) / float64(n1) * float64(c2[a]) / float64(n2)
+		}
+		hw += (SitePi(c1) + SitePi(c2)) / 2
+		hb += 1 - same
+	}
+	if hb == 0 {
+		return math.NaN()
+	}
+	return 1 - hw/hb
+}
+
+func windowPopGen(it iter.Seq2[PopGenSite, error], winsize, winstep int, f func(win ChrSpan, sites []PopGenSite) float64) iter.Seq2[BedEntry[float64], error] {
+	return func(yield func(BedEntry[float64], error) bool) {
+		for win, e := range WindowSortedBed(it, winsize, winstep) {
+			if e != nil {
+				yield(BedEntry[float64]{}, e)
+				return
+			}
+			if !yield(BedEntry[float64]{win.ChrSpan, f(win.ChrSpan, win.Fields)}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func perBpIf(x float64, win ChrSpan, perBp bool) float64 {
+	if perBp {
+		return x / float64(win.End-win.Start)
+	}
+	return x
+}
+
+// Nucleotide diversity of one group in sliding windows over sorted sites.
+func WindowPi(it iter.Seq2[PopGenSite, error], group, winsize, winstep int, perBp bool) iter.Seq2[BedEntry[float64], error] {
+	return windowPopGen(it, winsize, winstep, func(win ChrSpan, sites []PopGenSite) float64 {
+		return perBpIf(windowPi(sites, group), win, perBp)
+	})
+}
+
+func WindowThetaW(it iter.Seq2[PopGenSite, error], group, winsize, winstep int, perBp bool) iter.Seq2[BedEntry[float64], error] {
+	return windowPopGen(it, winsize, winstep, func(win ChrSpan, sites []PopGenSite) float64 {
+		return perBpIf(windowThetaW(sites, group), win, perBp)
+	})
+}
+
+func WindowTajimasD(it iter.Seq2[PopGenSite, error], group, winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+	return windowPopGen(it, winsize, winstep, func(win ChrSpan, sites []PopGenSite) float64 {
+		return windowTajimasD(sites, group)
+	})
+}
+
+func WindowFst(it iter.Seq2[PopGenSite, error], g1, g2, winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+	return windowPopGen(it, winsize, winstep, func(win ChrSpan, sites []PopGenSite) float64 {
+		return windowFst(sites, g1, g2)
+	})
+}
+
+type PopGenFlags struct {
+	Stat    string
+	WinSize int
+	WinStep int
+	PerBp   bool
+	Group1  string
+	Group2  string
+}
+
+func splitSampleNames(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func FullPopGen() {
+	var f PopGenFlags
+	flag.StringVar(&f.Stat, "stat", "pi", "Statistic to calculate: pi, thetaw, tajimad or fst")
+	flag.IntVar(&f.WinSize, "w", 10000, "Set the window size")
+	flag.IntVar(&f.WinStep, "s", 10000, "Set the window step")
+	flag.BoolVar(&f.PerBp, "b", false, "Divide pi and thetaw by size of window")
+	flag.StringVar(&f.Group1, "g1", "", "Comma-separated samples of the first group (default: all samples)")
+	flag.StringVar(&f.Group2, "g2", "", "Comma-separated samples of the second group, for fst")
+	flag.Parse()
+
+	h, it, e := ParseTypedVcf(os.Stdin)
+	if e != nil {
+		log.Fatal(e)
+	}
+	names := [][]string{splitSampleNames(f.Group1)}
+	if names[0] == nil {
+		names[0] = h.Samples
+	}
+	if f.Stat == "fst" {
+		if f.Group2 == "" {
+			log.Fatal("fst requires -g1 and -g2")
+		}
+		names = append(names, splitSampleNames(f.Group2))
+	}
+	groups, e := PopGenGroups(h, names)
+	if e != nil {
+		log.Fatal(e)
+	}
+	sites := PopGenSites(it, groups)
+
+	var wins iter.Seq2[BedEntry[float64], error]
+	switch f.Stat {
+	case "pi":
+		wins = WindowPi(sites, 0, f.WinSize, f.WinStep, f.PerBp)
+	case "thetaw":
+		wins = WindowThetaW(sites, 0, f.WinSize, f.WinStep, f.PerBp)
+	case "tajimad":
+		wins = WindowTajimasD(sites, 0, f.WinSize, f.WinStep)
+	case "fst":
+		wins = WindowFst(sites, 0, 1, f.WinSize, f.WinStep)
+	default:
+		log.Fatalf("unknown -stat %v", f.Stat)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	if _, e := WriteFloatBed(w, wins); e != nil {
+		log.Fatal(e)
+	}
+}
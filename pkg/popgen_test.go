@@ -0,0 +1,65 @@
+package fastats
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const popgenVcf = `##fileformat=VCFv4.2
+##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO	FORMAT	a	b	c	d
+chr1	10	.	A	T	.	PASS	.	GT	0/0	0/1	0/1	1/1
+chr1	20	.	C	G	.	PASS	.	GT	0/0	0/0	0/0	0/1
+chr1	150	.	G	T	.	PASS	.	GT	0/0	0/0	0/0	0/0
+`
+
+func popgenSites(t *testing.T, groups [][]string) []PopGenSite {
+	h, it, e := ParseTypedVcf(strings.NewReader(popgenVcf))
+	if e != nil {
+		t.Fatal(e)
+	}
+	g, e := PopGenGroups(h, groups)
+	if e != nil {
+		t.Fatal(e)
+	}
+	sites, e := CollectErr(PopGenSites(it, g))
+	if e != nil {
+		t.Fatal(e)
+	}
+	return sites
+}
+
+func checkWins(t *testing.T, name string, it func(func(BedEntry[float64], error) bool), exp []float64) {
+	got, e := CollectErr(it)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != len(exp) {
+		t.Fatalf("%v: got %v windows, exp %v", name, len(got), len(exp))
+	}
+	for i, b := range got {
+		if math.Abs(b.Fields-exp[i]) > 1e-9 && !(math.IsNaN(b.Fields) && math.IsNaN(exp[i])) {
+			t.Errorf("%v: window %v: got %v != exp %v", name, b.ChrSpan, b.Fields, exp[i])
+		}
+	}
+}
+
+func TestPopGenWindows(t *testing.T) {
+	all := popgenSites(t, [][]string{{"a", "b", "c", "d"}})
+	a1, _ := wattersonA(8)
+
+	checkWins(t, "pi", WindowPi(SliceIter2(all), 0, 100, 100, false), []float64{4.0/7 + 0.25, 0})
+	checkWins(t, "thetaw", WindowThetaW(SliceIter2(all), 0, 100, 100, false), []float64{2 / a1, 0})
+
+	d, e := CollectErr(WindowTajimasD(SliceIter2(all), 0, 100, 100))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if math.IsNaN(d[0].Fields) || !math.IsNaN(d[1].Fields) {
+		t.Errorf("tajima's D %v", d)
+	}
+
+	two := popgenSites(t, [][]string{{"a", "b"}, {"c", "d"}})
+	checkWins(t, "fst", WindowFst(SliceIter2(two), 0, 1, 100, 100), []float64{1.0 / 7, math.NaN()})
+}
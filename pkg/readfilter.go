@@ -0,0 +1,325 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"math"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+// Criteria a read must meet to be kept. DefaultReadFilterOptions keeps
+// everything.
+type ReadFilterOptions struct {
+	MinLen int
+	// 0 for no limit
+	MaxLen int
+	// Lowest mean quality, as the phred score of the mean error probability
+	// by QualScore. Only applies to fastq.
+	MinMeanQual float64
+	// Highest fraction of N; 1 for no limit
+	MaxNFrac float64
+	// Headers must match this, if set
+	HeaderRe *regexp.Regexp
+	// Read names, as by FqReadName, must be in this set, if set
+	IDs map[string]struct{}
+}
+
+func DefaultReadFilterOptions() *ReadFilterOptions {
+	return &ReadFilterOptions{MaxNFrac: 1}
+}
+
+// The phred score of the mean error probability of qual, as in MeanQual.
+func ReadMeanQual(qual string) float64 {
+	if len(qual) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i := 0; i < len(qual); i++ {
+		sum += QualScore(qual[i])
+	}
+	return -10 * math.Log10(sum/float64(len(qual)))
+}
+
+func nFrac(seq string) float64 {
+	if len(seq) == 0 {
+		return 0
+	}
+	n := 0
+	for i := 0; i < len(seq); i++ {
+		if isN(seq[i]) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(seq))
+}
+
+// Whether f meets every criterion of o.
+func KeepRead[F FaEnter](f F, o *ReadFilterOptions) bool {
+	seq := f.FaSeq()
+	if len(seq) < o.MinLen || (o.MaxLen > 0 && len(seq) > o.MaxLen) {
+		return false
+	}
+	if o.MaxNFrac < 1 && nFrac(seq) > o.MaxNFrac {
+		return false
+	}
+	if o.MinMeanQual > 0 {
+		if fq, ok := any(f).(FqEnter); ok && ReadMeanQual(fq.FqQual()) < o.MinMeanQual {
+			return false
+		}
+	}
+	if o.HeaderRe != nil && !o.HeaderRe.MatchString(f.FaHeader()) {
+		return false
+	}
+	if o.IDs != nil {
+		if _, ok := o.IDs[FqReadName(f.FaHeader())]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func FilterReads[F FaEnter](it iter.Seq2[F, error], o *ReadFilterOptions) iter.Seq2[F, error] {
+	return func(yield func(F, error) bool) {
+		for f, e := range it {
+			if e != nil {
+				yield(f, e)
+				return
+			}
+			if KeepRead(f, o) && !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Keep pairs where both mates pass.
+func FilterReadPairs[F FaEnter](it iter.Seq2[Tuple2[F, F], error], o *ReadFilterOptions) iter.Seq2[Tuple2[F, F], error] {
+	return func(yield func(Tuple2[F, F], error) bool) {
+		for pair, e := range it {
+			if e != nil {
+				yield(pair, e)
+				return
+			}
+			if KeepRead(pair.V1, o) && KeepRead(pair.V2, o) && !yield(pair, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Read names, one per line, ignoring anything after the first whitespace and
+// any leading '@' or '>'.
+func ReadIDList(r io.Reader) (map[string]struct{}, error) {
+	ids := map[string]struct{}{}
+	s := bufio.NewScanner(r)
+	s.Buffer([]byte{}, 1e12)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		ids[FqReadName(strings.TrimLeft(fields[0], "@>"))] = struct{}{}
+	}
+	return ids, s.Err()
+}
+
+// Keep each item with probability frac, with a random source seeded by seed
+// so that runs are reproducible.
+func SubsampleFrac[T any](it iter.Seq2[T, error], frac float64, seed int64) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		r := rand.New(rand.NewSource(seed))
+		for t, e := range it {
+			if e != nil {
+				yield(t, e)
+				return
+			}
+			if r.Float64() < frac && !yield(t, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Exactly n items, or all of them if there are fewer, chosen uniformly by
+// reservoir sampling with a random source seeded by seed. The items stay in
+// input order.
+func ReservoirSample[T any](it iter.Seq2[T, error], n int, seed int64) ([]T, error) {
+	type indexed struct {
+		i int
+		t T
+	}
+	r := rand.New(rand.NewSource(seed))
+	var res []indexed
+	i := 0
+	for t, e := range it {
+		if e != nil {
+			return nil, e
+		}
+		if len(res) < n {
+			res = append(res, indexed{i, t})
+		} else if j := r.Intn(i + 1); j < n {
+			res[j] = indexed{i, t}
+		}
+		i++
+	}
+	slices.SortFunc(res, func(a, b indexed) int { return a.i - b.i })
+	out := make([]T, 0, len(res))
+	for _, x := range res {
+		out = append(out, x.t)
+	}
+	return out, nil
+}
+
+// Subsample by count if count >= 0, or else by frac if it is below 1.
+func subsampleReads[T any](it iter.Seq2[T, error], frac float64, count int, seed int64) iter.Seq2[T, error] {
+	if count >= 0 {
+		return func(yield func(T, error) bool) {
+			s, e := ReservoirSample(it, count, seed)
+			if e != nil {
+				var zero T
+				yield(zero, e)
+				return
+			}
+			for _, t := range s {
+				if !yield(t, nil) {
+					return
+				}
+			}
+		}
+	}
+	if frac < 1 {
+		return SubsampleFrac(it, frac, seed)
+	}
+	return it
+}
+
+type ReadFilterFlags struct {
+	R1          string
+	R2          string
+	Out1        string
+	Out2        string
+	Interleaved bool
+	Fasta       bool
+	MinLen      int
+	MaxLen      int
+	MinQual     float64
+	MaxNFrac    float64
+	HeaderRe    string
+	IDs         string
+	Frac        float64
+	Count       int
+	Seed        int64
+}
+
+func FullReadFilter() {
+	var f ReadFilterFlags
+	flag.StringVar(&f.R1, "1", "", "R1 or single-end reads to read instead of stdin")
+	flag.StringVar(&f.R2, "2", "", "R2 fastq, for paired-end input")
+	flag.StringVar(&f.Out1, "o1", "", "Output for R1 or single-end reads instead of stdout")
+	flag.StringVar(&f.Out2, "o2", "", "Output for R2 (required with -2)")
+	flag.BoolVar(&f.Interleaved, "i", false, "Input and output are interleaved fastq pairs")
+	flag.BoolVar(&f.Fasta, "fa", false, "Reads are fasta, not fastq (single-end only)")
+	flag.IntVar(&f.MinLen, "min", 0, "Shortest read to keep")
+	flag.IntVar(&f.MaxLen, "max", 0, "Longest read to keep (0 for no limit)")
+	flag.Float64Var(&f.MinQual, "q", 0, "Lowest mean phred quality to keep")
+	flag.Float64Var(&f.MaxNFrac, "n", 1, "Highest fraction of N to keep")
+	flag.StringVar(&f.HeaderRe, "r", "", "Keep only reads with headers matching this regular expression")
+	flag.StringVar(&f.IDs, "ids", "", "Keep only reads named in this file, one per line")
+	flag.Float64Var(&f.Frac, "frac", 1, "Fraction of reads (or pairs) to keep at random")
+	flag.IntVar(&f.Count, "count", -1, "Exact number of reads (or pairs) to keep at random, overriding -frac")
+	flag.Int64Var(&f.Seed, "seed", 0, "Random seed for subsampling")
+	flag.Parse()
+
+	if e := runReadFilter(f); e != nil {
+		log.Fatal(e)
+	}
+}
+
+func readFilterOptions(f ReadFilterFlags) (*ReadFilterOptions, error) {
+	o := DefaultReadFilterOptions()
+	o.MinLen, o.MaxLen, o.MinMeanQual, o.MaxNFrac = f.MinLen, f.MaxLen, f.MinQual, f.MaxNFrac
+	if f.HeaderRe != "" {
+		re, e := regexp.Compile(f.HeaderRe)
+		if e != nil {
+			return nil, e
+		}
+		o.HeaderRe = re
+	}
+	if f.IDs != "" {
+		r, e := zfile.Open(f.IDs)
+		if e != nil {
+			return nil, e
+		}
+		defer r.Close()
+		if o.IDs, e = ReadIDList(r); e != nil {
+			return nil, e
+		}
+	}
+	return o, nil
+}
+
+func runReadFilter(f ReadFilterFlags) error {
+	if f.R2 != "" && f.Out2 == "" {
+		return fmt.Errorf("-2 needs -o2")
+	}
+	if f.Fasta && (f.R2 != "" || f.Interleaved) {
+		return fmt.Errorf("paired input must be fastq")
+	}
+	o, e := readFilterOptions(f)
+	if e != nil {
+		return e
+	}
+
+	r1, e := openFqInput(f.R1)
+	if e != nil {
+		return e
+	}
+	defer r1.Close()
+	w1, close1, e := createFqOutput(f.Out1)
+	if e != nil {
+		return e
+	}
+
+	switch {
+	case f.R2 != "":
+		r2, e := zfile.Open(f.R2)
+		if e != nil {
+			return e
+		}
+		defer r2.Close()
+		w2, close2, e := createFqOutput(f.Out2)
+		if e != nil {
+			return e
+		}
+		pairs := subsampleReads(FilterReadPairs(ParseFastqPairs(r1, r2), o), f.Frac, f.Count, f.Seed)
+		if e := WriteFqPairs(w1, w2, pairs); e != nil {
+			return e
+		}
+		if e := close2(); e != nil {
+			return e
+		}
+	case f.Interleaved:
+		pairs := subsampleReads(FilterReadPairs(ParseInterleavedFastq(r1), o), f.Frac, f.Count, f.Seed)
+		if e := WriteInterleavedFq(w1, pairs); e != nil {
+			return e
+		}
+	case f.Fasta:
+		if e := WriteFa(w1, subsampleReads(FilterReads(ParseFasta(r1), o), f.Frac, f.Count, f.Seed)); e != nil {
+			return e
+		}
+	default:
+		if e := WriteFq(w1, subsampleReads(FilterReads(ParseFastq(r1), o), f.Frac, f.Count, f.Seed)); e != nil {
+			return e
+		}
+	}
+	return close1()
+}
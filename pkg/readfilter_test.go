@@ -0,0 +1,98 @@
+package fastats
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestKeepRead(t *testing.T) {
+	reads := []FqEntry{
+		{FaEntry{"a/1", "ACGTACGT"}, "IIIIIIII"},
+		{FaEntry{"b/1", "ACGT"}, "IIII"},
+		{FaEntry{"c/1", "ACGTACGT"}, "########"},
+		{FaEntry{"d/1", "ACGTNNNN"}, "IIIIIIII"},
+		{FaEntry{"e/1 x", "ACGTACGTACGT"}, "IIIIIIIIIIII"},
+	}
+	tests := []struct {
+		o    ReadFilterOptions
+		want []string
+	}{
+		{*DefaultReadFilterOptions(), []string{"a/1", "b/1", "c/1", "d/1", "e/1 x"}},
+		{ReadFilterOptions{MinLen: 5, MaxLen: 8, MaxNFrac: 1}, []string{"a/1", "c/1", "d/1"}},
+		{ReadFilterOptions{MinMeanQual: 20, MaxNFrac: 1}, []string{"a/1", "b/1", "d/1", "e/1 x"}},
+		{ReadFilterOptions{MaxNFrac: 0.25}, []string{"a/1", "b/1", "c/1", "e/1 x"}},
+		{ReadFilterOptions{MaxNFrac: 1, HeaderRe: regexp.MustCompile(` x$`)}, []string{"e/1 x"}},
+		{ReadFilterOptions{MaxNFrac: 1, IDs: map[string]struct{}{"b": {}, "e": {}}}, []string{"b/1", "e/1 x"}},
+	}
+	for i, test := range tests {
+		var got []string
+		for _, r := range reads {
+			if KeepRead(r, &test.o) {
+				got = append(got, r.Header)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %v: %v != %v", i, got, test.want)
+		}
+	}
+}
+
+func TestFilterReadPairs(t *testing.T) {
+	r1 := "@a/1\nACGTACGT\n+\nIIIIIIII\n@b/1\nACGTACGT\n+\nIIIIIIII\n"
+	r2 := "@a/2\nACGTACGT\n+\nIIIIIIII\n@b/2\nAC\n+\nII\n"
+	o := DefaultReadFilterOptions()
+	o.MinLen = 4
+	pairs, e := CollectErr(FilterReadPairs(ParseFastqPairs(strings.NewReader(r1), strings.NewReader(r2)), o))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(pairs) != 1 || pairs[0].V1.Header != "a/1" || pairs[0].V2.Header != "a/2" {
+		t.Errorf("bad pairs %v", pairs)
+	}
+}
+
+func TestReadIDList(t *testing.T) {
+	ids, e := ReadIDList(strings.NewReader("@a/1 comment\n\n>b\nc\n"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if want := map[string]struct{}{"a": {}, "b": {}, "c": {}}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("%v != %v", ids, want)
+	}
+}
+
+func TestSubsample(t *testing.T) {
+	var in []int
+	for i := 0; i < 1000; i++ {
+		in = append(in, i)
+	}
+
+	s1, e := ReservoirSample(SliceIter2(in), 10, 7)
+	if e != nil {
+		t.Fatal(e)
+	}
+	s2, _ := ReservoirSample(SliceIter2(in), 10, 7)
+	if len(s1) != 10 || !reflect.DeepEqual(s1, s2) {
+		t.Errorf("reservoir samples %v and %v", s1, s2)
+	}
+	for i := 1; i < len(s1); i++ {
+		if s1[i] <= s1[i-1] {
+			t.Errorf("sample not in input order: %v", s1)
+		}
+	}
+	if all, _ := ReservoirSample(SliceIter2(in[:5]), 10, 7); !reflect.DeepEqual(all, in[:5]) {
+		t.Errorf("short input: %v", all)
+	}
+	// A count far above the input size must not be allocated up front.
+	if all, _ := ReservoirSample(SliceIter2(in[:5]), 1<<50, 7); !reflect.DeepEqual(all, in[:5]) {
+		t.Errorf("huge count: %v", all)
+	}
+
+	f1, _ := CollectErr(SubsampleFrac(SliceIter2(in), 0.1, 3))
+	f2, _ := CollectErr(SubsampleFrac(SliceIter2(in), 0.1, 3))
+	if !reflect.DeepEqual(f1, f2) || len(f1) < 50 || len(f1) > 150 {
+		t.Errorf("fraction samples of length %v and %v", len(f1), len(f2))
+	}
+}
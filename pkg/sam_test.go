@@ -0,0 +1,96 @@
+package fastats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testSam = `@HD	VN:1.6	SO:coordinate
+@SQ	SN:chr1	LN:1000	M5:abc
+@SQ	SN:chr2	LN:500
+@RG	ID:rg1	SM:sample1	LB:lib1	PL:ILLUMINA
+@PG	ID:bwa	PN:bwa	VN:0.7.17	CL:bwa mem ref.fa r1.fq
+@CO	a comment	with a tab
+read1	99	chr1	10	60	3S5M1I2M2D4M	=	200	300	ACGTNACGTACGTAC	IIIIIIIIIIIIII#	NM:i:3	XA:A:q	XF:f:0.5	RG:Z:rg1:x	XH:H:1AE3	XB:B:s,-1,2,300	XG:B:f,1.5,-2
+read2	4	*	0	0	*	*	0	0	ACG	*
+`
+
+func TestSamRoundTrip(t *testing.T) {
+	var b strings.Builder
+	if e := WriteSam(&b, ParseSam(strings.NewReader(testSam))); e != nil {
+		t.Fatal(e)
+	}
+	if b.String() != testSam {
+		t.Errorf("got:\n%v\n!= exp:\n%v", b.String(), testSam)
+	}
+}
+
+func TestSamPlusHeader(t *testing.T) {
+	h, it, e := ParseSamPlusHeader(strings.NewReader(testSam))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if h.HD == nil || h.HD.SortOrder != "coordinate" {
+		t.Errorf("bad @HD %v", h.HD)
+	}
+	if len(h.SQ) != 2 || h.SQ[1].Name != "chr2" || h.SQ[1].Len != 500 {
+		t.Errorf("bad @SQ %v", h.SQ)
+	}
+	if len(h.RG) != 1 || h.RG[0].Sample != "sample1" {
+		t.Errorf("bad @RG %v", h.RG)
+	}
+	if len(h.PG) != 1 || h.PG[0].CommandLine != "bwa mem ref.fa r1.fq" {
+		t.Errorf("bad @PG %v", h.PG)
+	}
+	if len(h.CO) != 1 || h.CO[0] != "a comment\twith a tab" {
+		t.Errorf("bad @CO %v", h.CO)
+	}
+
+	alns, e := CollectErr(it)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(alns) != 2 || alns[0].Optional[3].String != "rg1:x" {
+		t.Errorf("bad alignments %v", alns)
+	}
+
+	var bam bytes.Buffer
+	bw, e := NewBamWriter(&bam, h.BamHeader())
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, a := range alns {
+		if e := bw.Write(a); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := bw.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	var out strings.Builder
+	if e := WriteSam(&out, ParseSamOrBam(&bam)); e != nil {
+		t.Fatal(e)
+	}
+	if out.String() != testSam {
+		t.Errorf("sam -> bam -> sam got:\n%v\n!= exp:\n%v", out.String(), testSam)
+	}
+}
+
+func TestSamHeaderLinesOrder(t *testing.T) {
+	text := "@HD\tVN:1.6\n@CO\tfirst\n@SQ\tSN:chr1\tLN:10\n@PG\tID:a\tPN:a\n@XX\tAB:unknown\n@CO\tsecond\n@PG\tID:b\tPN:b\tPP:a\n"
+	h, e := ParseSamHeaderText(text)
+	if e != nil {
+		t.Fatal(e)
+	}
+	h.PG = append(h.PG, SamPG{ID: "c", Prev: "b"})
+	exp := text + "@PG\tID:c\tPP:b\n"
+	var b strings.Builder
+	for _, line := range h.Lines() {
+		b.WriteString("@" + line + "\n")
+	}
+	if b.String() != exp {
+		t.Errorf("got:\n%v\n!= exp:\n%v", b.String(), exp)
+	}
+}
@@ -0,0 +1,278 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"iter"
+	"log"
+	"os"
+)
+
+const (
+	SamPaired        = 0x1
+	SamProperPair    = 0x2
+	SamUnmapped      = 0x4
+	SamMateUnmapped  = 0x8
+	SamReverse       = 0x10
+	SamMateReverse   = 0x20
+	SamRead1         = 0x40
+	SamRead2         = 0x80
+	SamSecondary     = 0x100
+	SamQcFail        = 0x200
+	SamDuplicate     = 0x400
+	SamSupplementary = 0x800
+)
+
+type SamCovOptions struct {
+	MinMapq        int64
+	RequireFlags   uint16
+	ExcludeFlags   uint16
+	PerBase        bool
+	Zeros          bool
+	CountDeletions bool
+}
+
+// Same default flag filter as samtools depth.
+func DefaultSamCovOptions() SamCovOptions {
+	return SamCovOptions{ExcludeFlags: SamUnmapped | SamSecondary | SamQcFail | SamDuplicate}
+}
+
+func SamCovKeep(s SamEntry, o SamCovOptions) bool {
+	return !s.IsHeader &&
+		s.Flag&SamUnmapped == 0 &&
+		s.Rname != "*" &&
+		s.Mapq >= o.MinMapq &&
+		s.Flag&o.RequireFlags == o.RequireFlags &&
+		s.Flag&o.ExcludeFlags == 0
+}
+
+type samCov struct {
+	o     SamCovOptions
+	h     SamHeader
+	yield func(BedEntry[float64], error) bool
+
+	chr      string
+	chrIdx   int
+	bufStart int64
+	d        Deque[int64]
+
+	run    BedEntry[float64]
+	hasRun bool
+}
+
+func (c *samCov) emitRun() bool {
+	if !c.hasRun {
+		return true
+	}
+	c.hasRun = false
+	if c.run.Fields == 0 && !c.o.Zeros {
+		return true
+	}
+	return c.yield(c.run, nil)
+}
+
+func (c *samCov) emitRange(start, end int64, depth float64) bool {
+	if start >= end {
+		return true
+	}
+	if c.o.PerBase {
+		if depth == 0 && !c.o.Zeros {
+			return true
+		}
+		for i := start; i < end; i++ {
+			if !c.yield(BedEntry[float64]{ChrSpan{c.chr, Span{i, i + 1}}, depth}, nil) {
+				return false
+			}
+		}
+		return true
+	}
+	if c.hasRun && c.run.Fields == depth && c.run.End == start {
+		c.run.End = end
+		return true
+	}
+	if !c.emitRun() {
+		return false
+	}
+	c.run = BedEntry[float64]{ChrSpan{c.chr, Span{start, end}}, depth}
+	c.hasRun = true
+	return true
+}
+
+// Emit all positions before pos, which no later alignment can cover.
+func (c *samCov) flushTo(pos int64) bool {
+	for c.bufStart < pos && c.d.Len() > 0 {
+		depth, _ := c.d.PopFront()
+		if !c.emitRange(c.bufStart, c.bufStart+1, float64(depth)) {
+			return false
+		}
+		c.bufStart++
+	}
+	if c.bufStart < pos {
+		if !c.emitRange(c.bufStart, pos, 0) {
+			return false
+		}
+		c.bufStart = pos
+	}
+	return true
+}
+
+func (c *samCov) finishChr() bool {
+	if c.chr == "" {
+		return true
+	}
+	end := c.bufStart + int64(c.d.Len())
+	if l, ok := c.h.RefLen(c.chr); ok && c.o.Zeros && l > end {
+		end = l
+	}
+	return c.flushTo(end) && c.emitRun()
+}
+
+// With Zeros set, emit whole-chromosome zero coverage for header references
+// between the current one and index next.
+func (c *samCov) emitEmptyChrs(next int) bool {
+	if !c.o.Zeros {
+		return true
+	}
+	for i := c.chrIdx + 1; i < next && i < len(c.h.SQ); i++ {
+		c.chr = c.h.SQ[i].Name
+		if !c.emitRange(0, c.h.SQ[i].Len, 0) || !c.emitRun() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *samCov) chrIndex(chr string) int {
+	for i, sq := range c.h.SQ {
+		if sq.Name == chr {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *samCov) startChr(chr string) bool {
+	if !c.finishChr() {
+		return false
+	}
+	idx := c.chrIndex(chr)
+	if idx >= 0 {
+		if !c.emitEmptyChrs(idx) {
+			return false
+		}
+		c.chrIdx = idx
+	}
+	c.chr = chr
+	c.bufStart = 0
+	return true
+}
+
+func (c *samCov) add(s SamEntry) error {
+	ops, e := ParseCIGAR(s.CIGAR)
+	if e != nil {
+		return e
+	}
+	r := s.Pos - 1
+	for _, op := range ops {
+		switch op.Letter {
+		case 'D':
+			if !c.o.CountDeletions {
+				r += op.Count
+				continue
+			}
+			fallthrough
+		case 'M', '=', 'X':
+			for i := r; i < r+op.Count; i++ {
+				idx := int(i - c.bufStart)
+				for c.d.Len() <= idx {
+					c.d.PushBack(0)
+				}
+				c.d.Set(idx, c.d.Get(idx)+1)
+			}
+			r += op.Count
+		case 'N':
+			r += op.Count
+		}
+	}
+	return nil
+}
+
+// Compute depth from coordinate-sorted alignments, with chromosomes in header
+// order. Without PerBase, adjacent positions with equal depth are merged into
+// one bedGraph entry. Header reference lengths are used to extend zero
+// coverage to chromosome ends.
+func SamCoverage(h SamHeader, it iter.Seq2[SamEntry, error], o SamCovOptions) iter.Seq2[BedEntry[float64], error] {
+	return func(yield func(BedEntry[float64], error) bool) {
+		c := &samCov{o: o, h: h, yield: yield, chrIdx: -1}
+		seen := map[string]bool{}
+
+		for s, e := range it {
+			if e != nil {
+				yield(BedEntry[float64]{}, e)
+				return
+			}
+			if !SamCovKeep(s, o) {
+				continue
+			}
+			if s.Rname != c.chr {
+				if seen[s.Rname] {
+					yield(BedEntry[float64]{}, fmt.Errorf("SamCoverage: alignments not sorted; %v appears twice", s.Rname))
+					return
+				}
+				if idx := c.chrIndex(s.Rname); idx >= 0 && idx < c.chrIdx {
+					yield(BedEntry[float64]{}, fmt.Errorf("SamCoverage: alignments not sorted; %v after %v in header order", s.Rname, c.h.SQ[c.chrIdx].Name))
+					return
+				}
+				seen[s.Rname] = true
+				if !c.startChr(s.Rname) {
+					return
+				}
+			}
+			pos := s.Pos - 1
+			if pos < c.bufStart {
+				yield(BedEntry[float64]{}, fmt.Errorf("SamCoverage: alignments not sorted; %v:%v after %v", s.Rname, s.Pos, c.bufStart+1))
+				return
+			}
+			if !c.flushTo(pos) {
+				return
+			}
+			if e := c.add(s); e != nil {
+				yield(BedEntry[float64]{}, e)
+				return
+			}
+		}
+		if c.finishChr() {
+			c.emitEmptyChrs(len(h.SQ))
+		}
+	}
+}
+
+func FullSamCov() {
+	o := DefaultSamCovOptions()
+	var requireFlags, excludeFlags uint
+	flag.Int64Var(&o.MinMapq, "q", 0, "Minimum mapping quality")
+	flag.UintVar(&requireFlags, "f", 0, "Only count alignments with all of these flags")
+	flag.UintVar(&excludeFlags, "F", uint(o.ExcludeFlags), "Skip alignments with any of these flags")
+	flag.BoolVar(&o.PerBase, "d", false, "Write one entry per base instead of merging runs of equal depth")
+	flag.BoolVar(&o.Zeros, "z", false, "Include regions with zero coverage")
+	flag.BoolVar(&o.CountDeletions, "D", false, "Count deletions as covered")
+	flag.Parse()
+	o.RequireFlags = uint16(requireFlags)
+	o.ExcludeFlags = uint16(excludeFlags)
+
+	h, it, e := ParseSamOrBamPlusHeader(os.Stdin)
+	if e != nil {
+		log.Fatal(e)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+
+	if _, e := WriteFloatBed(w, SamCoverage(h, it, o)); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -0,0 +1,74 @@
+package fastats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const samcovSam = `@SQ	SN:chr1	LN:20
+@SQ	SN:chr2	LN:10
+@SQ	SN:chr3	LN:5
+r1	0	chr1	3	60	4M	*	0	0	ACGT	IIII
+r2	16	chr1	5	60	2M2D2M	*	0	0	ACGT	IIII
+r3	0	chr1	6	5	3M	*	0	0	ACG	III
+r4	1024	chr1	6	60	3M	*	0	0	ACG	III
+r5	0	chr3	2	60	1S2M	*	0	0	ACG	III
+`
+
+func samcovEntry(chr string, start, end int64, depth float64) BedEntry[float64] {
+	return BedEntry[float64]{ChrSpan{chr, Span{start, end}}, depth}
+}
+
+func TestSamCoverage(t *testing.T) {
+	h, it, e := ParseSamPlusHeader(strings.NewReader(samcovSam))
+	if e != nil {
+		t.Fatal(e)
+	}
+	o := DefaultSamCovOptions()
+	o.MinMapq = 10
+	got, e := CollectErr(SamCoverage(h, it, o))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []BedEntry[float64]{
+		samcovEntry("chr1", 2, 4, 1),
+		samcovEntry("chr1", 4, 6, 2),
+		samcovEntry("chr1", 8, 10, 1),
+		samcovEntry("chr3", 1, 3, 1),
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+
+	h, it, _ = ParseSamPlusHeader(strings.NewReader(samcovSam))
+	o.Zeros = true
+	got, e = CollectErr(SamCoverage(h, it, o))
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp = []BedEntry[float64]{
+		samcovEntry("chr1", 0, 2, 0),
+		samcovEntry("chr1", 2, 4, 1),
+		samcovEntry("chr1", 4, 6, 2),
+		samcovEntry("chr1", 6, 8, 0),
+		samcovEntry("chr1", 8, 10, 1),
+		samcovEntry("chr1", 10, 20, 0),
+		samcovEntry("chr2", 0, 10, 0),
+		samcovEntry("chr3", 0, 1, 0),
+		samcovEntry("chr3", 1, 3, 1),
+		samcovEntry("chr3", 3, 5, 0),
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("zeros: got %v != exp %v", got, exp)
+	}
+
+	// chr2 before chr1 breaks header order.
+	unsorted := "@SQ\tSN:chr1\tLN:5\n@SQ\tSN:chr2\tLN:5\n" +
+		"r1\t0\tchr2\t1\t60\t2M\t*\t0\t0\tAA\tII\n" +
+		"r2\t0\tchr1\t1\t60\t2M\t*\t0\t0\tAA\tII\n"
+	h, it, _ = ParseSamPlusHeader(strings.NewReader(unsorted))
+	if _, e := CollectErr(SamCoverage(h, it, o)); e == nil {
+		t.Errorf("expected error for chromosomes out of header order")
+	}
+}
@@ -0,0 +1,324 @@
+package fastats
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type SamTag struct {
+	Tag   string
+	Value string
+}
+
+// @HD: file-level metadata
+type SamHD struct {
+	Version    string
+	SortOrder  string
+	GroupOrder string
+	SubSort    string
+	Other      []SamTag
+}
+
+// @SQ: reference sequence dictionary
+type SamSQ struct {
+	Name  string
+	Len   int64
+	Other []SamTag
+}
+
+func (s SamSQ) SpanChr() string  { return s.Name }
+func (s SamSQ) SpanStart() int64 { return 0 }
+func (s SamSQ) SpanEnd() int64   { return s.Len }
+
+// @RG: read group
+type SamRG struct {
+	ID       string
+	Sample   string
+	Library  string
+	Platform string
+	Other    []SamTag
+}
+
+// @PG: program
+type SamPG struct {
+	ID          string
+	Name        string
+	CommandLine string
+	Prev        string
+	Version     string
+	Other       []SamTag
+}
+
+type SamHeader struct {
+	HD *SamHD
+	SQ []SamSQ
+	RG []SamRG
+	PG []SamPG
+	CO []string
+	// Lines with unrecognized record types, without the leading '@'
+	Other []string
+	// The record type and index of each line added by AddLine, in order
+	order []samHeaderRef
+}
+
+type samHeaderRef struct {
+	typ string
+	i   int
+}
+
+func ParseSamTags(fields []string) ([]SamTag, error) {
+	out := make([]SamTag, 0, len(fields))
+	for _, field := range fields {
+		if len(field) < 3 || field[2] != ':' {
+			return nil, fmt.Errorf("ParseSamTags: malformed tag %q", field)
+		}
+		out = append(out, SamTag{Tag: field[:2], Value: field[3:]})
+	}
+	return out, nil
+}
+
+// Add one header line, without its leading '@', to h.
+func (h *SamHeader) AddLine(line string) error {
+	fields := strings.Split(line, "\t")
+	if fields[0] == "CO" {
+		_, comment, _ := strings.Cut(line, "\t")
+		h.CO = append(h.CO, comment)
+		h.order = append(h.order, samHeaderRef{"CO", len(h.CO) - 1})
+		return nil
+	}
+	tags, e := ParseSamTags(fields[1:])
+	if e != nil {
+		return fmt.Errorf("SamHeader.AddLine: %w", e)
+	}
+
+	switch fields[0] {
+	case "HD":
+		if h.HD != nil {
+			return fmt.Errorf("SamHeader.AddLine: more than one @HD line")
+		}
+		h.HD = &SamHD{}
+		h.order = append(h.order, samHeaderRef{"HD", 0})
+		for _, t := range tags {
+			switch t.Tag {
+			case "VN":
+				h.HD.Version = t.Value
+			case "SO":
+				h.HD.SortOrder = t.Value
+			case "GO":
+				h.HD.GroupOrder = t.Value
+			case "SS":
+				h.HD.SubSort = t.Value
+			default:
+				h.HD.Other = append(h.HD.Other, t)
+			}
+		}
+	case "SQ":
+		var sq SamSQ
+		hasLen := false
+		for _, t := range tags {
+			switch t.Tag {
+			case "SN":
+				sq.Name = t.Value
+			case "LN":
+				if sq.Len, e = strconv.ParseInt(t.Value, 10, 64); e != nil {
+					return fmt.Errorf("SamHeader.AddLine: @SQ LN: %w", e)
+				}
+				hasLen = true
+			default:
+				sq.Other = append(sq.Other, t)
+			}
+		}
+		if sq.Name == "" || !hasLen {
+			return fmt.Errorf("SamHeader.AddLine: @SQ line missing SN or LN: %v", line)
+		}
+		h.SQ = append(h.SQ, sq)
+		h.order = append(h.order, samHeaderRef{"SQ", len(h.SQ) - 1})
+	case "RG":
+		var rg SamRG
+		for _, t := range tags {
+			switch t.Tag {
+			case "ID":
+				rg.ID = t.Value
+			case "SM":
+				rg.Sample = t.Value
+			case "LB":
+				rg.Library = t.Value
+			case "PL":
+				rg.Platform = t.Value
+			default:
+				rg.Other = append(rg.Other, t)
+			}
+		}
+		if rg.ID == "" {
+			return fmt.Errorf("SamHeader.AddLine: @RG line missing ID: %v", line)
+		}
+		h.RG = append(h.RG, rg)
+		h.order = append(h.order, samHeaderRef{"RG", len(h.RG) - 1})
+	case "PG":
+		var pg SamPG
+		for _, t := range tags {
+			switch t.Tag {
+			case "ID":
+				pg.ID = t.Value
+			case "PN":
+				pg.Name = t.Value
+			case "CL":
+				pg.CommandLine = t.Value
+			case "PP":
+				pg.Prev = t.Value
+			case "VN":
+				pg.Version = t.Value
+			default:
+				pg.Other = append(pg.Other, t)
+			}
+		}
+		if pg.ID == "" {
+			return fmt.Errorf("SamHeader.AddLine: @PG line missing ID: %v", line)
+		}
+		h.PG = append(h.PG, pg)
+		h.order = append(h.order, samHeaderRef{"PG", len(h.PG) - 1})
+	default:
+		h.Other = append(h.Other, line)
+		h.order = append(h.order, samHeaderRef{"", len(h.Other) - 1})
+	}
+	return nil
+}
+
+func SamHeaderFromEntries(es []SamEntry) (SamHeader, error) {
+	var h SamHeader
+	for _, s := range es {
+		if !s.IsHeader {
+			continue
+		}
+		if e := h.AddLine(s.Header); e != nil {
+			return h, e
+		}
+	}
+	return h, nil
+}
+
+func ParseSamHeaderText(text string) (SamHeader, error) {
+	var h SamHeader
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) < 1 {
+			continue
+		}
+		if line[0] != '@' {
+			return h, fmt.Errorf("ParseSamHeaderText: header line %q does not start with @", line)
+		}
+		if e := h.AddLine(line[1:]); e != nil {
+			return h, e
+		}
+	}
+	return h, nil
+}
+
+func appendSamTags(b *strings.Builder, known []SamTag, other []SamTag) {
+	for _, t := range known {
+		if t.Value != "" {
+			fmt.Fprintf(b, "\t%v:%v", t.Tag, t.Value)
+		}
+	}
+	for _, t := range other {
+		fmt.Fprintf(b, "\t%v:%v", t.Tag, t.Value)
+	}
+}
+
+// The header lines of each record type, without their leading '@'. Other
+// lines are under "".
+func (h SamHeader) typedLines() map[string][]string {
+	out := map[string][]string{}
+	var b strings.Builder
+	if h.HD != nil {
+		b.WriteString("HD")
+		appendSamTags(&b, []SamTag{{"VN", h.HD.Version}, {"SO", h.HD.SortOrder}, {"GO", h.HD.GroupOrder}, {"SS", h.HD.SubSort}}, h.HD.Other)
+		out["HD"] = append(out["HD"], b.String())
+	}
+	for _, sq := range h.SQ {
+		b.Reset()
+		b.WriteString("SQ")
+		appendSamTags(&b, []SamTag{{"SN", sq.Name}, {"LN", fmt.Sprint(sq.Len)}}, sq.Other)
+		out["SQ"] = append(out["SQ"], b.String())
+	}
+	for _, rg := range h.RG {
+		b.Reset()
+		b.WriteString("RG")
+		appendSamTags(&b, []SamTag{{"ID", rg.ID}, {"SM", rg.Sample}, {"LB", rg.Library}, {"PL", rg.Platform}}, rg.Other)
+		out["RG"] = append(out["RG"], b.String())
+	}
+	for _, pg := range h.PG {
+		b.Reset()
+		b.WriteString("PG")
+		appendSamTags(&b, []SamTag{{"ID", pg.ID}, {"PN", pg.Name}, {"PP", pg.Prev}, {"VN", pg.Version}, {"CL", pg.CommandLine}}, pg.Other)
+		out["PG"] = append(out["PG"], b.String())
+	}
+	for _, co := range h.CO {
+		out["CO"] = append(out["CO"], "CO\t"+co)
+	}
+	out[""] = h.Other
+	return out
+}
+
+// The header lines, without their leading '@'. Lines added by AddLine keep
+// their order; any others follow, grouped as HD, SQ, RG, PG, CO and the rest.
+func (h SamHeader) Lines() []string {
+	typed := h.typedLines()
+	used := map[samHeaderRef]bool{}
+	var out []string
+	for _, ref := range h.order {
+		if lines := typed[ref.typ]; ref.i < len(lines) && !used[ref] {
+			out = append(out, lines[ref.i])
+			used[ref] = true
+		}
+	}
+	for _, typ := range []string{"HD", "SQ", "RG", "PG", "CO", ""} {
+		for i, line := range typed[typ] {
+			if !used[samHeaderRef{typ, i}] {
+				out = append(out, line)
+			}
+		}
+	}
+	return out
+}
+
+func (h SamHeader) Entries() []SamEntry {
+	lines := h.Lines()
+	out := make([]SamEntry, 0, len(lines))
+	for _, line := range lines {
+		out = append(out, SamEntry{IsHeader: true, Header: line})
+	}
+	return out
+}
+
+func (h SamHeader) Text() string {
+	var b strings.Builder
+	for _, line := range h.Lines() {
+		fmt.Fprintf(&b, "@%v\n", line)
+	}
+	return b.String()
+}
+
+func (h SamHeader) BamHeader() BamHeader {
+	b := BamHeader{Text: h.Text()}
+	for _, sq := range h.SQ {
+		b.Refs = append(b.Refs, BamRef{Name: sq.Name, Len: sq.Len})
+	}
+	return b
+}
+
+func (h SamHeader) RefLen(name string) (int64, bool) {
+	for _, sq := range h.SQ {
+		if sq.Name == name {
+			return sq.Len, true
+		}
+	}
+	return 0, false
+}
+
+func WriteSamHeader(w io.Writer, h SamHeader) error {
+	_, e := io.WriteString(w, h.Text())
+	return e
+}
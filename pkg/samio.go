@@ -0,0 +1,241 @@
+package fastats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func parseSamLines(s *bufio.Scanner, yield func(SamEntry, error) bool) {
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if len(line) < 1 {
+			continue
+		}
+		a, e := ParseSamEntry(line)
+		if !yield(a, e) {
+			return
+		}
+	}
+	if s.Err() != nil {
+		yield(SamEntry{}, s.Err())
+	}
+}
+
+// Iterate over every line of a SAM file, header lines included.
+func ParseSam(r io.Reader) iter.Seq2[SamEntry, error] {
+	return func(yield func(SamEntry, error) bool) {
+		s := bufio.NewScanner(r)
+		s.Buffer([]byte{}, 1e12)
+		parseSamLines(s, yield)
+	}
+}
+
+// Read the header of a SAM file, then return an iterator over its alignments.
+func ParseSamPlusHeader(r io.Reader) (SamHeader, iter.Seq2[SamEntry, error], error) {
+	br := bufio.NewReader(r)
+	var h SamHeader
+	for {
+		c, e := br.Peek(1)
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return h, nil, e
+		}
+		if c[0] != '@' {
+			break
+		}
+		line, e := br.ReadString('\n')
+		if e != nil && e != io.EOF {
+			return h, nil, e
+		}
+		if e := h.AddLine(strings.TrimRight(line[1:], "\r\n")); e != nil {
+			return h, nil, e
+		}
+	}
+	return h, ParseSam(br), nil
+}
+
+func ParseBamPlusHeader(r io.Reader) (SamHeader, iter.Seq2[SamEntry, error], error) {
+	b, e := NewBamReader(r)
+	if e != nil {
+		return SamHeader{}, nil, e
+	}
+	h, e := SamHeaderFromEntries(b.Header.Entries())
+	if e != nil {
+		return h, nil, e
+	}
+	return h, func(yield func(SamEntry, error) bool) {
+		for {
+			s, e := b.Read()
+			if e == io.EOF {
+				return
+			}
+			if !yield(s, e) || e != nil {
+				return
+			}
+		}
+	}, nil
+}
+
+func isBgzf(br *bufio.Reader) bool {
+	magic, _ := br.Peek(2)
+	return len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// Read SAM or BAM, detected from the first bytes of r.
+func ParseSamOrBamPlusHeader(r io.Reader) (SamHeader, iter.Seq2[SamEntry, error], error) {
+	br := bufio.NewReader(r)
+	if isBgzf(br) {
+		return ParseBamPlusHeader(br)
+	}
+	return ParseSamPlusHeader(br)
+}
+
+func ParseSamOrBam(r io.Reader) iter.Seq2[SamEntry, error] {
+	return func(yield func(SamEntry, error) bool) {
+		br := bufio.NewReader(r)
+		if isBgzf(br) {
+			ParseBam(br)(yield)
+			return
+		}
+		ParseSam(br)(yield)
+	}
+}
+
+func formatSamFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func SamOptionalString(o SamOptional) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%c%c:%c:", o.Tag[0], o.Tag[1], o.Type)
+	switch o.Type {
+	case 'A':
+		b.WriteByte(o.Char)
+	case 'i':
+		b.WriteString(strconv.FormatInt(o.Int, 10))
+	case 'f':
+		b.WriteString(formatSamFloat(o.Float))
+	case 'Z':
+		b.WriteString(o.String)
+	case 'H':
+		fmt.Fprintf(&b, "%X", o.ByteArray)
+	case 'B':
+		b.WriteByte(o.NumArrayType)
+		if o.NumArrayType == 'f' {
+			for _, f := range o.FloatArray {
+				fmt.Fprintf(&b, ",%v", formatSamFloat(f))
+			}
+		} else {
+			for _, i := range o.IntArray {
+				fmt.Fprintf(&b, ",%v", i)
+			}
+		}
+	default:
+		return "", fmt.Errorf("SamOptionalString: invalid type %c", o.Type)
+	}
+	return b.String(), nil
+}
+
+func WriteSamEntry(w io.Writer, s SamEntry) error {
+	if s.IsHeader {
+		_, e := fmt.Fprintf(w, "@%v\n", s.Header)
+		return e
+	}
+	a := s.SamAlignment
+	_, e := fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v",
+		a.Qname, a.Flag, a.Rname, a.Pos, a.Mapq, a.CIGAR, a.Rnext, a.Pnext, a.Tlen, a.Seq, a.Qual,
+	)
+	if e != nil {
+		return e
+	}
+	for _, o := range s.Optional {
+		str, e := SamOptionalString(o)
+		if e != nil {
+			return e
+		}
+		if _, e := fmt.Fprintf(w, "\t%v", str); e != nil {
+			return e
+		}
+	}
+	_, e = fmt.Fprintf(w, "\n")
+	return e
+}
+
+func WriteSam(w io.Writer, it iter.Seq2[SamEntry, error]) error {
+	for s, e := range it {
+		if e != nil {
+			return e
+		}
+		if e := WriteSamEntry(w, s); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+type SamViewFlags struct {
+	Bam        bool
+	HeaderOnly bool
+	NoHeader   bool
+}
+
+func FullSamView() {
+	var f SamViewFlags
+	flag.BoolVar(&f.Bam, "b", false, "Write BAM instead of SAM")
+	flag.BoolVar(&f.HeaderOnly, "H", false, "Only write the header")
+	flag.BoolVar(&f.NoHeader, "n", false, "Do not write the header (SAM output only)")
+	flag.Parse()
+
+	h, it, e := ParseSamOrBamPlusHeader(os.Stdin)
+	if e != nil {
+		log.Fatal(e)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+
+	if f.Bam {
+		bw, e := NewBamWriter(w, h.BamHeader())
+		if e != nil {
+			log.Fatal(e)
+		}
+		if !f.HeaderOnly {
+			for s, e := range it {
+				if e != nil {
+					log.Fatal(e)
+				}
+				if e := bw.Write(s); e != nil {
+					log.Fatal(e)
+				}
+			}
+		}
+		if e := bw.Close(); e != nil {
+			log.Fatal(e)
+		}
+		return
+	}
+
+	if !f.NoHeader {
+		if e := WriteSamHeader(w, h); e != nil {
+			log.Fatal(e)
+		}
+	}
+	if f.HeaderOnly {
+		return
+	}
+	if e := WriteSam(w, it); e != nil {
+		log.Fatal(e)
+	}
+}
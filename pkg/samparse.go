@@ -135,7 +135,7 @@ func ParseNumArray(s string) (ntype byte, array any, err error) {
 
 func ParseSamOptional(s string) (SamOptional, error) {
 	var o SamOptional
-	fields := strings.Split(s, ":")
+	fields := strings.SplitN(s, ":", 3)
 	if len(fields) != 3 {
 		return o, fmt.Errorf("ParseSamOptional: len(fields) %v != 3; fields %v", len(fields), fields)
 	}
@@ -166,6 +166,9 @@ func ParseSamOptional(s string) (SamOptional, error) {
 	case "B":
 		var numArray any
 		o.NumArrayType, numArray, e = ParseNumArray(val)
+		if e != nil {
+			return o, e
+		}
 		if o.NumArrayType == 'f' {
 			o.FloatArray = numArray.([]float64)
 		} else {
@@ -178,7 +181,10 @@ func ParseSamOptional(s string) (SamOptional, error) {
 }
 
 func ParseSamOptionals(s string) ([]SamOptional, error) {
-	fields := strings.Split(s, ",")
+	return ParseSamOptionalFields(strings.Split(s, "\t"))
+}
+
+func ParseSamOptionalFields(fields []string) ([]SamOptional, error) {
 	out := make([]SamOptional, 0, len(fields))
 	for _, field := range fields {
 		opt, e := ParseSamOptional(field)
@@ -191,7 +197,7 @@ func ParseSamOptionals(s string) ([]SamOptional, error) {
 }
 
 func ParseSamEntry(s string) (SamEntry, error) {
-	if len(s) < 0 && s[0] == '@' {
+	if len(s) > 0 && s[0] == '@' {
 		return ParseSamHeading(s), nil
 	}
 	var a SamEntry
@@ -204,7 +210,7 @@ func ParseSamEntry(s string) (SamEntry, error) {
 	if len(line) < 12 {
 		return a, nil
 	}
-	a.Optional, e = ParseSamOptionals(line[11])
+	a.Optional, e = ParseSamOptionalFields(line[11:])
 	return a, e
 }
 
@@ -213,7 +219,7 @@ type CIGAREntry struct {
 	Count int64
 }
 
-var cIGARRe = regexp.MustCompile(`([0-9]*)([MIDS])`)
+var cIGARRe = regexp.MustCompile(`([0-9]*)([MIDNSHP=X])`)
 
 func ParseCIGAR(cigar string) ([]CIGAREntry, error) {
 	ms := cIGARRe.FindAllStringSubmatch(cigar, -1)
@@ -0,0 +1,999 @@
+package fastats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	TabixGeneric = 0
+	TabixSam     = 1
+	TabixVcf     = 2
+	// Set in TabixConf.Format when begin coordinates are 0-based, as in bed.
+	TabixUcsc = 0x10000
+)
+
+// The tabix column configuration stored in a .tbi or a tabix-style .csi. Column
+// numbers are 1-based, and ColEnd is 0 when there is no end column.
+type TabixConf struct {
+	Format int32
+	ColSeq int32
+	ColBeg int32
+	ColEnd int32
+	Meta   int32
+	Skip   int32
+}
+
+var TabixBedConf = TabixConf{Format: TabixUcsc, ColSeq: 1, ColBeg: 2, ColEnd: 3, Meta: '#'}
+var TabixVcfConf = TabixConf{Format: TabixVcf, ColSeq: 1, ColBeg: 2, ColEnd: 0, Meta: '#'}
+var TabixGffConf = TabixConf{Format: TabixGeneric, ColSeq: 1, ColBeg: 4, ColEnd: 5, Meta: '#'}
+
+var ErrTabixFormat = errors.New("tabix index format error")
+var ErrTabixUnsorted = errors.New("tabix input not sorted")
+
+func (c TabixConf) IsMeta(line string) bool {
+	return len(line) > 0 && int32(line[0]) == c.Meta
+}
+
+func vcfInfoEnd(info string) (int64, bool) {
+	for _, field := range strings.Split(info, ";") {
+		if val, ok := strings.CutPrefix(field, "END="); ok {
+			end, e := strconv.ParseInt(val, 10, 64)
+			return end, e == nil
+		}
+	}
+	return 0, false
+}
+
+// Get the 0-based, half-open span of a data line.
+func (c TabixConf) LineSpan(line string) (ChrSpan, error) {
+	var cs ChrSpan
+	fields := strings.Split(line, "\t")
+	col := func(i int32) (string, error) {
+		if i < 1 || int(i) > len(fields) {
+			return "", fmt.Errorf("TabixConf.LineSpan: %w: column %v missing from line %q", ErrTabixFormat, i, line)
+		}
+		return fields[i-1], nil
+	}
+	var e error
+	var s string
+	if cs.Chr, e = col(c.ColSeq); e != nil {
+		return cs, e
+	}
+	if s, e = col(c.ColBeg); e != nil {
+		return cs, e
+	}
+	if cs.Start, e = strconv.ParseInt(s, 10, 64); e != nil {
+		return cs, fmt.Errorf("TabixConf.LineSpan: %w", e)
+	}
+	if c.Format&TabixUcsc == 0 {
+		cs.Start--
+	}
+	cs.End = cs.Start + 1
+
+	switch {
+	case c.Format&0xffff == TabixVcf:
+		if ref, e := col(4); e == nil {
+			cs.End = cs.Start + int64(len(ref))
+		}
+		if info, e := col(8); e == nil {
+			if end, ok := vcfInfoEnd(info); ok {
+				cs.End = end
+			}
+		}
+	case c.ColEnd > 0:
+		if s, e = col(c.ColEnd); e != nil {
+			return cs, e
+		}
+		if cs.End, e = strconv.ParseInt(s, 10, 64); e != nil {
+			return cs, fmt.Errorf("TabixConf.LineSpan: %w", e)
+		}
+	}
+	if cs.End <= cs.Start {
+		cs.End = cs.Start + 1
+	}
+	return cs, nil
+}
+
+// The lowest-level bin containing the 0-based, half-open span [beg, end).
+func Reg2Bin(beg, end int64, minShift, depth int) uint32 {
+	end--
+	s := minShift
+	t := ((1 << (depth * 3)) - 1) / 7
+	for l := depth; l > 0; l-- {
+		if beg>>s == end>>s {
+			return uint32(int64(t) + beg>>s)
+		}
+		s += 3
+		t -= 1 << ((l - 1) * 3)
+	}
+	return 0
+}
+
+// All bins that may contain records overlapping [beg, end).
+func Reg2Bins(beg, end int64, minShift, depth int) []uint32 {
+	var out []uint32
+	end--
+	s := minShift + depth*3
+	t := 0
+	for l := 0; l <= depth; l++ {
+		for i := int64(t) + beg>>s; i <= int64(t)+end>>s; i++ {
+			out = append(out, uint32(i))
+		}
+		s -= 3
+		t += 1 << (l * 3)
+	}
+	return out
+}
+
+type TabixChunk struct {
+	Beg uint64
+	End uint64
+}
+
+type TabixBin struct {
+	Bin     uint32
+	Loffset uint64
+	Chunks  []TabixChunk
+}
+
+type TabixRef struct {
+	Bins map[uint32]*TabixBin
+	// Linear index of the lowest virtual offset in each 1<<MinShift window.
+	// Only stored in .tbi files.
+	Intervals []uint64
+}
+
+type TabixIndex struct {
+	TabixConf
+	Csi      bool
+	MinShift int
+	Depth    int
+	Names    []string
+	Refs     []TabixRef
+	NoCoor   uint64
+	names    map[string]int
+}
+
+func NewTabixIndex(conf TabixConf, csi bool) *TabixIndex {
+	return &TabixIndex{TabixConf: conf, Csi: csi, MinShift: 14, Depth: 5, names: map[string]int{}}
+}
+
+func (t *TabixIndex) RefID(chr string) (int, bool) {
+	if t.names == nil {
+		t.names = make(map[string]int, len(t.Names))
+		for i, name := range t.Names {
+			t.names[name] = i
+		}
+	}
+	i, ok := t.names[chr]
+	return i, ok
+}
+
+func (t *TabixIndex) minOffset(ref *TabixRef, beg int64) uint64 {
+	if !t.Csi {
+		if len(ref.Intervals) == 0 {
+			return 0
+		}
+		w := beg >> t.MinShift
+		if w >= int64(len(ref.Intervals)) {
+			return ref.Intervals[len(ref.Intervals)-1]
+		}
+		return ref.Intervals[w]
+	}
+
+	// Use the loffset of the smallest existing bin containing beg.
+	bins := Reg2Bins(beg, beg+1, t.MinShift, t.Depth)
+	for i := len(bins) - 1; i >= 0; i-- {
+		if b, ok := ref.Bins[bins[i]]; ok {
+			return b.Loffset
+		}
+	}
+	return 0
+}
+
+// The sorted, merged chunks of the file to read in order to find all records
+// overlapping the 0-based, half-open span s of chr.
+func (t *TabixIndex) Chunks(chr string, s Span) []TabixChunk {
+	id, ok := t.RefID(chr)
+	if !ok || id >= len(t.Refs) {
+		return nil
+	}
+	ref := &t.Refs[id]
+	if s.Start < 0 {
+		s.Start = 0
+	}
+	maxEnd := int64(1) << (t.MinShift + t.Depth*3)
+	if s.End < 0 || s.End > maxEnd {
+		s.End = maxEnd
+	}
+	if s.End <= s.Start {
+		return nil
+	}
+
+	minOff := t.minOffset(ref, s.Start)
+	var chunks []TabixChunk
+	for _, bin := range Reg2Bins(s.Start, s.End, t.MinShift, t.Depth) {
+		b, ok := ref.Bins[bin]
+		if !ok {
+			continue
+		}
+		for _, c := range b.Chunks {
+			if c.End > minOff {
+				chunks = append(chunks, c)
+			}
+		}
+	}
+
+	slices.SortFunc(chunks, func(x, y TabixChunk) int {
+		if x.Beg < y.Beg {
+			return -1
+		}
+		if x.Beg > y.Beg {
+			return 1
+		}
+		return 0
+	})
+	merged := chunks[:0]
+	for _, c := range chunks {
+		if len(merged) > 0 && c.Beg <= merged[len(merged)-1].End {
+			if c.End > merged[len(merged)-1].End {
+				merged[len(merged)-1].End = c.End
+			}
+			continue
+		}
+		merged = append(merged, c)
+	}
+	return merged
+}
+
+// Incrementally builds a TabixIndex from sorted records.
+type TabixIndexer struct {
+	Index   *TabixIndex
+	cur     int
+	lastBeg int64
+}
+
+func NewTabixIndexer(conf TabixConf, csi bool) *TabixIndexer {
+	return &TabixIndexer{Index: NewTabixIndex(conf, csi), cur: -1}
+}
+
+// Record that the data for span c is stored between virtual offsets beg and
+// end.
+func (x *TabixIndexer) Add(c ChrSpan, beg, end uint64) error {
+	t := x.Index
+	if x.cur < 0 || t.Names[x.cur] != c.Chr {
+		if _, ok := t.RefID(c.Chr); ok {
+			return fmt.Errorf("TabixIndexer.Add: %w: chromosome %v appears in more than one block", ErrTabixUnsorted, c.Chr)
+		}
+		t.names[c.Chr] = len(t.Names)
+		t.Names = append(t.Names, c.Chr)
+		t.Refs = append(t.Refs, TabixRef{Bins: map[uint32]*TabixBin{}})
+		x.cur = len(t.Names) - 1
+		x.lastBeg = 0
+	}
+	if c.Start < x.lastBeg {
+		return fmt.Errorf("TabixIndexer.Add: %w: %v after start %v", ErrTabixUnsorted, c, x.lastBeg)
+	}
+	if c.Start < 0 || c.End > int64(1)<<(t.MinShift+t.Depth*3) {
+		return fmt.Errorf("TabixIndexer.Add: span %v out of indexable range", c)
+	}
+	x.lastBeg = c.Start
+	if c.End <= c.Start {
+		c.End = c.Start + 1
+	}
+
+	ref := &t.Refs[x.cur]
+	binID := Reg2Bin(c.Start, c.End, t.MinShift, t.Depth)
+	b, ok := ref.Bins[binID]
+	if !ok {
+		b = &TabixBin{Bin: binID, Loffset: beg}
+		ref.Bins[binID] = b
+	}
+	if n := len(b.Chunks); n > 0 && b.Chunks[n-1].End == beg {
+		b.Chunks[n-1].End = end
+	} else {
+		b.Chunks = append(b.Chunks, TabixChunk{Beg: beg, End: end})
+	}
+
+	last := (c.End - 1) >> t.MinShift
+	for int64(len(ref.Intervals)) <= last {
+		ref.Intervals = append(ref.Intervals, ^uint64(0))
+	}
+	for w := c.Start >> t.MinShift; w <= last; w++ {
+		if ref.Intervals[w] == ^uint64(0) {
+			ref.Intervals[w] = beg
+		}
+	}
+	return nil
+}
+
+// Fill gaps in the linear index and compute bin loffsets.
+func (x *TabixIndexer) Finish() *TabixIndex {
+	t := x.Index
+	for i := range t.Refs {
+		ref := &t.Refs[i]
+		prev := uint64(0)
+		for w, off := range ref.Intervals {
+			if off == ^uint64(0) {
+				ref.Intervals[w] = prev
+			}
+			prev = ref.Intervals[w]
+		}
+		for _, b := range ref.Bins {
+			w := binFirstPos(b.Bin, t.MinShift, t.Depth) >> t.MinShift
+			if w < int64(len(ref.Intervals)) && ref.Intervals[w] < b.Loffset {
+				b.Loffset = ref.Intervals[w]
+			}
+		}
+	}
+	return t
+}
+
+func binFirstPos(bin uint32, minShift, depth int) int64 {
+	s := minShift + depth*3
+	t := uint32(0)
+	for l := 0; l <= depth; l++ {
+		next := t + 1<<(l*3)
+		if bin < next {
+			return int64(bin-t) << s
+		}
+		t = next
+		s -= 3
+	}
+	return 0
+}
+
+func readInt32(r io.Reader) (int32, error) {
+	var v int32
+	e := binary.Read(r, binary.LittleEndian, &v)
+	return v, e
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	var v uint64
+	e := binary.Read(r, binary.LittleEndian, &v)
+	return v, e
+}
+
+// Read n little-endian values a batch at a time, so that a corrupt count
+// fails at the end of the input instead of allocating it all up front.
+func readTabixSlice[T any](r io.Reader, n int32, what string) ([]T, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("ReadTabixIndex: %w: negative %v", ErrTabixFormat, what)
+	}
+	const batch = 4096
+	out := make([]T, 0, min(int(n), batch))
+	for len(out) < int(n) {
+		chunk := make([]T, min(int(n)-len(out), batch))
+		if e := binary.Read(r, binary.LittleEndian, chunk); e != nil {
+			return nil, e
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+func readTabixConfNames(r io.Reader, t *TabixIndex) error {
+	vals := make([]int32, 7)
+	if e := binary.Read(r, binary.LittleEndian, vals); e != nil {
+		return e
+	}
+	t.Format, t.ColSeq, t.ColBeg, t.ColEnd, t.Meta, t.Skip = vals[0], vals[1], vals[2], vals[3], vals[4], vals[5]
+	names, e := readTabixSlice[byte](r, vals[6], "l_nm")
+	if e != nil {
+		return e
+	}
+	for _, name := range bytes.Split(bytes.TrimSuffix(names, []byte{0}), []byte{0}) {
+		if len(name) > 0 {
+			t.Names = append(t.Names, string(name))
+		}
+	}
+	return nil
+}
+
+func readTabixRef(r io.Reader, csi bool) (TabixRef, error) {
+	ref := TabixRef{Bins: map[uint32]*TabixBin{}}
+	nbin, e := readInt32(r)
+	if e != nil {
+		return ref, e
+	}
+	for i := int32(0); i < nbin; i++ {
+		b := &TabixBin{}
+		if e := binary.Read(r, binary.LittleEndian, &b.Bin); e != nil {
+			return ref, e
+		}
+		if csi {
+			if b.Loffset, e = readUint64(r); e != nil {
+				return ref, e
+			}
+		}
+		nchunk, e := readInt32(r)
+		if e != nil {
+			return ref, e
+		}
+		if b.Chunks, e = readTabixSlice[TabixChunk](r, nchunk, "n_chunk"); e != nil {
+			return ref, e
+		}
+		ref.Bins[b.Bin] = b
+	}
+	if csi {
+		return ref, nil
+	}
+	nintv, e := readInt32(r)
+	if e != nil {
+		return ref, e
+	}
+	ref.Intervals, e = readTabixSlice[uint64](r, nintv, "n_intv")
+	return ref, e
+}
+
+// Read a BGZF-compressed .tbi or .csi index.
+func ReadTabixIndex(r io.Reader) (*TabixIndex, error) {
+	br := bufio.NewReader(NewBgzfReader(r))
+	t := &TabixIndex{MinShift: 14, Depth: 5}
+
+	var magic [4]byte
+	if _, e := io.ReadFull(br, magic[:]); e != nil {
+		return nil, fmt.Errorf("ReadTabixIndex: %w", e)
+	}
+	var nref int32
+	var e error
+	switch string(magic[:]) {
+	case "TBI\x01":
+		if nref, e = readInt32(br); e != nil {
+			return nil, e
+		}
+		if e := readTabixConfNames(br, t); e != nil {
+			return nil, e
+		}
+	case "CSI\x01":
+		t.Csi = true
+		vals := make([]int32, 3)
+		if e := binary.Read(br, binary.LittleEndian, vals); e != nil {
+			return nil, e
+		}
+		t.MinShift, t.Depth = int(vals[0]), int(vals[1])
+		aux, e := readTabixSlice[byte](br, vals[2], "l_aux")
+		if e != nil {
+			return nil, e
+		}
+		if len(aux) >= 28 {
+			if e := readTabixConfNames(bytes.NewReader(aux), t); e != nil {
+				return nil, e
+			}
+		}
+		if nref, e = readInt32(br); e != nil {
+			return nil, e
+		}
+	default:
+		return nil, fmt.Errorf("ReadTabixIndex: %w: bad magic %q", ErrTabixFormat, magic)
+	}
+
+	for i := int32(0); i < nref; i++ {
+		ref, e := readTabixRef(br, t.Csi)
+		if e != nil {
+			return nil, fmt.Errorf("ReadTabixIndex: %w", e)
+		}
+		t.Refs = append(t.Refs, ref)
+	}
+	if t.NoCoor, e = readUint64(br); e != nil && e != io.EOF {
+		return nil, fmt.Errorf("ReadTabixIndex: %w", e)
+	}
+	return t, nil
+}
+
+func (t *TabixIndex) appendConfNames(buf []byte) []byte {
+	var names []byte
+	for _, name := range t.Names {
+		names = append(names, name...)
+		names = append(names, 0)
+	}
+	for _, v := range []int32{t.Format, t.ColSeq, t.ColBeg, t.ColEnd, t.Meta, t.Skip, int32(len(names))} {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+	}
+	return append(buf, names...)
+}
+
+// Write the index as a BGZF-compressed .tbi, or .csi if t.Csi is set.
+func WriteTabixIndex(w io.Writer, t *TabixIndex) error {
+	var buf []byte
+	if t.Csi {
+		aux := t.appendConfNames(nil)
+		buf = append(buf, "CSI\x01"...)
+		for _, v := range []int32{int32(t.MinShift), int32(t.Depth), int32(len(aux))} {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+		}
+		buf = append(buf, aux...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.Refs)))
+	} else {
+		buf = append(buf, "TBI\x01"...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.Refs)))
+		buf = t.appendConfNames(buf)
+	}
+
+	for _, ref := range t.Refs {
+		bins := make([]uint32, 0, len(ref.Bins))
+		for bin := range ref.Bins {
+			bins = append(bins, bin)
+		}
+		slices.Sort(bins)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(bins)))
+		for _, bin := range bins {
+			b := ref.Bins[bin]
+			buf = binary.LittleEndian.AppendUint32(buf, b.Bin)
+			if t.Csi {
+				buf = binary.LittleEndian.AppendUint64(buf, b.Loffset)
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b.Chunks)))
+			for _, c := range b.Chunks {
+				buf = binary.LittleEndian.AppendUint64(buf, c.Beg)
+				buf = binary.LittleEndian.AppendUint64(buf, c.End)
+			}
+		}
+		if !t.Csi {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ref.Intervals)))
+			for _, off := range ref.Intervals {
+				buf = binary.LittleEndian.AppendUint64(buf, off)
+			}
+		}
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, t.NoCoor)
+
+	bw := NewBgzfWriter(w)
+	if _, e := bw.Write(buf); e != nil {
+		return e
+	}
+	return bw.Close()
+}
+
+func TabixIndexPath(path string, csi bool) string {
+	if csi {
+		return path + ".csi"
+	}
+	return path + ".tbi"
+}
+
+func WriteTabixIndexPath(path string, t *TabixIndex) (err error) {
+	w, e := os.Create(path)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := w.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	return WriteTabixIndex(w, t)
+}
+
+func ReadTabixIndexPath(path string) (t *TabixIndex, err error) {
+	r, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer func() {
+		e := r.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	return ReadTabixIndex(r)
+}
+
+// Index an existing BGZF-compressed file.
+func BuildTabix(r io.Reader, conf TabixConf, csi bool) (*TabixIndex, error) {
+	br := NewBgzfReader(r)
+	x := NewTabixIndexer(conf, csi)
+	var line []byte
+	var e error
+	for i := 0; ; i++ {
+		beg := br.Tell()
+		if line, e = br.ReadLine(line); e == io.EOF {
+			break
+		} else if e != nil {
+			return nil, e
+		}
+		if i < int(conf.Skip) || conf.IsMeta(string(line)) || len(line) == 0 {
+			continue
+		}
+		c, e := conf.LineSpan(string(line))
+		if e != nil {
+			return nil, e
+		}
+		if e := x.Add(c, beg, br.Tell()); e != nil {
+			return nil, e
+		}
+	}
+	return x.Finish(), nil
+}
+
+func BuildTabixPath(path string, conf TabixConf, csi bool) (err error) {
+	r, e := os.Open(path)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := r.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	t, e := BuildTabix(r, conf, csi)
+	if e != nil {
+		return e
+	}
+	return WriteTabixIndexPath(TabixIndexPath(path, csi), t)
+}
+
+type TabixFile struct {
+	Index *TabixIndex
+	f     *os.File
+	r     *BgzfReader
+}
+
+// Open a BGZF-compressed file and its .tbi or .csi index.
+func OpenTabix(path string) (*TabixFile, error) {
+	var t *TabixIndex
+	var e error
+	if _, e = os.Stat(TabixIndexPath(path, false)); e == nil {
+		t, e = ReadTabixIndexPath(TabixIndexPath(path, false))
+	} else if _, e = os.Stat(TabixIndexPath(path, true)); e == nil {
+		t, e = ReadTabixIndexPath(TabixIndexPath(path, true))
+	} else {
+		e = fmt.Errorf("OpenTabix: no .tbi or .csi index for %v", path)
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	return &TabixFile{Index: t, f: f, r: NewBgzfReader(f)}, nil
+}
+
+func (t *TabixFile) Close() error {
+	return t.f.Close()
+}
+
+// Iterate over the lines of the file that overlap region.
+func (t *TabixFile) Query(region ChrSpan) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var line []byte
+		for _, c := range t.Index.Chunks(region.Chr, region.Span) {
+			if e := t.r.Seek(c.Beg); e != nil {
+				yield("", e)
+				return
+			}
+			for t.r.Tell() < c.End {
+				var e error
+				if line, e = t.r.ReadLine(line); e == io.EOF {
+					break
+				} else if e != nil {
+					yield("", e)
+					return
+				}
+				if t.Index.IsMeta(string(line)) || len(line) == 0 {
+					continue
+				}
+				cs, e := t.Index.LineSpan(string(line))
+				if e != nil {
+					if !yield("", e) {
+						return
+					}
+					continue
+				}
+				if cs.Chr != region.Chr || cs.End <= region.Start {
+					continue
+				}
+				if region.End >= 0 && cs.Start >= region.End {
+					break
+				}
+				if !yield(string(line), nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func QueryBed[FT any](t *TabixFile, region ChrSpan, fieldParse func([]string) (FT, error)) iter.Seq2[BedEntry[FT], error] {
+	return func(yield func(BedEntry[FT], error) bool) {
+		for line, e := range t.Query(region) {
+			if e != nil {
+				yield(BedEntry[FT]{}, e)
+				return
+			}
+			b, e := ParseBedEntry(strings.Split(line, "\t"), fieldParse)
+			ok := yield(b, e)
+			if e != nil || !ok {
+				return
+			}
+		}
+	}
+}
+
+func QueryVcf[T any](t *TabixFile, region ChrSpan, f func(line []string) (T, error)) iter.Seq2[VcfEntry[T], error] {
+	return func(yield func(VcfEntry[T], error) bool) {
+		for line, e := range t.Query(region) {
+			if e != nil {
+				yield(VcfEntry[T]{}, e)
+				return
+			}
+			v, e := ParseVcfEntry(strings.Split(line, "\t"), f)
+			ok := yield(v, e)
+			if e != nil || !ok {
+				return
+			}
+		}
+	}
+}
+
+func ParseBedRegion[FT any](path string, region ChrSpan, fieldParse func([]string) (FT, error)) iter.Seq2[BedEntry[FT], error] {
+	return func(yield func(BedEntry[FT], error) bool) {
+		t, e := OpenTabix(path)
+		if e != nil {
+			yield(BedEntry[FT]{}, e)
+			return
+		}
+		defer t.Close()
+		QueryBed(t, region, fieldParse)(yield)
+	}
+}
+
+func ParseVcfRegion[T any](path string, region ChrSpan, f func(line []string) (T, error)) iter.Seq2[VcfEntry[T], error] {
+	return func(yield func(VcfEntry[T], error) bool) {
+		t, e := OpenTabix(path)
+		if e != nil {
+			yield(VcfEntry[T]{}, e)
+			return
+		}
+		defer t.Close()
+		QueryVcf(t, region, f)(yield)
+	}
+}
+
+// Writes BGZF-compressed, sorted lines and indexes them as it goes.
+type TabixWriter struct {
+	bw      *BgzfWriter
+	indexer *TabixIndexer
+	lines   int
+}
+
+func NewTabixWriter(w io.Writer, conf TabixConf, csi bool) *TabixWriter {
+	return &TabixWriter{bw: NewBgzfWriter(w), indexer: NewTabixIndexer(conf, csi)}
+}
+
+// Write one line, without its trailing newline. Meta lines and the first Skip
+// lines are written but not indexed.
+func (t *TabixWriter) WriteLine(line string) error {
+	conf := t.indexer.Index.TabixConf
+	t.lines++
+	if t.lines <= int(conf.Skip) || conf.IsMeta(line) {
+		_, e := fmt.Fprintf(t.bw, "%s\n", line)
+		return e
+	}
+	c, e := conf.LineSpan(line)
+	if e != nil {
+		return e
+	}
+	beg := t.bw.Tell()
+	if _, e := fmt.Fprintf(t.bw, "%s\n", line); e != nil {
+		return e
+	}
+	return t.indexer.Add(c, beg, t.bw.Tell())
+}
+
+// Finish the BGZF stream. The underlying writer is not closed.
+func (t *TabixWriter) Close() error {
+	return t.bw.Close()
+}
+
+func (t *TabixWriter) Index() *TabixIndex {
+	return t.indexer.Finish()
+}
+
+type TabixFileWriter struct {
+	*TabixWriter
+	path string
+	f    *os.File
+}
+
+func CreateTabix(path string, conf TabixConf, csi bool) (*TabixFileWriter, error) {
+	f, e := os.Create(path)
+	if e != nil {
+		return nil, e
+	}
+	return &TabixFileWriter{TabixWriter: NewTabixWriter(f, conf, csi), path: path, f: f}, nil
+}
+
+// Close the compressed file and write its index next to it.
+func (t *TabixFileWriter) Close() error {
+	err := t.TabixWriter.Close()
+	if e := t.f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	idx := t.Index()
+	return WriteTabixIndexPath(TabixIndexPath(t.path, idx.Csi), idx)
+}
+
+func WriteBedTabix[B BedEnter[T], T any](path string, it iter.Seq2[B, error], writeFields func(io.Writer, T) error, csi bool) (err error) {
+	w, e := CreateTabix(path, TabixBedConf, csi)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := w.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	var b strings.Builder
+	for bed, e := range it {
+		if e != nil {
+			return e
+		}
+		b.Reset()
+		if e := WriteBedEntry(&b, bed, writeFields); e != nil {
+			return e
+		}
+		if e := w.WriteLine(strings.TrimSuffix(b.String(), "\n")); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Write a BGZF-compressed vcf and its index. The header lines, including the
+// #CHROM line, are written first.
+func WriteVcfTabix[InfoT any, SampleT Formatter](path string, header []string, it iter.Seq2[VcfEntry[StructuredInfoSamples[InfoT, SampleT]], error], csi bool) (err error) {
+	w, e := CreateTabix(path, TabixVcfConf, csi)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := w.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	for _, line := range header {
+		if e := w.WriteLine(line); e != nil {
+			return e
+		}
+	}
+	var buf []string
+	for v, e := range it {
+		if e != nil {
+			return e
+		}
+		if buf, e = StructuredVcfEntryToCsv(buf, v); e != nil {
+			return e
+		}
+		if e := w.WriteLine(strings.Join(buf, "\t")); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func TabixPreset(name string) (TabixConf, error) {
+	switch name {
+	case "bed":
+		return TabixBedConf, nil
+	case "vcf":
+		return TabixVcfConf, nil
+	case "gff":
+		return TabixGffConf, nil
+	default:
+		return TabixConf{}, fmt.Errorf("TabixPreset: unknown preset %v", name)
+	}
+}
+
+type TabixFlags struct {
+	Preset string
+	Csi    bool
+	Out    string
+}
+
+func CompressTabix(r io.Reader, path string, conf TabixConf, csi bool) (err error) {
+	w, e := CreateTabix(path, conf, csi)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		e := w.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+	s := bufio.NewScanner(r)
+	s.Buffer([]byte{}, 1e12)
+	for s.Scan() {
+		if e := w.WriteLine(s.Text()); e != nil {
+			return e
+		}
+	}
+	return s.Err()
+}
+
+func FullTabix() {
+	var f TabixFlags
+	flag.StringVar(&f.Preset, "p", "", "Index the input using a preset (bed, vcf, gff)")
+	flag.BoolVar(&f.Csi, "C", false, "Write a .csi index instead of a .tbi")
+	flag.StringVar(&f.Out, "o", "", "Compress stdin to this path and index it (requires -p)")
+	flag.Parse()
+
+	if f.Out != "" {
+		conf, e := TabixPreset(f.Preset)
+		if e != nil {
+			log.Fatal(e)
+		}
+		if e := CompressTabix(bufio.NewReader(os.Stdin), f.Out, conf, f.Csi); e != nil {
+			log.Fatal(e)
+		}
+		return
+	}
+
+	if flag.NArg() < 1 {
+		log.Fatal(fmt.Errorf("usage: tabix [-p preset [-C]] in.gz [region ...] | tabix -p preset [-C] -o out.gz < in"))
+	}
+	path := flag.Arg(0)
+	if f.Preset != "" {
+		conf, e := TabixPreset(f.Preset)
+		if e != nil {
+			log.Fatal(e)
+		}
+		if e := BuildTabixPath(path, conf, f.Csi); e != nil {
+			log.Fatal(e)
+		}
+	}
+	if flag.NArg() < 2 {
+		return
+	}
+
+	t, e := OpenTabix(path)
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer t.Close()
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	for _, region := range flag.Args()[1:] {
+		c, e := ParseRegion(region)
+		if e != nil {
+			log.Fatal(e)
+		}
+		for line, e := range t.Query(c) {
+			if e != nil {
+				log.Fatal(e)
+			}
+			if _, e := fmt.Fprintf(w, "%s\n", line); e != nil {
+				log.Fatal(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package fastats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBgzfRoundTrip(t *testing.T) {
+	var in strings.Builder
+	for i := 0; i < 50000; i++ {
+		fmt.Fprintf(&in, "line %v\n", i)
+	}
+
+	var buf bytes.Buffer
+	w := NewBgzfWriter(&buf)
+	if _, e := w.Write([]byte(in.String())); e != nil {
+		t.Fatal(e)
+	}
+	if e := w.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	out, e := io.ReadAll(NewBgzfReader(&buf))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(out) != in.String() {
+		t.Errorf("round trip changed data; len(out) %v, len(in) %v", len(out), in.Len())
+	}
+}
+
+func TestReg2Bin(t *testing.T) {
+	if b := Reg2Bin(0, 1, 14, 5); b != 4681 {
+		t.Errorf("Reg2Bin(0, 1) %v != 4681", b)
+	}
+	if b := Reg2Bin(0, 1<<29, 14, 5); b != 0 {
+		t.Errorf("Reg2Bin(0, 1<<29) %v != 0", b)
+	}
+	if b := Reg2Bin(1<<14, 1<<15, 14, 5); b != 4682 {
+		t.Errorf("Reg2Bin(1<<14, 1<<15) %v != 4682", b)
+	}
+}
+
+func tabixTestBed() []BedEntry[float64] {
+	var out []BedEntry[float64]
+	for _, chr := range []string{"chr1", "chr2"} {
+		for i := int64(0); i < 20000; i++ {
+			out = append(out, BedEntry[float64]{ChrSpan{chr, Span{i * 50, i*50 + 100 + i%7*1000}}, float64(i)})
+		}
+	}
+	return out
+}
+
+func TestTabixQuery(t *testing.T) {
+	bed := tabixTestBed()
+	dir := t.TempDir()
+
+	for _, csi := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprintf("test_%v.bed.gz", csi))
+		if e := WriteBedTabix(path, SliceIter2(bed), func(w io.Writer, f float64) error {
+			_, e := fmt.Fprintf(w, "\t%v", f)
+			return e
+		}, csi); e != nil {
+			t.Fatal(e)
+		}
+
+		regions := []ChrSpan{
+			ChrSpan{"chr1", Span{0, 10}},
+			ChrSpan{"chr1", Span{500000, 520000}},
+			ChrSpan{"chr2", Span{999000, 1000000}},
+			ChrSpan{"chr3", Span{0, 100}},
+		}
+		for _, region := range regions {
+			var exp []BedEntry[float64]
+			for _, b := range bed {
+				if b.Chr == region.Chr && b.End > region.Start && b.Start < region.End {
+					exp = append(exp, b)
+				}
+			}
+			got, e := CollectErr(ParseBedRegion(path, region, ColToFloat(0)))
+			if e != nil {
+				t.Fatal(e)
+			}
+			if !reflect.DeepEqual(got, exp) {
+				t.Errorf("csi %v region %v: len(got) %v != len(exp) %v", csi, region, len(got), len(exp))
+			}
+		}
+	}
+}
+
+const tabixVcf = `##fileformat=VCFv4.2
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+1	10	.	A	T	50	PASS	DP=3
+1	20	.	ACGT	A	50	PASS	DP=4
+2	5	.	G	C	50	PASS	DP=5
+`
+
+func TestTabixVcf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.vcf.gz")
+	if e := CompressTabix(strings.NewReader(tabixVcf), path, TabixVcfConf, false); e != nil {
+		t.Fatal(e)
+	}
+	got, e := CollectErr(ParseVcfRegion(path, ChrSpan{"1", Span{21, 22}}, func([]string) (struct{}, error) { return struct{}{}, nil }))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 1 || got[0].Start != 19 || got[0].Ref != "ACGT" {
+		t.Errorf("got %v; expected only the deletion at 1:20", got)
+	}
+
+	n := 0
+	for _, e := range ParseVcfRegion(path, ChrSpan{"1", Span{0, -1}}, func([]string) (struct{}, error) { return struct{}{}, fmt.Errorf("bad") }) {
+		n++
+		if e == nil {
+			t.Errorf("expected parse error")
+		}
+	}
+	if n != 1 {
+		t.Errorf("got %v entries; expected to stop after the first error", n)
+	}
+}
+
+func TestReadTabixIndexBadCounts(t *testing.T) {
+	index := func(vals ...int32) []byte {
+		var raw bytes.Buffer
+		raw.WriteString("TBI\x01")
+		// n_ref, then format, col_seq, col_beg, col_end, meta, skip and
+		// l_nm = 0, then the counts of one reference.
+		binary.Write(&raw, binary.LittleEndian, []int32{1, 0, 1, 2, 3, '#', 0, 0})
+		binary.Write(&raw, binary.LittleEndian, vals)
+		var buf bytes.Buffer
+		w := NewBgzfWriter(&buf)
+		w.Write(raw.Bytes())
+		w.Close()
+		return buf.Bytes()
+	}
+	// One bin with n_chunk = -1, then no bins and n_intv = -1.
+	for _, b := range [][]byte{index(1, 0, -1), index(0, -1)} {
+		if _, e := ReadTabixIndex(bytes.NewReader(b)); !errors.Is(e, ErrTabixFormat) {
+			t.Errorf("expected ErrTabixFormat, got %v", e)
+		}
+	}
+	// A huge n_intv fails at the end of the input.
+	if _, e := ReadTabixIndex(bytes.NewReader(index(0, 1<<30))); e == nil {
+		t.Errorf("expected error for truncated intervals")
+	}
+}
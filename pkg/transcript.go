@@ -0,0 +1,229 @@
+package fastats
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+// A source of reference subsequences, such as a FastaIndexedReader.
+type SeqFetcher interface {
+	Fetch(chr string, s Span) (string, error)
+}
+
+// Fasta entries in memory, by name: the first word of the header, as in a
+// .fai index.
+type FaSeqs map[string]FaEntry
+
+func CollectFaSeqs[F FaEnter](it iter.Seq2[F, error]) (FaSeqs, error) {
+	m := FaSeqs{}
+	for f, e := range it {
+		if e != nil {
+			return nil, e
+		}
+		m[FaiName(f.FaHeader())] = ToFaEntry(f)
+	}
+	return m, nil
+}
+
+func (m FaSeqs) Fetch(chr string, s Span) (string, error) {
+	f, ok := m[chr]
+	if !ok {
+		return "", fmt.Errorf("FaSeqs.Fetch: chr %v not in fasta", chr)
+	}
+	out, e := ExtractOne(f, s)
+	return out.Seq, e
+}
+
+// Splice the parts of one feature together in transcript order: by start,
+// then reverse complemented on the minus strand.
+func SpliceSeq(fetch SeqFetcher, parts []GffFlatEntry, strand byte) (string, error) {
+	parts = slices.Clone(parts)
+	slices.SortFunc(parts, func(a, b GffFlatEntry) int { return cmp.Compare(a.Start, b.Start) })
+	var b strings.Builder
+	for _, p := range parts {
+		seq, e := fetch.Fetch(p.Chr, p.Span)
+		if e != nil {
+			return "", fmt.Errorf("SpliceSeq: %v:%v-%v: %w", p.Chr, p.Start+1, p.End, e)
+		}
+		b.WriteString(seq)
+	}
+	if strand == '-' {
+		return ReverseComplement(b.String()), nil
+	}
+	return b.String(), nil
+}
+
+// The spliced CDS with the phase of its 5'-most part trimmed, so that it
+// begins on a whole codon.
+func CDSSeq(fetch SeqFetcher, cds []GffFlatEntry, strand byte) (string, error) {
+	seq, e := SpliceSeq(fetch, cds, strand)
+	if e != nil || len(cds) == 0 {
+		return seq, e
+	}
+	first := slices.MinFunc(cds, func(a, b GffFlatEntry) int { return cmp.Compare(a.Start, b.Start) })
+	if strand == '-' {
+		first = slices.MaxFunc(cds, func(a, b GffFlatEntry) int { return cmp.Compare(a.End, b.End) })
+	}
+	if first.HasPhase && first.Phase > 0 && first.Phase <= len(seq) {
+		seq = seq[first.Phase:]
+	}
+	return seq, nil
+}
+
+type TranscriptSeqKind int
+
+const (
+	CDNASeq TranscriptSeqKind = iota
+	CodingSeq
+	ProteinSeq
+)
+
+func ParseTranscriptSeqKind(s string) (TranscriptSeqKind, error) {
+	switch s {
+	case "cdna":
+		return CDNASeq, nil
+	case "cds":
+		return CodingSeq, nil
+	case "protein":
+		return ProteinSeq, nil
+	}
+	return 0, fmt.Errorf("ParseTranscriptSeqKind: unknown kind %v", s)
+}
+
+func transcriptHeader(gene, tx *GffFeature) string {
+	h := fmt.Sprintf("%v %v:%v-%v(%c)", tx.ID, tx.SpanChr(), tx.SpanStart()+1, tx.SpanEnd(), tx.Strand())
+	if gene != nil {
+		h += " gene=" + gene.ID
+	}
+	return h
+}
+
+// The cDNA, CDS or protein sequence of each transcript in the tree. cDNA is
+// spliced from exons, or from CDS when a transcript has no exons. CDS and
+// protein skip transcripts without CDS; proteins are translated with code,
+// with an alternative start codon translated as M, and keep their stop as '*'.
+func ExtractTranscripts(t *GffTree, fetch SeqFetcher, kind TranscriptSeqKind, code GeneticCode) iter.Seq2[FaEntry, error] {
+	return func(yield func(FaEntry, error) bool) {
+		for gene, tx := range t.Transcripts() {
+			var seq string
+			var e error
+			switch kind {
+			case CDNASeq:
+				parts := tx.Exons()
+				if len(parts) == 0 {
+					parts = tx.CDS()
+				}
+				seq, e = SpliceSeq(fetch, parts, tx.Strand())
+			case CodingSeq, ProteinSeq:
+				cds := tx.CDS()
+				if len(cds) == 0 {
+					continue
+				}
+				seq, e = CDSSeq(fetch, cds, tx.Strand())
+				if e == nil && kind == ProteinSeq {
+					seq = code.TranslateSeq(seq, true)
+				}
+			}
+			if !yield(FaEntry{transcriptHeader(gene, tx), seq}, e) || e != nil {
+				return
+			}
+		}
+	}
+}
+
+type TxExtractFlags struct {
+	Fasta   string
+	Gff     string
+	Dialect string
+	Kind    string
+	Code    int
+}
+
+func FullTxExtract() {
+	var f TxExtractFlags
+	flag.StringVar(&f.Fasta, "f", "", "Reference fasta, indexed or not (required)")
+	flag.StringVar(&f.Gff, "g", "", "Annotation to read instead of stdin")
+	flag.StringVar(&f.Dialect, "d", "gff3", "Annotation dialect: gff3 or gtf")
+	flag.StringVar(&f.Kind, "t", "cdna", "Sequence to write: cdna, cds or protein")
+	flag.IntVar(&f.Code, "c", 1, "NCBI genetic code table for protein")
+	flag.Parse()
+
+	if f.Fasta == "" {
+		log.Fatal("missing -f")
+	}
+	kind, e := ParseTranscriptSeqKind(f.Kind)
+	if e != nil {
+		log.Fatal(e)
+	}
+	code, e := GetGeneticCode(f.Code)
+	if e != nil {
+		log.Fatal(e)
+	}
+	dialect, e := ParseGffDialect(f.Dialect)
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	var r io.Reader = os.Stdin
+	if f.Gff != "" {
+		zr, e := zfile.Open(f.Gff)
+		if e != nil {
+			log.Fatal(e)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	entries := ParseGffDialectFlat(r, dialect)
+	if dialect == Gtf {
+		entries = GtfToGff3(entries)
+	}
+	all, e := CollectErr(entries)
+	if e != nil {
+		log.Fatal(e)
+	}
+	tree, e := NewGffTree(all)
+	if e != nil {
+		log.Print(e)
+	}
+
+	var fetch SeqFetcher
+	if HasFai(f.Fasta) {
+		fa, e := OpenFastaIndexed(f.Fasta, false)
+		if e != nil {
+			log.Fatal(e)
+		}
+		defer fa.Close()
+		fetch = fa.FastaIndexedReader
+	} else {
+		zr, e := zfile.Open(f.Fasta)
+		if e != nil {
+			log.Fatal(e)
+		}
+		seqs, e := CollectFaSeqs(ParseFasta(zr))
+		zr.Close()
+		if e != nil {
+			log.Fatal(e)
+		}
+		fetch = seqs
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	if e := WriteFa(w, ExtractTranscripts(tree, fetch, kind, code)); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -0,0 +1,86 @@
+package fastats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneticCodes(t *testing.T) {
+	for _, g := range GeneticCodes {
+		if len(g.AAs) != 64 || len(g.Starts) != 64 {
+			t.Errorf("code %v: len(AAs) %v, len(Starts) %v", g.ID, len(g.AAs), len(g.Starts))
+		}
+	}
+	std, _ := GetGeneticCode(1)
+	if got := std.TranslateSeq("ATGTGGTAANNNTG", true); got != "MW*X" {
+		t.Errorf("standard: %v", got)
+	}
+	mito, _ := GetGeneticCode(2)
+	if got := mito.TranslateSeq("ATATGAAGA", true); got != "MW*" {
+		t.Errorf("vertebrate mito: %v", got)
+	}
+	// Table 24 differs from the standard code only at AGA, AGG and TGA.
+	rhabdo, _ := GetGeneticCode(24)
+	if got := rhabdo.TranslateSeq("ATAAGAAGGTGA", false); got != "ISKW" {
+		t.Errorf("Rhabdopleuridae mito: %v", got)
+	}
+	if got := ReverseComplement("AACGTNrym"); got != "kryNACGTT" {
+		t.Errorf("revcomp: %v", got)
+	}
+}
+
+func TestCollectFaSeqs(t *testing.T) {
+	seqs, e := CollectFaSeqs(ParseFasta(strings.NewReader(">chr1 assembled chromosome\nACGTACGT\n")))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got, e := seqs.Fetch("chr1", Span{2, 6}); e != nil || got != "GTAC" {
+		t.Errorf("Fetch %q, %v", got, e)
+	}
+}
+
+// chr1: a plus-strand gene with a CDS split over two exons, and a
+// minus-strand gene whose CDS starts with phase 1.
+const txFasta = ">chr1\nGGATGAAACCCTTTGGGTAAGG\n"
+
+const txGff = `chr1	t	gene	1	22	.	+	.	ID=g1
+chr1	t	mRNA	1	22	.	+	.	ID=t1;Parent=g1
+chr1	t	exon	1	8	.	+	.	Parent=t1
+chr1	t	exon	12	22	.	+	.	Parent=t1
+chr1	t	CDS	3	8	.	+	0	Parent=t1
+chr1	t	CDS	12	20	.	+	0	Parent=t1
+chr1	t	mRNA	1	10	.	-	.	ID=t2
+chr1	t	CDS	1	10	.	-	1	Parent=t2
+`
+
+func TestExtractTranscripts(t *testing.T) {
+	seqs, e := CollectFaSeqs(ParseFasta(strings.NewReader(txFasta)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	tree, e := ReadGffTree(strings.NewReader(txGff))
+	if e != nil {
+		t.Fatal(e)
+	}
+	code, _ := GetGeneticCode(1)
+	get := func(kind TranscriptSeqKind) []string {
+		fs, e := CollectErr(ExtractTranscripts(tree, seqs, kind, code))
+		if e != nil {
+			t.Fatal(e)
+		}
+		var out []string
+		for _, f := range fs {
+			out = append(out, f.Seq)
+		}
+		return out
+	}
+	if got := get(CDNASeq); strings.Join(got, ",") != "GGATGAAATTTGGGTAAGG,GGTTTCATCC" {
+		t.Errorf("cdna %v", got)
+	}
+	if got := get(CodingSeq); strings.Join(got, ",") != "ATGAAATTTGGGTAA,GTTTCATCC" {
+		t.Errorf("cds %v", got)
+	}
+	if got := get(ProteinSeq); strings.Join(got, ",") != "MKFG*,VSS" {
+		t.Errorf("protein %v", got)
+	}
+}
@@ -0,0 +1,279 @@
+package fastats
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/jgbaldwinbrown/zfile"
+)
+
+type VarCallOptions struct {
+	Pileup      PileupOptions
+	MinDepth    int64
+	MinAltCount int64
+	MinAltFreq  float64
+	// Genotype as 1/1 instead of 0/1 at or above this alt frequency
+	HomAltFreq float64
+	NoIndels   bool
+}
+
+func DefaultVarCallOptions() VarCallOptions {
+	o := VarCallOptions{
+		Pileup:      DefaultPileupOptions(),
+		MinDepth:    10,
+		MinAltCount: 2,
+		MinAltFreq:  0.05,
+		HomAltFreq:  0.8,
+	}
+	o.Pileup.MinBaseQual = 13
+	return o
+}
+
+type VarCall = VcfEntry[StructuredInfoSamples[string, StringFormatter]]
+
+var VarCallFormat = []string{"GT", "DP", "AD", "AF"}
+
+// Header lines for calls on the references in h, with one sample column.
+func VarCallHeader(h SamHeader, sample string) []string {
+	out := []string{"##fileformat=VCFv4.2", "##source=fastats varcall"}
+	for _, sq := range h.SQ {
+		out = append(out, fmt.Sprintf("##contig=<ID=%v,length=%v>", sq.Name, sq.Len))
+	}
+	return append(out,
+		`##INFO=<ID=DP,Number=1,Type=Integer,Description="Read depth">`,
+		`##INFO=<ID=AD,Number=R,Type=Integer,Description="Read depth of each allele">`,
+		`##INFO=<ID=AF,Number=A,Type=Float,Description="Alternate allele frequency in reads">`,
+		`##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">`,
+		`##FORMAT=<ID=DP,Number=1,Type=Integer,Description="Read depth">`,
+		`##FORMAT=<ID=AD,Number=R,Type=Integer,Description="Read depth of each allele">`,
+		`##FORMAT=<ID=AF,Number=A,Type=Float,Description="Alternate allele frequency in reads">`,
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t"+sample,
+	)
+}
+
+// The sample named in the first @RG line of h, or def if there is none.
+func SamSampleName(h SamHeader, def string) string {
+	for _, rg := range h.RG {
+		if rg.Sample != "" {
+			return rg.Sample
+		}
+	}
+	return def
+}
+
+func phredSum(probs []float64) float64 {
+	q := 0.0
+	for _, p := range probs {
+		if !math.IsNaN(p) && p > 0 {
+			q += -10 * math.Log10(p)
+		}
+	}
+	return math.Round(math.Min(q, 999))
+}
+
+// Build a biallelic call, or return false if it does not pass the thresholds
+// in o. AF is the alt count over all reads, including those with a third
+// allele. QUAL is the summed phred base quality of the alt-supporting bases.
+func makeVarCall(p PileupEntry, ref, alt string, depth, refCount, altCount int64, altProbs []float64, o VarCallOptions) (VarCall, bool) {
+	var v VarCall
+	if depth < o.MinDepth || altCount == 0 || altCount < o.MinAltCount {
+		return v, false
+	}
+	af := float64(altCount) / float64(depth)
+	if af < o.MinAltFreq {
+		return v, false
+	}
+
+	v.ChrSpan = ChrSpan{p.Chr, Span{p.Pos, p.Pos + int64(len(ref))}}
+	v.ID = "."
+	v.Ref = ref
+	v.Alts = []string{alt}
+	v.Qual = phredSum(altProbs)
+	v.Filter = "PASS"
+
+	dp := fmt.Sprint(depth)
+	ad := fmt.Sprintf("%v,%v", refCount, altCount)
+	afs := fmt.Sprintf("%.4g", af)
+	gt := "0/1"
+	if af >= o.HomAltFreq {
+		gt = "1/1"
+	}
+	v.InfoAndSamples.Info = []InfoPair[string]{{"DP", dp}, {"AD", ad}, {"AF", afs}}
+	v.InfoAndSamples.Samples = SampleSet[StringFormatter]{
+		Format:  VarCallFormat,
+		Samples: [][]StringFormatter{{StringFormatter(gt), StringFormatter(dp), StringFormatter(ad), StringFormatter(afs)}},
+	}
+	return v, true
+}
+
+func maxCountKey(m map[string]int64) (string, int64) {
+	best, bestCount := "", int64(0)
+	for k, c := range m {
+		if c > bestCount || (c == bestCount && k < best) {
+			best, bestCount = k, c
+		}
+	}
+	return best, bestCount
+}
+
+// Call at most one SNP and one indel at a pileup position. Only the most
+// common alternate allele of each kind is considered.
+func CallPileupEntry(p PileupEntry, o VarCallOptions) []VarCall {
+	var out []VarCall
+	if PileupBaseIndex(p.RefBase) > 3 {
+		return nil
+	}
+	c := p.Counts()
+
+	bestAlt := -1
+	for i := 0; i < 4; i++ {
+		if i != PileupBaseIndex(p.RefBase) && (bestAlt < 0 || c.Bases[i] > c.Bases[bestAlt]) {
+			bestAlt = i
+		}
+	}
+	var probs []float64
+	for _, r := range p.Reads {
+		if !r.IsDel() && PileupBaseIndex(r.Base) == bestAlt {
+			probs = append(probs, r.ErrorProb())
+		}
+	}
+	if v, ok := makeVarCall(p, string(p.RefBase), PileupBases[bestAlt:bestAlt+1], c.Depth-c.Deleted, c.Count(p.RefBase), c.Bases[bestAlt], probs, o); ok {
+		out = append(out, v)
+	}
+
+	if o.NoIndels {
+		return out
+	}
+	ins, insCount := maxCountKey(c.Insertions)
+	del, delCount := maxCountKey(c.Deletions)
+	if insCount == 0 && delCount == 0 {
+		return out
+	}
+	probs = probs[:0]
+	isIns := insCount >= delCount
+	for _, r := range p.Reads {
+		if (isIns && strings.ToUpper(r.Insertion) == ins) || (!isIns && r.Deletion == del) {
+			probs = append(probs, r.ErrorProb())
+		}
+	}
+	ref, alt, count := string(p.RefBase), string(p.RefBase)+ins, insCount
+	if !isIns {
+		ref, alt, count = string(p.RefBase)+del, string(p.RefBase), delCount
+	}
+	if v, ok := makeVarCall(p, ref, alt, c.Depth-c.Deleted, c.Depth-c.Deleted-count, count, probs, o); ok {
+		out = append(out, v)
+	}
+	return out
+}
+
+func CallVariants(it iter.Seq2[PileupEntry, error], o VarCallOptions) iter.Seq2[VarCall, error] {
+	return func(yield func(VarCall, error) bool) {
+		for p, e := range it {
+			if e != nil {
+				yield(VarCall{}, e)
+				return
+			}
+			for _, v := range CallPileupEntry(p, o) {
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func WriteVarCalls(w io.Writer, header []string, it iter.Seq2[VarCall, error]) error {
+	for _, line := range header {
+		if _, e := fmt.Fprintln(w, line); e != nil {
+			return e
+		}
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = rune('\t')
+	var buf []string
+	for v, e := range it {
+		if e != nil {
+			return e
+		}
+		if buf, e = StructuredVcfEntryToCsv(buf, v); e != nil {
+			return e
+		}
+		if e := cw.Write(buf); e != nil {
+			return e
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type VarCallFlags struct {
+	Ref    string
+	Sample string
+	Out    string
+	Csi    bool
+}
+
+func FullVarCall() {
+	o := DefaultVarCallOptions()
+	var f VarCallFlags
+	flag.StringVar(&f.Ref, "f", "", "Reference fasta (required)")
+	flag.StringVar(&f.Sample, "s", "", "Sample name (default: SM of the first @RG line, or \"sample\")")
+	flag.StringVar(&f.Out, "o", "", "Write bgzipped, tabix-indexed VCF to this path instead of plain VCF to stdout")
+	flag.BoolVar(&f.Csi, "C", false, "Write a CSI index instead of a tabix index")
+	flag.Int64Var(&o.Pileup.MinMapq, "q", 0, "Minimum mapping quality")
+	flag.Int64Var(&o.Pileup.MinBaseQual, "Q", o.Pileup.MinBaseQual, "Minimum base quality")
+	flag.Int64Var(&o.MinDepth, "d", o.MinDepth, "Minimum depth")
+	flag.Int64Var(&o.MinAltCount, "a", o.MinAltCount, "Minimum alternate allele read count")
+	flag.Float64Var(&o.MinAltFreq, "F", o.MinAltFreq, "Minimum alternate allele frequency")
+	flag.Float64Var(&o.HomAltFreq, "H", o.HomAltFreq, "Alternate allele frequency at which to call 1/1")
+	flag.BoolVar(&o.NoIndels, "I", false, "Do not call indels")
+	flag.Parse()
+	if f.Ref == "" {
+		log.Fatal("missing -f")
+	}
+
+	rr, e := zfile.Open(f.Ref)
+	if e != nil {
+		log.Fatal(e)
+	}
+	refs, e := CollectErr(ParseFasta(rr))
+	rr.Close()
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	h, it, e := ParseSamOrBamPlusHeader(os.Stdin)
+	if e != nil {
+		log.Fatal(e)
+	}
+	if f.Sample == "" {
+		f.Sample = SamSampleName(h, "sample")
+	}
+	header := VarCallHeader(h, f.Sample)
+	calls := CallVariants(Pileup(it, PileupRefs(refs), o.Pileup), o)
+
+	if f.Out != "" {
+		if e := WriteVcfTabix(f.Out, header, calls, f.Csi); e != nil {
+			log.Fatal(e)
+		}
+		return
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if e := w.Flush(); e != nil {
+			log.Fatal(e)
+		}
+	}()
+	if e := WriteVarCalls(w, header, calls); e != nil {
+		log.Fatal(e)
+	}
+}
@@ -0,0 +1,42 @@
+package fastats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCallVariants(t *testing.T) {
+	ref := map[string]string{"chr1": "ACGTACGTAC"}
+	var b strings.Builder
+	b.WriteString("@SQ\tSN:chr1\tLN:10\n@RG\tID:rg1\tSM:pool1\n")
+	for i := 0; i < 6; i++ {
+		b.WriteString("r\t0\tchr1\t1\t60\t6M\t*\t0\t0\tACGTAC\tIIIIII\n")
+	}
+	for i := 0; i < 4; i++ {
+		b.WriteString("r\t16\tchr1\t1\t60\t2M1D3M\t*\t0\t0\tACAAC\tIIIII\n")
+	}
+
+	h, it, e := ParseSamPlusHeader(strings.NewReader(b.String()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	o := DefaultVarCallOptions()
+	var out strings.Builder
+	header := VarCallHeader(h, SamSampleName(h, "sample"))
+	if e := WriteVarCalls(&out, header, CallVariants(Pileup(it, ref, o.Pileup), o)); e != nil {
+		t.Fatal(e)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if last := header[len(header)-1]; !strings.HasSuffix(last, "\tpool1") {
+		t.Errorf("sample line %q", last)
+	}
+	calls := lines[len(header):]
+	exp := []string{
+		"chr1\t2\t.\tCG\tC\t160\tPASS\tDP=10;AD=6,4;AF=0.4\tGT:DP:AD:AF\t0/1:10:6,4:0.4",
+		"chr1\t4\t.\tT\tA\t160\tPASS\tDP=10;AD=6,4;AF=0.4\tGT:DP:AD:AF\t0/1:10:6,4:0.4",
+	}
+	if strings.Join(calls, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("got:\n%v\nexp:\n%v", strings.Join(calls, "\n"), strings.Join(exp, "\n"))
+	}
+}
@@ -0,0 +1,284 @@
+package fastats
+
+import (
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+// Allele index of a missing allele, as in "./." or "0|.".
+const GenotypeMissing = -1
+
+type Genotype struct {
+	// Allele indices, 0 for the reference, GenotypeMissing for "."
+	Alleles []int
+	// True if every separator is '|'
+	Phased bool
+}
+
+func ParseGenotype(gt string) (Genotype, error) {
+	var g Genotype
+	if gt == "" || gt == "." {
+		return Genotype{Alleles: []int{GenotypeMissing}}, nil
+	}
+	g.Phased = strings.Contains(gt, "|") && !strings.Contains(gt, "/")
+	fields := strings.FieldsFunc(gt, func(r rune) bool { return r == '/' || r == '|' })
+	if len(fields) != VcfPloidy(gt) {
+		return g, fmt.Errorf("%w: ParseGenotype: empty allele in %q", ErrVcfFormat, gt)
+	}
+	g.Alleles = make([]int, 0, len(fields))
+	for _, f := range fields {
+		if f == "." {
+			g.Alleles = append(g.Alleles, GenotypeMissing)
+			continue
+		}
+		a, e := strconv.Atoi(f)
+		if e != nil || a < 0 {
+			return g, fmt.Errorf("%w: ParseGenotype: bad allele %q in %q", ErrVcfFormat, f, gt)
+		}
+		g.Alleles = append(g.Alleles, a)
+	}
+	return g, nil
+}
+
+func (g Genotype) Ploidy() int {
+	return len(g.Alleles)
+}
+
+func (g Genotype) String() string {
+	sep := "/"
+	if g.Phased {
+		sep = "|"
+	}
+	fields := make([]string, 0, len(g.Alleles))
+	for _, a := range g.Alleles {
+		if a == GenotypeMissing {
+			fields = append(fields, ".")
+		} else {
+			fields = append(fields, strconv.Itoa(a))
+		}
+	}
+	return strings.Join(fields, sep)
+}
+
+// True if every allele is missing.
+func (g Genotype) IsMissing() bool {
+	for _, a := range g.Alleles {
+		if a != GenotypeMissing {
+			return false
+		}
+	}
+	return true
+}
+
+// True if any allele is missing.
+func (g Genotype) HasMissing() bool {
+	for _, a := range g.Alleles {
+		if a == GenotypeMissing {
+			return true
+		}
+	}
+	return false
+}
+
+// True if the called alleles are not all the same. Genotypes with missing
+// alleles are never heterozygous.
+func (g Genotype) IsHet() bool {
+	if g.HasMissing() {
+		return false
+	}
+	for _, a := range g.Alleles[1:] {
+		if a != g.Alleles[0] {
+			return true
+		}
+	}
+	return false
+}
+
+func (g Genotype) IsHomRef() bool {
+	return !g.HasMissing() && !g.IsHet() && g.Alleles[0] == 0
+}
+
+func (g Genotype) IsHomAlt() bool {
+	return !g.HasMissing() && !g.IsHet() && g.Alleles[0] > 0
+}
+
+// Number of copies of allele a.
+func (g Genotype) Count(a int) int {
+	n := 0
+	for _, b := range g.Alleles {
+		if b == a {
+			n++
+		}
+	}
+	return n
+}
+
+// The FORMAT values of one sample in a typed VCF entry.
+type VcfSample struct {
+	Name   string
+	Format []string
+	Values []VcfValue
+}
+
+func (s VcfSample) Get(key string) (VcfValue, bool) {
+	for i, f := range s.Format {
+		if f == key && i < len(s.Values) {
+			return s.Values[i], true
+		}
+	}
+	return VcfValue{}, false
+}
+
+func (s VcfSample) ints(key string) ([]int64, bool) {
+	v, ok := s.Get(key)
+	if !ok || len(v.Ints) == 0 {
+		return nil, false
+	}
+	return v.Ints, true
+}
+
+func (s VcfSample) int(key string) (int64, bool) {
+	is, ok := s.ints(key)
+	if !ok || is[0] == VcfMissingInt {
+		return 0, false
+	}
+	return is[0], true
+}
+
+// The sample's genotype; a sample without GT has a single missing allele.
+func (s VcfSample) GT() (Genotype, error) {
+	v, ok := s.Get("GT")
+	if !ok || len(v.Strings) == 0 {
+		return ParseGenotype(".")
+	}
+	return ParseGenotype(v.Strings[0])
+}
+
+func (s VcfSample) AD() ([]int64, bool) { return s.ints("AD") }
+func (s VcfSample) PL() ([]int64, bool) { return s.ints("PL") }
+func (s VcfSample) DP() (int64, bool)   { return s.int("DP") }
+func (s VcfSample) GQ() (int64, bool)   { return s.int("GQ") }
+
+func TypedVcfSample(h VcfMeta, is VcfTypedInfoSamples, i int) VcfSample {
+	s := VcfSample{Format: is.Samples.Format}
+	if i < len(h.Samples) {
+		s.Name = h.Samples[i]
+	}
+	if i < len(is.Samples.Samples) {
+		s.Values = is.Samples.Samples[i]
+	}
+	return s
+}
+
+// The FORMAT values of the named sample.
+func (h VcfMeta) Sample(is VcfTypedInfoSamples, name string) (VcfSample, bool) {
+	i := h.SampleIndex(name)
+	if i < 0 || i >= len(is.Samples.Samples) {
+		return VcfSample{}, false
+	}
+	return TypedVcfSample(h, is, i), true
+}
+
+func VcfGenotypes(is VcfTypedInfoSamples) ([]Genotype, error) {
+	out := make([]Genotype, 0, len(is.Samples.Samples))
+	for i := range is.Samples.Samples {
+		g, e := TypedVcfSample(VcfMeta{}, is, i).GT()
+		if e != nil {
+			return nil, e
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+type VcfSiteStats struct {
+	ChrSpan
+	// Frequency of each alternate allele among called alleles
+	AltFreqs      []float64
+	CalledAlleles int
+	// Samples with at least one called allele
+	CalledSamples int
+	// Fraction of fully called samples that are heterozygous
+	Heterozygosity float64
+	// 1 - sum of squared allele frequencies
+	ExpectedHet float64
+	// Fraction of samples with a fully missing genotype
+	Missingness float64
+}
+
+func SiteStats(v VcfEntry[VcfTypedInfoSamples]) (VcfSiteStats, error) {
+	s := VcfSiteStats{ChrSpan: v.ChrSpan}
+	gts, e := VcfGenotypes(v.InfoAndSamples)
+	if e != nil {
+		return s, fmt.Errorf("SiteStats: %v:%v: %w", v.Chr, v.Start+1, e)
+	}
+	nalts := len(v.Alts)
+	if nalts == 1 && v.Alts[0] == "." {
+		nalts = 0
+	}
+	counts := make([]int, nalts+1)
+	hets, missing, nonmissing := 0, 0, 0
+	for _, g := range gts {
+		if g.IsMissing() {
+			missing++
+			continue
+		}
+		s.CalledSamples++
+		for _, a := range g.Alleles {
+			if a == GenotypeMissing {
+				continue
+			}
+			if a > nalts {
+				return s, fmt.Errorf("%w: SiteStats: %v:%v: allele %v with only %v alts", ErrVcfFormat, v.Chr, v.Start+1, a, nalts)
+			}
+			counts[a]++
+			s.CalledAlleles++
+		}
+		if !g.HasMissing() {
+			nonmissing++
+			if g.IsHet() {
+				hets++
+			}
+		}
+	}
+
+	s.AltFreqs = make([]float64, nalts)
+	s.ExpectedHet = 1
+	for a, c := range counts {
+		p := 0.0
+		if s.CalledAlleles > 0 {
+			p = float64(c) / float64(s.CalledAlleles)
+		}
+		if a > 0 {
+			s.AltFreqs[a-1] = p
+		}
+		s.ExpectedHet -= p * p
+	}
+	if s.CalledAlleles == 0 {
+		s.ExpectedHet = 0
+	}
+	if nonmissing > 0 {
+		s.Heterozygosity = float64(hets) / float64(nonmissing)
+	}
+	if len(gts) > 0 {
+		s.Missingness = float64(missing) / float64(len(gts))
+	}
+	return s, nil
+}
+
+func VcfSiteStatsIter(it iter.Seq2[VcfEntry[VcfTypedInfoSamples], error]) iter.Seq2[VcfSiteStats, error] {
+	return func(yield func(VcfSiteStats, error) bool) {
+		for v, e := range it {
+			if e != nil {
+				yield(VcfSiteStats{}, e)
+				return
+			}
+			s, e := SiteStats(v)
+			if !yield(s, e) || e != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package fastats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGenotype(t *testing.T) {
+	cases := []struct {
+		gt  string
+		exp Genotype
+		het bool
+	}{
+		{"0/1", Genotype{[]int{0, 1}, false}, true},
+		{"1|1", Genotype{[]int{1, 1}, true}, false},
+		{"./.", Genotype{[]int{-1, -1}, false}, false},
+		{"0|.", Genotype{[]int{0, -1}, true}, false},
+		{"2", Genotype{[]int{2}, false}, false},
+	}
+	for _, c := range cases {
+		g, e := ParseGenotype(c.gt)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !reflect.DeepEqual(g, c.exp) || g.IsHet() != c.het || g.String() != c.gt {
+			t.Errorf("%v: got %+v het %v", c.gt, g, g.IsHet())
+		}
+	}
+	if _, e := ParseGenotype("0/"); e == nil {
+		t.Errorf("expected error for 0/")
+	}
+}
+
+const genoVcf = `##fileformat=VCFv4.2
+##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">
+##FORMAT=<ID=DP,Number=1,Type=Integer,Description="Depth">
+##FORMAT=<ID=AD,Number=R,Type=Integer,Description="Allelic depths">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO	FORMAT	a	b	c	d
+chr1	5	.	A	T	.	PASS	.	GT:DP:AD	0/1:12:6,6	1/1:8:0,8	./.:.:.	0/0:10:10,0
+`
+
+func TestVcfSiteStats(t *testing.T) {
+	h, it, e := ParseTypedVcf(strings.NewReader(genoVcf))
+	if e != nil {
+		t.Fatal(e)
+	}
+	vs, e := CollectErr(it)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	b, ok := h.Sample(vs[0].InfoAndSamples, "b")
+	if !ok {
+		t.Fatal("no sample b")
+	}
+	if dp, ok := b.DP(); !ok || dp != 8 {
+		t.Errorf("DP %v %v", dp, ok)
+	}
+	if ad, ok := b.AD(); !ok || !reflect.DeepEqual(ad, []int64{0, 8}) {
+		t.Errorf("AD %v %v", ad, ok)
+	}
+	c, _ := h.Sample(vs[0].InfoAndSamples, "c")
+	if _, ok := c.DP(); ok {
+		t.Errorf("missing DP reported present")
+	}
+
+	stats, e := CollectErr(VcfSiteStatsIter(SliceIter2(vs)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	s := stats[0]
+	if s.AltFreqs[0] != 0.5 || s.CalledSamples != 3 || s.Missingness != 0.25 || s.Heterozygosity != 1.0/3 || s.ExpectedHet != 0.5 {
+		t.Errorf("stats %+v", s)
+	}
+
+	raw, e := ParseVcfInfoSamples(strings.Split("chr1\t5\t.\tA\tT\t.\tPASS\t.\tGT:DP:AD\t0/1:12:6,6\t1/1", "\t"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ad, _ := raw.SampleField(0, "AD"); ad != "6,6" {
+		t.Errorf("raw AD %q", ad)
+	}
+	if dp, ok := raw.SampleField(1, "DP"); !ok || dp != "" {
+		t.Errorf("raw padded DP %q %v", dp, ok)
+	}
+}
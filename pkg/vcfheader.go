@@ -0,0 +1,652 @@
+package fastats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// An ##INFO or ##FORMAT definition
+type VcfFieldDef struct {
+	ID string
+	// An integer, or one of "A", "R", "G" or "."
+	Number string
+	// Integer, Float, Flag, Character or String
+	Type        string
+	Description string
+	Other       []InfoPair[string]
+}
+
+type VcfFilterDef struct {
+	ID          string
+	Description string
+	Other       []InfoPair[string]
+}
+
+type VcfContig struct {
+	ID    string
+	Len   int64
+	Other []InfoPair[string]
+}
+
+func (c VcfContig) SpanChr() string  { return c.ID }
+func (c VcfContig) SpanStart() int64 { return 0 }
+func (c VcfContig) SpanEnd() int64   { return c.Len }
+
+type VcfMeta struct {
+	FileFormat string
+	Info       []VcfFieldDef
+	Format     []VcfFieldDef
+	Filter     []VcfFilterDef
+	Contigs    []VcfContig
+	// Other meta lines, without the leading "##"
+	Other   []string
+	Samples []string
+}
+
+var vcfFixedColumns = []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}
+
+// Split the inside of a structured meta line, like ID=DP,Number=1,...,
+// into key-value pairs, unquoting quoted values.
+func ParseVcfMetaFields(s string) ([]InfoPair[string], error) {
+	var out []InfoPair[string]
+	for len(s) > 0 {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: ParseVcfMetaFields: no '=' in %q", ErrVcfFormat, s)
+		}
+		var val strings.Builder
+		i := 0
+		if len(rest) > 0 && rest[0] == '"' {
+			closed := false
+			for i = 1; i < len(rest); i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+					val.WriteByte(rest[i])
+					continue
+				}
+				if rest[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				val.WriteByte(rest[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("%w: ParseVcfMetaFields: unterminated quote in %q", ErrVcfFormat, rest)
+			}
+			if i < len(rest) && rest[i] != ',' {
+				return nil, fmt.Errorf("%w: ParseVcfMetaFields: text after closing quote in %q", ErrVcfFormat, rest)
+			}
+		} else {
+			for i < len(rest) && rest[i] != ',' {
+				i++
+			}
+			val.WriteString(rest[:i])
+		}
+		out = append(out, InfoPair[string]{strings.TrimSpace(key), val.String()})
+		if i < len(rest) {
+			i++
+		}
+		s = rest[i:]
+	}
+	return out, nil
+}
+
+func vcfMetaQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func formatVcfMeta(b *strings.Builder, kind string, known []InfoPair[string], other []InfoPair[string]) {
+	fmt.Fprintf(b, "%v=<", kind)
+	first := true
+	write := func(key, val string) {
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+		if key == "Description" || strings.ContainsAny(val, ",\"<> \t=") {
+			val = vcfMetaQuote(val)
+		}
+		fmt.Fprintf(b, "%v=%v", key, val)
+	}
+	for _, p := range known {
+		if p.Val != "" || p.Key == "Description" {
+			write(p.Key, p.Val)
+		}
+	}
+	for _, p := range other {
+		write(p.Key, p.Val)
+	}
+	b.WriteByte('>')
+}
+
+func parseVcfFieldDef(fields []InfoPair[string]) (VcfFieldDef, error) {
+	var d VcfFieldDef
+	for _, f := range fields {
+		switch f.Key {
+		case "ID":
+			d.ID = f.Val
+		case "Number":
+			d.Number = f.Val
+		case "Type":
+			d.Type = f.Val
+		case "Description":
+			d.Description = f.Val
+		default:
+			d.Other = append(d.Other, f)
+		}
+	}
+	if d.ID == "" || d.Number == "" || d.Type == "" {
+		return d, fmt.Errorf("%w: field definition missing ID, Number or Type: %v", ErrVcfFormat, fields)
+	}
+	switch d.Number {
+	case "A", "R", "G", ".":
+	default:
+		if n, e := strconv.Atoi(d.Number); e != nil || n < 0 {
+			return d, fmt.Errorf("%w: field %v: invalid Number %q", ErrVcfFormat, d.ID, d.Number)
+		}
+	}
+	switch d.Type {
+	case "Integer", "Float", "Flag", "Character", "String":
+	default:
+		return d, fmt.Errorf("%w: field %v: invalid Type %q", ErrVcfFormat, d.ID, d.Type)
+	}
+	return d, nil
+}
+
+// Add one header line, including its leading "##" or "#", to h.
+func (h *VcfMeta) AddLine(line string) error {
+	if strings.HasPrefix(line, "#CHROM") {
+		fields := strings.Split(line, "\t")
+		for i, col := range vcfFixedColumns {
+			if i >= len(fields) || fields[i] != col {
+				return fmt.Errorf("%w: VcfMeta.AddLine: bad column line %q", ErrVcfFormat, line)
+			}
+		}
+		h.Samples = nil
+		if len(fields) > 9 {
+			h.Samples = append(h.Samples, fields[9:]...)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(line, "##") {
+		return fmt.Errorf("%w: VcfMeta.AddLine: %q is not a header line", ErrVcfFormat, line)
+	}
+	meta := line[2:]
+	kind, val, _ := strings.Cut(meta, "=")
+	if kind == "fileformat" {
+		h.FileFormat = val
+		return nil
+	}
+	if !strings.HasPrefix(val, "<") || !strings.HasSuffix(val, ">") {
+		h.Other = append(h.Other, meta)
+		return nil
+	}
+
+	switch kind {
+	case "INFO", "FORMAT", "FILTER", "contig":
+	default:
+		h.Other = append(h.Other, meta)
+		return nil
+	}
+	fields, e := ParseVcfMetaFields(val[1 : len(val)-1])
+	if e != nil {
+		return fmt.Errorf("VcfMeta.AddLine: %w", e)
+	}
+
+	switch kind {
+	case "INFO", "FORMAT":
+		d, e := parseVcfFieldDef(fields)
+		if e != nil {
+			return fmt.Errorf("VcfMeta.AddLine: ##%v: %w", kind, e)
+		}
+		if kind == "INFO" {
+			h.Info = append(h.Info, d)
+		} else {
+			h.Format = append(h.Format, d)
+		}
+	case "FILTER":
+		var f VcfFilterDef
+		for _, p := range fields {
+			switch p.Key {
+			case "ID":
+				f.ID = p.Val
+			case "Description":
+				f.Description = p.Val
+			default:
+				f.Other = append(f.Other, p)
+			}
+		}
+		if f.ID == "" {
+			return fmt.Errorf("%w: VcfMeta.AddLine: ##FILTER missing ID: %v", ErrVcfFormat, line)
+		}
+		h.Filter = append(h.Filter, f)
+	case "contig":
+		var c VcfContig
+		for _, p := range fields {
+			switch p.Key {
+			case "ID":
+				c.ID = p.Val
+			case "length":
+				if c.Len, e = strconv.ParseInt(p.Val, 10, 64); e != nil {
+					return fmt.Errorf("VcfMeta.AddLine: ##contig length: %w", e)
+				}
+			default:
+				c.Other = append(c.Other, p)
+			}
+		}
+		if c.ID == "" {
+			return fmt.Errorf("%w: VcfMeta.AddLine: ##contig missing ID: %v", ErrVcfFormat, line)
+		}
+		h.Contigs = append(h.Contigs, c)
+	}
+	return nil
+}
+
+func ParseVcfHeaderLines(lines []string) (VcfMeta, error) {
+	var h VcfMeta
+	for _, line := range lines {
+		if e := h.AddLine(line); e != nil {
+			return h, e
+		}
+	}
+	return h, nil
+}
+
+// The header lines, ending with the #CHROM line. Unrecognized meta lines
+// come right after ##fileformat.
+func (h VcfMeta) Lines() []string {
+	var out []string
+	if h.FileFormat != "" {
+		out = append(out, "##fileformat="+h.FileFormat)
+	}
+	for _, o := range h.Other {
+		out = append(out, "##"+o)
+	}
+	var b strings.Builder
+	meta := func(kind string, known, other []InfoPair[string]) {
+		b.Reset()
+		b.WriteString("##")
+		formatVcfMeta(&b, kind, known, other)
+		out = append(out, b.String())
+	}
+	for _, f := range h.Filter {
+		meta("FILTER", []InfoPair[string]{{"ID", f.ID}, {"Description", f.Description}}, f.Other)
+	}
+	for _, d := range h.Info {
+		meta("INFO", []InfoPair[string]{{"ID", d.ID}, {"Number", d.Number}, {"Type", d.Type}, {"Description", d.Description}}, d.Other)
+	}
+	for _, d := range h.Format {
+		meta("FORMAT", []InfoPair[string]{{"ID", d.ID}, {"Number", d.Number}, {"Type", d.Type}, {"Description", d.Description}}, d.Other)
+	}
+	for _, c := range h.Contigs {
+		length := ""
+		if c.Len > 0 {
+			length = fmt.Sprint(c.Len)
+		}
+		meta("contig", []InfoPair[string]{{"ID", c.ID}, {"length", length}}, c.Other)
+	}
+
+	cols := strings.Join(vcfFixedColumns, "\t")
+	if len(h.Samples) > 0 {
+		cols += "\tFORMAT\t" + strings.Join(h.Samples, "\t")
+	}
+	return append(out, cols)
+}
+
+func WriteVcfHeader(w io.Writer, h VcfMeta) error {
+	for _, line := range h.Lines() {
+		if _, e := fmt.Fprintln(w, line); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func findVcfFieldDef(defs []VcfFieldDef, id string) (VcfFieldDef, bool) {
+	for _, d := range defs {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return VcfFieldDef{}, false
+}
+
+func (h VcfMeta) InfoDef(id string) (VcfFieldDef, bool) {
+	return findVcfFieldDef(h.Info, id)
+}
+
+func (h VcfMeta) FormatDef(id string) (VcfFieldDef, bool) {
+	return findVcfFieldDef(h.Format, id)
+}
+
+func (h VcfMeta) SampleIndex(name string) int {
+	for i, s := range h.Samples {
+		if s == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h VcfMeta) ContigLen(id string) (int64, bool) {
+	for _, c := range h.Contigs {
+		if c.ID == id {
+			return c.Len, true
+		}
+	}
+	return 0, false
+}
+
+// Number of genotypes for nalts alternate alleles at the given ploidy.
+func VcfGenotypeCount(nalts, ploidy int) int {
+	// (nalts + ploidy) choose ploidy
+	n := 1
+	for i := 1; i <= ploidy; i++ {
+		n = n * (nalts + i) / i
+	}
+	return n
+}
+
+// The number of values d requires, or false if it can vary.
+func (d VcfFieldDef) Count(nalts, ploidy int) (int, bool) {
+	switch d.Number {
+	case "A":
+		return nalts, true
+	case "R":
+		return nalts + 1, true
+	case "G":
+		return VcfGenotypeCount(nalts, ploidy), true
+	case ".":
+		return 0, false
+	}
+	n, e := strconv.Atoi(d.Number)
+	return n, e == nil
+}
+
+// Missing Integer values are stored as VcfMissingInt and missing Float
+// values as NaN.
+const VcfMissingInt = math.MinInt64
+
+// A decoded INFO or FORMAT value. Only the slice matching Type is set;
+// Character values are stored in Strings.
+type VcfValue struct {
+	Type    string
+	Flag    bool
+	Ints    []int64
+	Floats  []float64
+	Strings []string
+}
+
+func (v VcfValue) Len() int {
+	switch v.Type {
+	case "Integer":
+		return len(v.Ints)
+	case "Float":
+		return len(v.Floats)
+	case "Flag":
+		return 0
+	}
+	return len(v.Strings)
+}
+
+func (v VcfValue) IsFlag() bool {
+	return v.Type == "Flag"
+}
+
+// The value as written in a VCF.
+func (v VcfValue) String() string {
+	var fields []string
+	switch v.Type {
+	case "Flag":
+		return ""
+	case "Integer":
+		for _, i := range v.Ints {
+			if i == VcfMissingInt {
+				fields = append(fields, ".")
+			} else {
+				fields = append(fields, strconv.FormatInt(i, 10))
+			}
+		}
+	case "Float":
+		for _, f := range v.Floats {
+			if math.IsNaN(f) {
+				fields = append(fields, ".")
+			} else {
+				fields = append(fields, strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		}
+	default:
+		fields = v.Strings
+	}
+	if len(fields) == 0 {
+		return "."
+	}
+	return strings.Join(fields, ",")
+}
+
+func (v VcfValue) Format(format string) string {
+	return v.String()
+}
+
+// Decode one value according to d. A lone "." is a missing value and is
+// accepted for any Number.
+func DecodeVcfValue(d VcfFieldDef, s string, nalts, ploidy int) (VcfValue, error) {
+	v := VcfValue{Type: d.Type}
+	if d.Type == "Flag" {
+		v.Flag = true
+		return v, nil
+	}
+	if s == "." || s == "" {
+		return v, nil
+	}
+	var fields []string
+	if d.Type == "String" && d.Number == "1" {
+		fields = []string{s}
+	} else {
+		fields = strings.Split(s, ",")
+	}
+	if n, ok := d.Count(nalts, ploidy); ok && n != len(fields) {
+		return v, fmt.Errorf("%w: %v: Number=%v requires %v values, got %q", ErrVcfFormat, d.ID, d.Number, n, s)
+	}
+
+	for _, f := range fields {
+		switch d.Type {
+		case "Integer":
+			i := int64(VcfMissingInt)
+			if f != "." {
+				var e error
+				if i, e = strconv.ParseInt(f, 10, 64); e != nil {
+					return v, fmt.Errorf("%w: %v: %w", ErrVcfFormat, d.ID, e)
+				}
+			}
+			v.Ints = append(v.Ints, i)
+		case "Float":
+			fl := math.NaN()
+			if f != "." {
+				var e error
+				if fl, e = strconv.ParseFloat(f, 64); e != nil {
+					return v, fmt.Errorf("%w: %v: %w", ErrVcfFormat, d.ID, e)
+				}
+			}
+			v.Floats = append(v.Floats, fl)
+		default:
+			v.Strings = append(v.Strings, f)
+		}
+	}
+	return v, nil
+}
+
+// Fields missing from the header are decoded as Number=. Strings, or Flags
+// if they have no value.
+func undefinedVcfFieldDef(id string, hasVal bool) VcfFieldDef {
+	if hasVal {
+		return VcfFieldDef{ID: id, Number: ".", Type: "String"}
+	}
+	return VcfFieldDef{ID: id, Number: "0", Type: "Flag"}
+}
+
+func (h VcfMeta) DecodeInfo(info string, nalts int) ([]InfoPair[VcfValue], error) {
+	if info == "." || info == "" {
+		return nil, nil
+	}
+	fields := strings.Split(info, ";")
+	out := make([]InfoPair[VcfValue], 0, len(fields))
+	for _, field := range fields {
+		key, val, hasVal := strings.Cut(field, "=")
+		d, ok := h.InfoDef(key)
+		if !ok {
+			d = undefinedVcfFieldDef(key, hasVal)
+		}
+		v, e := DecodeVcfValue(d, val, nalts, 2)
+		if e != nil {
+			return nil, fmt.Errorf("INFO: %w", e)
+		}
+		out = append(out, InfoPair[VcfValue]{key, v})
+	}
+	return out, nil
+}
+
+// Number of alleles in a GT value, like 0/1 or 1|0|2.
+func VcfPloidy(gt string) int {
+	if gt == "" {
+		return 0
+	}
+	return strings.Count(gt, "/") + strings.Count(gt, "|") + 1
+}
+
+func (h VcfMeta) DecodeSample(format []string, sample string, nalts int) ([]VcfValue, error) {
+	fields := strings.Split(sample, ":")
+	if len(fields) > len(format) {
+		return nil, fmt.Errorf("%w: sample %q has more fields than FORMAT %v", ErrVcfFormat, sample, format)
+	}
+	ploidy := 2
+	for i, key := range format {
+		if key == "GT" && i < len(fields) {
+			ploidy = VcfPloidy(fields[i])
+		}
+	}
+
+	out := make([]VcfValue, 0, len(format))
+	for i, key := range format {
+		d, ok := h.FormatDef(key)
+		if !ok {
+			d = undefinedVcfFieldDef(key, true)
+		}
+		val := "."
+		if i < len(fields) {
+			val = fields[i]
+		}
+		v, e := DecodeVcfValue(d, val, nalts, ploidy)
+		if e != nil {
+			return nil, fmt.Errorf("FORMAT: %w", e)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+type VcfTypedInfoSamples = StructuredInfoSamples[VcfValue, VcfValue]
+
+func vcfNumAlts(alt string) int {
+	if alt == "." {
+		return 0
+	}
+	return strings.Count(alt, ",") + 1
+}
+
+// Decode the INFO and sample columns of a VCF line. For use with ParseVcf.
+func (h VcfMeta) ParseInfoSamples(line []string) (VcfTypedInfoSamples, error) {
+	var s VcfTypedInfoSamples
+	if len(line) < 8 {
+		return s, nil
+	}
+	nalts := vcfNumAlts(line[4])
+	var e error
+	if s.Info, e = h.DecodeInfo(line[7], nalts); e != nil {
+		return s, e
+	}
+	if len(line) < 9 {
+		return s, nil
+	}
+	s.Samples.Format = strings.Split(line[8], ":")
+	for _, sample := range line[9:] {
+		v, e := h.DecodeSample(s.Samples.Format, sample, nalts)
+		if e != nil {
+			return s, e
+		}
+		s.Samples.Samples = append(s.Samples.Samples, v)
+	}
+	return s, nil
+}
+
+// Read the header of a VCF, then return an iterator over its typed entries.
+func ParseTypedVcf(r io.Reader) (VcfMeta, iter.Seq2[VcfEntry[VcfTypedInfoSamples], error], error) {
+	br := bufio.NewReader(r)
+	var h VcfMeta
+	for {
+		c, e := br.Peek(1)
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return h, nil, e
+		}
+		if c[0] != '#' {
+			break
+		}
+		line, e := br.ReadString('\n')
+		if e != nil && e != io.EOF {
+			return h, nil, e
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if e := h.AddLine(line); e != nil {
+			return h, nil, e
+		}
+		if strings.HasPrefix(line, "#CHROM") {
+			break
+		}
+	}
+	return h, ParseVcf(br, h.ParseInfoSamples), nil
+}
+
+// Like StructuredVcfEntryToCsv, but with empty INFO written as "." and no
+// FORMAT column for a record without samples, so that sites-only records are
+// valid VCF.
+func TypedVcfEntryToCsv(buf []string, v VcfEntry[VcfTypedInfoSamples]) ([]string, error) {
+	buf, e := StructuredVcfEntryToCsv(buf, v)
+	if e != nil {
+		return nil, e
+	}
+	if buf[7] == "" {
+		buf[7] = "."
+	}
+	if s := v.InfoAndSamples.Samples; len(s.Format) == 0 && len(s.Samples) == 0 {
+		buf = buf[:8]
+	}
+	return buf, nil
+}
+
+func WriteTypedVcf(w io.Writer, h VcfMeta, it iter.Seq2[VcfEntry[VcfTypedInfoSamples], error]) error {
+	if e := WriteVcfHeader(w, h); e != nil {
+		return e
+	}
+	var buf []string
+	for v, e := range it {
+		if e != nil {
+			return e
+		}
+		if buf, e = TypedVcfEntryToCsv(buf, v); e != nil {
+			return e
+		}
+		if _, e := fmt.Fprintln(w, strings.Join(buf, "\t")); e != nil {
+			return e
+		}
+	}
+	return nil
+}
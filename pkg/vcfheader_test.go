@@ -0,0 +1,107 @@
+package fastats
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const typedVcf = `##fileformat=VCFv4.2
+##source=test
+##FILTER=<ID=q10,Description="Quality below 10">
+##INFO=<ID=DP,Number=1,Type=Integer,Description="Total depth">
+##INFO=<ID=AF,Number=A,Type=Float,Description="Allele frequency, per alt">
+##INFO=<ID=DB,Number=0,Type=Flag,Description="dbSNP membership">
+##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">
+##FORMAT=<ID=AD,Number=R,Type=Integer,Description="Allelic depths">
+##FORMAT=<ID=PL,Number=G,Type=Integer,Description="Phred \"genotype\" likelihoods">
+##contig=<ID=chr1,length=1000,assembly=test>
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO	FORMAT	s1	s2
+chr1	10	.	A	C,G	50	PASS	DP=20;AF=0.25,.;DB	GT:AD:PL	0/1:10,5,5:0,10,20,30,40,50	1:.:0,9,18
+`
+
+func TestParseTypedVcf(t *testing.T) {
+	h, it, e := ParseTypedVcf(strings.NewReader(typedVcf))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(h.Info) != 3 || len(h.Format) != 3 || len(h.Filter) != 1 || len(h.Contigs) != 1 {
+		t.Fatalf("header %+v", h)
+	}
+	if h.Info[1].Description != "Allele frequency, per alt" || h.Format[2].Description != `Phred "genotype" likelihoods` {
+		t.Errorf("descriptions %q %q", h.Info[1].Description, h.Format[2].Description)
+	}
+	if l, ok := h.ContigLen("chr1"); !ok || l != 1000 {
+		t.Errorf("ContigLen %v %v", l, ok)
+	}
+	if h.SampleIndex("s2") != 1 {
+		t.Errorf("samples %v", h.Samples)
+	}
+
+	vs, e := CollectErr(it)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(vs) != 1 {
+		t.Fatalf("len(vs) %v != 1", len(vs))
+	}
+	is := vs[0].InfoAndSamples
+	if dp := is.Info[0].Val; dp.Ints[0] != 20 {
+		t.Errorf("DP %v", dp)
+	}
+	if af := is.Info[1].Val; af.Floats[0] != 0.25 || !math.IsNaN(af.Floats[1]) {
+		t.Errorf("AF %v", af)
+	}
+	if !is.Info[2].Val.Flag {
+		t.Errorf("DB %v", is.Info[2].Val)
+	}
+	if pl := is.Samples.Samples[0][2]; len(pl.Ints) != 6 {
+		t.Errorf("diploid PL %v", pl)
+	}
+	if pl := is.Samples.Samples[1][2]; len(pl.Ints) != 3 {
+		t.Errorf("haploid PL %v", pl)
+	}
+
+	var b strings.Builder
+	if e := WriteTypedVcf(&b, h, SliceIter2(vs)); e != nil {
+		t.Fatal(e)
+	}
+	if b.String() != typedVcf {
+		t.Errorf("round trip:\n%v\nexp:\n%v", b.String(), typedVcf)
+	}
+}
+
+func TestWriteTypedVcfSitesOnly(t *testing.T) {
+	in := "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\nchr1\t10\t.\tA\tC\t50\tPASS\t.\n"
+	h, it, e := ParseTypedVcf(strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var b strings.Builder
+	if e := WriteTypedVcf(&b, h, it); e != nil {
+		t.Fatal(e)
+	}
+	if b.String() != in {
+		t.Errorf("round trip:\n%q\nexp:\n%q", b.String(), in)
+	}
+
+	// StructuredVcfEntryToCsv keeps its output for existing callers.
+	v := VcfEntry[VcfTypedInfoSamples]{VcfHead: VcfHead{ChrSpan: ChrSpan{"chr1", Span{9, 10}}, ID: ".", Ref: "A", Alts: []string{"C"}, Qual: 50, Filter: "PASS"}}
+	buf, e := StructuredVcfEntryToCsv(nil, v)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := strings.Join(buf, "\t"); got != "chr1\t10\t.\tA\tC\t50\tPASS\t\t" {
+		t.Errorf("StructuredVcfEntryToCsv %q", got)
+	}
+}
+
+func TestDecodeVcfValueCount(t *testing.T) {
+	d := VcfFieldDef{ID: "AD", Number: "R", Type: "Integer"}
+	if _, e := DecodeVcfValue(d, "1,2", 2, 2); e == nil {
+		t.Errorf("expected error for too few Number=R values")
+	}
+	if v, e := DecodeVcfValue(d, ".", 2, 2); e != nil || v.Len() != 0 {
+		t.Errorf("missing value %v %v", v, e)
+	}
+}
@@ -139,20 +139,38 @@ func ParseInfo(info string) (keys, vals []string) {
 }
 
 func ParseVcfInfoSamples(line []string) (VcfInfoSamples, error) {
-	if len(line) < 7 {
+	if len(line) < 8 {
 		return VcfInfoSamples{}, nil
 	}
 	var s VcfInfoSamples
 	s.InfoKeys, s.InfoVals = ParseInfo(line[7])
-	s.Format = strings.Split(line[8], ":")
-	for i := 9; i < len(line); i++ {
-		s.Samples = append(s.Samples, strings.Split(line[i], ","))
+	if len(line) < 9 {
+		return s, nil
 	}
+	s.Format = strings.Split(line[8], ":")
 	for i := 9; i < len(line); i++ {
-		for len(s.Samples[len(s.Samples)-1]) < len(s.Format) {
-			s.Samples[len(s.Samples)-1] = append(s.Samples[len(s.Samples)-1], "")
-			// return s, fmt.Errorf("%w: len(s.Samples[%v]) %v, %v != len(s.Format) %v, %v", ErrVcfFormat, i, len(s.Samples[i]), s.Samples[i], len(s.Format), s.Format)
+		sample := strings.Split(line[i], ":")
+		if len(sample) > len(s.Format) {
+			return s, fmt.Errorf("%w: len(s.Samples[%v]) %v, %v > len(s.Format) %v, %v", ErrVcfFormat, i-9, len(sample), sample, len(s.Format), s.Format)
+		}
+		// Trailing fields may be dropped
+		for len(sample) < len(s.Format) {
+			sample = append(sample, "")
 		}
+		s.Samples = append(s.Samples, sample)
 	}
 	return s, nil
 }
+
+// The value of a FORMAT field for the sample at index i.
+func (s VcfInfoSamples) SampleField(i int, key string) (string, bool) {
+	if i < 0 || i >= len(s.Samples) {
+		return "", false
+	}
+	for j, f := range s.Format {
+		if f == key {
+			return s.Samples[i][j], true
+		}
+	}
+	return "", false
+}
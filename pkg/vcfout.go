@@ -76,6 +76,20 @@ type InfoPair[T any] struct {
 	Val T
 }
 
+// Implemented by INFO values that are flags, which are written without "=".
+type InfoFlagger interface {
+	IsFlag() bool
+}
+
+func writeInfoPair[T any](w io.Writer, info InfoPair[T]) error {
+	if f, ok := any(info.Val).(InfoFlagger); ok && f.IsFlag() {
+		_, e := fmt.Fprintf(w, "%v", info.Key)
+		return e
+	}
+	_, e := fmt.Fprintf(w, "%v=%v", info.Key, info.Val)
+	return e
+}
+
 type Formatter interface {
 	Format(format string) string
 }
@@ -98,7 +112,7 @@ func InfoToString[T any](is []InfoPair[T]) (string, error) {
 	}
 
 	if len(is) > 0 {
-		_, e := fmt.Fprintf(&b, "%v=%v", is[0].Key, is[0].Val)
+		e := writeInfoPair(&b, is[0])
 		if e != nil {
 			return "", e
 		}
@@ -109,7 +123,8 @@ func InfoToString[T any](is []InfoPair[T]) (string, error) {
 	}
 
 	for _, info := range is[1:] {
-		_, e := fmt.Fprintf(&b, ";%v=%v", info.Key, info.Val)
+		b.WriteByte(';')
+		e := writeInfoPair(&b, info)
 		if e != nil {
 			return "", e
 		}
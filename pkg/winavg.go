@@ -6,22 +6,27 @@ import (
 	"github.com/montanaflynn/stats"
 	"iter"
 	"log"
+	"math"
 	"os"
 )
 
 // func WindowSortedBed[B BedEnter[FT], FT any](it iter.Seq2[B, error], winsize, winstep int) func(func(BedEntry[[]B], error) bool) {
 
-func WinAvgSortedBed[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+// With fillEmpty, empty windows are NaN without logging an error.
+func avgWindows[B BedEnter[float64]](winIter iter.Seq2[BedEntry[[]B], error], fillEmpty bool) iter.Seq2[BedEntry[float64], error] {
 	return func(yield func(BedEntry[float64], error) bool) {
-		winIter := WindowSortedBed(it, winsize, winstep)
 		for win, err := range winIter {
 			vals := []float64{}
 			for _, bedEntry := range win.Fields {
 				vals = append(vals, bedEntry.BedFields())
 			}
-			avg, err2 := stats.Mean(vals)
-			if err2 != nil {
-				log.Print(err2)
+			avg := math.NaN()
+			if len(vals) > 0 || !fillEmpty {
+				var err2 error
+				avg, err2 = stats.Mean(vals)
+				if err2 != nil {
+					log.Print(err2)
+				}
 			}
 			b := BedEntry[float64]{}
 			b.ChrSpan = win.ChrSpan
@@ -33,19 +38,38 @@ func WinAvgSortedBed[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winst
 	}
 }
 
+func WinAvgSortedBed[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+	return avgWindows(WindowSortedBed(it, winsize, winstep), false)
+}
+
+// Like WinAvgSortedBed, but over every window of the genome; empty windows
+// are NaN.
+func WinAvgSortedBedGenome[B BedEnter[float64]](it iter.Seq2[B, error], genome []FaLen, winsize, winstep int) iter.Seq2[BedEntry[float64], error] {
+	return avgWindows(WindowSortedBedGenome(it, genome, winsize, winstep), true)
+}
+
 type WinAvgSortedBedFlags struct {
 	WinSize int
 	WinStep int
+	Genome  string
 }
 
 func FullWinAvgSortedBed() {
 	var f WinAvgSortedBedFlags
 	flag.IntVar(&f.WinSize, "w", 1, "Set the window size")
 	flag.IntVar(&f.WinStep, "s", 1, "Set the window step")
+	flag.StringVar(&f.Genome, "g", "", "Genome file of chromosome lengths; output every window, clamped to chromosome ends")
 	flag.Parse()
 
 	bed := ParseBedGraph(os.Stdin)
 	wins := WinAvgSortedBed(bed, f.WinSize, f.WinStep)
+	if f.Genome != "" {
+		genome, e := ReadGenomeFilePath(f.Genome)
+		if e != nil {
+			log.Fatal(e)
+		}
+		wins = WinAvgSortedBedGenome(bed, genome, f.WinSize, f.WinStep)
+	}
 	for win, err := range wins {
 		if err != nil {
 			log.Fatal(err)
@@ -57,17 +81,21 @@ func FullWinAvgSortedBed() {
 	}
 }
 
-func WinSumSortedBed[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winstep int, perBp bool) iter.Seq2[BedEntry[float64], error] {
+// With fillEmpty, empty windows are 0 without logging an error.
+func sumWindows[B BedEnter[float64]](winIter iter.Seq2[BedEntry[[]B], error], perBp, fillEmpty bool) iter.Seq2[BedEntry[float64], error] {
 	return func(yield func(BedEntry[float64], error) bool) {
-		winIter := WindowSortedBed(it, winsize, winstep)
 		for win, err := range winIter {
 			vals := []float64{}
 			for _, bedEntry := range win.Fields {
 				vals = append(vals, bedEntry.BedFields())
 			}
-			avg, err2 := stats.Sum(vals)
-			if err2 != nil {
-				log.Print(err2)
+			avg := 0.0
+			if len(vals) > 0 || !fillEmpty {
+				var err2 error
+				avg, err2 = stats.Sum(vals)
+				if err2 != nil {
+					log.Print(err2)
+				}
 			}
 			if perBp {
 				avg /= float64(win.SpanEnd() - win.SpanStart())
@@ -82,10 +110,21 @@ func WinSumSortedBed[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winst
 	}
 }
 
+func WinSumSortedBed[B BedEnter[float64]](it iter.Seq2[B, error], winsize, winstep int, perBp bool) iter.Seq2[BedEntry[float64], error] {
+	return sumWindows(WindowSortedBed(it, winsize, winstep), perBp, false)
+}
+
+// Like WinSumSortedBed, but over every window of the genome; empty windows
+// are 0.
+func WinSumSortedBedGenome[B BedEnter[float64]](it iter.Seq2[B, error], genome []FaLen, winsize, winstep int, perBp bool) iter.Seq2[BedEntry[float64], error] {
+	return sumWindows(WindowSortedBedGenome(it, genome, winsize, winstep), perBp, true)
+}
+
 type WinSumSortedBedFlags struct {
 	WinSize int
 	WinStep int
 	PerBp bool
+	Genome string
 }
 
 func FullWinSumSortedBed() {
@@ -93,10 +132,18 @@ func FullWinSumSortedBed() {
 	flag.IntVar(&f.WinSize, "w", 1, "Set the window size")
 	flag.IntVar(&f.WinStep, "s", 1, "Set the window step")
 	flag.BoolVar(&f.PerBp, "b", false, "Divide sum by size of window")
+	flag.StringVar(&f.Genome, "g", "", "Genome file of chromosome lengths; output every window, clamped to chromosome ends")
 	flag.Parse()
 
 	bed := ParseBedGraph(os.Stdin)
 	wins := WinSumSortedBed(bed, f.WinSize, f.WinStep, f.PerBp)
+	if f.Genome != "" {
+		genome, e := ReadGenomeFilePath(f.Genome)
+		if e != nil {
+			log.Fatal(e)
+		}
+		wins = WinSumSortedBedGenome(bed, genome, f.WinSize, f.WinStep, f.PerBp)
+	}
 	for win, err := range wins {
 		if err != nil {
 			log.Fatal(err)